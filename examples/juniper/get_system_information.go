@@ -28,6 +28,7 @@ var (
 	nopassphrase = flag.Bool("nopassphrase", false, "SSH private key does not contain a passphrase")
 	pubkey       = flag.Bool("pubkey", false, "Use SSH public key authentication")
 	agent        = flag.Bool("agent", false, "Use SSH agent for public key authentication")
+	knownHosts   = flag.String("known-hosts", os.Getenv("HOME")+"/.ssh/known_hosts", "SSH known hosts file")
 )
 
 // SystemInformation provides a representation of the system-information container
@@ -84,6 +85,13 @@ func BuildConfig() *ssh.ClientConfig {
 
 		config = netconf.SSHConfigPassword(*username, string(bytePassword))
 	}
+
+	hostKeyCallback, err := netconf.KnownHostsCallback(*knownHosts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	config.HostKeyCallback = hostKeyCallback
+
 	return config
 }
 
@@ -9,16 +9,23 @@ package main
 import (
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
 
 	"github.com/Juniper/go-netconf/netconf"
 	"golang.org/x/crypto/ssh"
 )
 
 func main() {
+	hostKeyCallback, err := netconf.KnownHostsCallback(filepath.Join(os.Getenv("HOME"), ".ssh", "known_hosts"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	sshConfig := &ssh.ClientConfig{
 		User:            "myuser",
 		Auth:            []ssh.AuthMethod{ssh.Password("mypass")},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		HostKeyCallback: hostKeyCallback,
 	}
 
 	s, err := netconf.DialSSH("1.1.1.1", sshConfig)
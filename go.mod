@@ -1,6 +1,6 @@
 module github.com/Juniper/go-netconf
 
-go 1.12
+go 1.13
 
 require (
 	github.com/google/go-cmp v0.5.1
@@ -0,0 +1,203 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"crypto/tls"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// callHomeSSHPort is the default port devices call home on over SSH
+	// (RFC8071)
+	callHomeSSHPort = 4334
+	// callHomeTLSPort is the default port devices call home on over TLS
+	// (RFC8071)
+	callHomeTLSPort = 4335
+)
+
+// CallHomeListener accepts NETCONF Call Home connections (RFC8071), where the
+// device opens the TCP connection and the client then acts as usual, as SSH or
+// TLS client, over the accepted socket.
+type CallHomeListener struct {
+	listener net.Listener
+	connect  func(net.Conn) (*Session, error)
+	handler  func(*Session)
+	wg       sync.WaitGroup
+
+	mu      sync.Mutex
+	closing bool
+	// quit is closed by Shutdown.
+	quit chan struct{}
+	// pending holds the connections whose session is being set up.
+	pending map[net.Conn]struct{}
+	logger  Logger
+}
+
+// ListenCallHomeSSH listens on addr for devices calling home over SSH, the
+// port defaulting to 4334. Each connection is set up as a SSH client with
+// config and the resulting session handed to handler in its own goroutine;
+// connections failing the SSH handshake or hello exchange are dropped.
+//
+// The handler owns the session and must close it.
+func ListenCallHomeSSH(addr string, config *ssh.ClientConfig, handler func(*Session)) (*CallHomeListener, error) {
+	return listenCallHome(addr, callHomeSSHPort, func(conn net.Conn) (*Session, error) {
+		return NewSSHSession(conn, config)
+	}, handler)
+}
+
+// ListenCallHomeTLS listens on addr for devices calling home over TLS, the
+// port defaulting to 4335. It is like ListenCallHomeSSH but sets up each
+// connection as a TLS client with config. When config.ServerName is empty,
+// the device certificate is verified against its IP address. The client
+// certificate can be rotated without restarting the listener by setting
+// config.GetClientCertificate, see ClientCertificateCallback.
+func ListenCallHomeTLS(addr string, config *tls.Config, handler func(*Session)) (*CallHomeListener, error) {
+	return listenCallHome(addr, callHomeTLSPort, func(conn net.Conn) (*Session, error) {
+		c := config
+		if c == nil || c.ServerName == "" {
+			if c == nil {
+				c = &tls.Config{}
+			} else {
+				c = c.Clone()
+			}
+			if host, _, err := net.SplitHostPort(conn.RemoteAddr().String()); err == nil {
+				c.ServerName = host
+			}
+		}
+		return NewTLSSession(conn, c)
+	}, handler)
+}
+
+func listenCallHome(addr string, port int, connect func(net.Conn) (*Session, error), handler func(*Session)) (*CallHomeListener, error) {
+	listener, err := net.Listen("tcp", withDefaultPort(addr, port))
+	if err != nil {
+		return nil, err
+	}
+	return newCallHomeListener(listener, connect, handler), nil
+}
+
+// newCallHomeListener returns a CallHomeListener accepting connections on
+// listener.
+func newCallHomeListener(listener net.Listener, connect func(net.Conn) (*Session, error), handler func(*Session)) *CallHomeListener {
+	l := &CallHomeListener{
+		listener: listener,
+		connect:  connect,
+		handler:  handler,
+		quit:     make(chan struct{}),
+		pending:  make(map[net.Conn]struct{}),
+	}
+	l.wg.Add(1)
+	go l.serve()
+	return l
+}
+
+// SetLogger sets the Logger receiving the errors accepting connections,
+// which the listener retries.
+func (l *CallHomeListener) SetLogger(logger Logger) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.logger = logger
+}
+
+// Addr returns the address the listener accepts connections on.
+func (l *CallHomeListener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+// Shutdown stops accepting connections, aborts the ones whose session is being
+// set up and waits for running handlers to return.
+func (l *CallHomeListener) Shutdown() error {
+	l.mu.Lock()
+	if !l.closing {
+		l.closing = true
+		close(l.quit)
+	}
+	for conn := range l.pending {
+		conn.Close()
+	}
+	l.mu.Unlock()
+
+	err := l.listener.Close()
+	l.wg.Wait()
+	return err
+}
+
+// maxAcceptDelay is the longest the listener waits before accepting again
+// after an error.
+const maxAcceptDelay = time.Second
+
+func (l *CallHomeListener) serve() {
+	defer l.wg.Done()
+
+	var delay time.Duration
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			l.mu.Lock()
+			closing, log := l.closing, logger(l.logger)
+			l.mu.Unlock()
+			if closing {
+				return
+			}
+
+			// Errors such as running out of file descriptors are retried
+			// with a backoff, as net/http does, until Shutdown.
+			if delay == 0 {
+				delay = 5 * time.Millisecond
+			} else if delay *= 2; delay > maxAcceptDelay {
+				delay = maxAcceptDelay
+			}
+			log.Debugf("netconf: call home accept error: %v; retrying in %v", err, delay)
+			select {
+			case <-time.After(delay):
+			case <-l.quit:
+				return
+			}
+			continue
+		}
+		delay = 0
+
+		l.wg.Add(1)
+		go l.handle(conn)
+	}
+}
+
+// handle sets up the session of an accepted connection and runs the handler.
+func (l *CallHomeListener) handle(conn net.Conn) {
+	defer l.wg.Done()
+
+	l.mu.Lock()
+	if l.closing {
+		l.mu.Unlock()
+		conn.Close()
+		return
+	}
+	l.pending[conn] = struct{}{}
+	l.mu.Unlock()
+
+	s, err := l.connect(conn)
+
+	l.mu.Lock()
+	delete(l.pending, conn)
+	closing := l.closing
+	l.mu.Unlock()
+
+	if err != nil {
+		conn.Close()
+		return
+	}
+	if closing {
+		s.Close()
+		return
+	}
+	l.handler(s)
+}
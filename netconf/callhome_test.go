@@ -0,0 +1,191 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestListenCallHomeSSH(t *testing.T) {
+	sessions := make(chan *Session)
+	l, err := ListenCallHomeSSH("127.0.0.1:0", &ssh.ClientConfig{
+		User:            "test",
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}, func(s *Session) {
+		sessions <- s
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Several devices calling home at once.
+	config := noAuthServerConfig(newTestSigner(t))
+	for i := 0; i < 3; i++ {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		go serveNetconfSSHConn(conn, config, func(ch ssh.Channel, st *TransportBasicIO) {
+			serveRequests(make(chan string, 1), "<ok/>")(st)
+		})
+	}
+
+	for i := 0; i < 3; i++ {
+		s := <-sessions
+		if s.SessionID != 1 {
+			t.Errorf("expected session-id 1, got %d", s.SessionID)
+		}
+		if _, err := s.Exec(MethodGetConfig("running")); err != nil {
+			t.Error(err)
+		}
+		s.Close()
+	}
+
+	if err := l.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	if conn, err := net.Dial("tcp", l.Addr().String()); err == nil {
+		conn.Close()
+		t.Error("listener still accepting after Shutdown")
+	}
+}
+
+func TestListenCallHomeTLS(t *testing.T) {
+	pki := newTestPKI(t)
+
+	sessions := make(chan *Session)
+	l, err := ListenCallHomeTLS("127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{pki.client},
+		RootCAs:      pki.pool,
+	}, func(s *Session) {
+		sessions <- s
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Shutdown()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	go func() {
+		st := &TransportBasicIO{ReadWriteCloser: tls.Server(conn, &tls.Config{
+			Certificates: []tls.Certificate{pki.server},
+			ClientCAs:    pki.pool,
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+		})}
+		if err := st.SendHello(&HelloMessage{Capabilities: []string{"urn:ietf:params:netconf:base:1.0"}, SessionID: 9}); err != nil {
+			return
+		}
+		if _, err := st.ReceiveHello(); err != nil {
+			return
+		}
+		serveRequests(make(chan string), "<ok/>")(st)
+	}()
+
+	s := <-sessions
+	defer s.Close()
+	if s.SessionID != 9 {
+		t.Errorf("expected session-id 9, got %d", s.SessionID)
+	}
+}
+
+func TestCallHomeShutdownPending(t *testing.T) {
+	l, err := ListenCallHomeSSH("127.0.0.1:0", &ssh.ClientConfig{
+		User:            "test",
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}, func(s *Session) {
+		t.Error("unexpected session")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A device connecting but never starting the SSH handshake.
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		// Give the listener time to accept the connection.
+		time.Sleep(50 * time.Millisecond)
+		done <- l.Shutdown()
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Shutdown blocked on the pending connection")
+	}
+}
+
+// failingListener fails the first Accept calls once start is closed.
+type failingListener struct {
+	net.Listener
+	start chan struct{}
+	fails int
+}
+
+func (l *failingListener) Accept() (net.Conn, error) {
+	<-l.start
+	if l.fails > 0 {
+		l.fails--
+		return nil, errors.New("accept: too many open files")
+	}
+	return l.Listener.Accept()
+}
+
+func TestCallHomeAcceptError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	failing := &failingListener{Listener: ln, start: make(chan struct{}), fails: 3}
+
+	accepted := make(chan struct{}, 1)
+	l := newCallHomeListener(failing, func(conn net.Conn) (*Session, error) {
+		accepted <- struct{}{}
+		return nil, errors.New("no session")
+	}, func(s *Session) {})
+	var log testLogger
+	l.SetLogger(&log)
+	close(failing.start)
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	select {
+	case <-accepted:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the listener to keep accepting after errors")
+	}
+	if err := l.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	if len(log.debug) != 3 {
+		t.Errorf("expected 3 accept errors logged, got %q", log.debug)
+	}
+}
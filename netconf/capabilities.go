@@ -0,0 +1,122 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Capability URNs defined by RFC5277, RFC6241, RFC6243 and RFC8526, and used
+// by this package.
+const (
+	CapabilityBase10            = "urn:ietf:params:netconf:base:1.0"
+	CapabilityBase11            = "urn:ietf:params:netconf:base:1.1"
+	CapabilityCandidate         = "urn:ietf:params:netconf:capability:candidate:1.0"
+	CapabilityConfirmedCommit   = "urn:ietf:params:netconf:capability:confirmed-commit:1.0"
+	CapabilityConfirmedCommit11 = "urn:ietf:params:netconf:capability:confirmed-commit:1.1"
+	CapabilityRollbackOnError   = "urn:ietf:params:netconf:capability:rollback-on-error:1.0"
+	CapabilityValidate          = "urn:ietf:params:netconf:capability:validate:1.0"
+	CapabilityValidate11        = "urn:ietf:params:netconf:capability:validate:1.1"
+	CapabilityStartup           = "urn:ietf:params:netconf:capability:startup:1.0"
+	CapabilityXPath             = "urn:ietf:params:netconf:capability:xpath:1.0"
+	CapabilityWithDefaults      = "urn:ietf:params:netconf:capability:with-defaults:1.0"
+	CapabilityNMDA              = "urn:ietf:params:xml:ns:yang:ietf-netconf-nmda"
+	CapabilityNotification      = "urn:ietf:params:netconf:capability:notification:1.0"
+	CapabilityInterleave        = "urn:ietf:params:netconf:capability:interleave:1.0"
+	CapabilityURL               = "urn:ietf:params:netconf:capability:url:1.0"
+	CapabilityYANGLibrary11     = "urn:ietf:params:netconf:capability:yang-library:1.1"
+)
+
+// CapabilityJunos is advertised by Junos devices, which support the Junos
+// extensions of commit, see CommitWithOptions.
+const CapabilityJunos = "http://xml.juniper.net/netconf/junos/1.0"
+
+// Capabilities is a list of capabilities advertised in a hello message. A
+// capability is a URN, possibly followed by parameters in the form of a URL
+// query such as ?basic-mode=explicit&also-supported=trim.
+type Capabilities []string
+
+// Has reports whether the capability urn, without parameters, is listed.
+func (c Capabilities) Has(urn string) bool {
+	return hasCapability(c, urn)
+}
+
+// Params returns the parameters of the capability urn, or nil if it is not
+// listed. Parameters given more than once only keep their first value.
+func (c Capabilities) Params(urn string) map[string]string {
+	for _, capability := range c {
+		capability = strings.TrimSpace(capability)
+		query := ""
+		if i := strings.IndexByte(capability, '?'); i > -1 {
+			query = capability[i+1:]
+		}
+		if capabilityURN(capability) != urn {
+			continue
+		}
+
+		params := make(map[string]string)
+		values, _ := url.ParseQuery(query)
+		for k, v := range values {
+			params[k] = v[0]
+		}
+		return params
+	}
+	return nil
+}
+
+// ErrCapabilityNotSupported is returned when an operation requires a
+// capability the server did not advertise.
+var ErrCapabilityNotSupported = errors.New("netconf: capability not supported by server")
+
+// capabilityValidator is implemented by RPC methods that depend on server
+// capabilities, to be checked before they are sent.
+type capabilityValidator interface {
+	validate(caps []string) error
+}
+
+// hasCapability reports whether caps contains urn, ignoring any parameters.
+func hasCapability(caps []string, urn string) bool {
+	for _, capability := range caps {
+		if capabilityURN(capability) == urn {
+			return true
+		}
+	}
+	return false
+}
+
+// capabilityURN returns capability without its parameters.
+func capabilityURN(capability string) string {
+	capability = strings.TrimSpace(capability)
+	if i := strings.IndexByte(capability, '?'); i > -1 {
+		capability = capability[:i]
+	}
+	return capability
+}
+
+// commonCapabilities returns the capabilities of server also advertised by
+// client, ignoring parameters.
+func commonCapabilities(client, server []string) Capabilities {
+	var common Capabilities
+	for _, capability := range server {
+		if hasCapability(client, capabilityURN(capability)) {
+			common = append(common, capability)
+		}
+	}
+	return common
+}
+
+// requireCapability returns an error wrapping ErrCapabilityNotSupported
+// naming what needed urn when caps does not contain it.
+func requireCapability(caps []string, urn string, what string) error {
+	if !hasCapability(caps, urn) {
+		return fmt.Errorf("%w: %s requires %s", ErrCapabilityNotSupported, what, urn)
+	}
+	return nil
+}
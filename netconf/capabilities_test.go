@@ -0,0 +1,54 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCapabilities(t *testing.T) {
+	var hello HelloMessage
+	err := xml.Unmarshal([]byte(`<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities>
+<capability>urn:ietf:params:netconf:base:1.1</capability>
+<capability>
+  urn:ietf:params:netconf:capability:candidate:1.0
+</capability>
+<capability>urn:ietf:params:netconf:capability:with-defaults:1.0?basic-mode=explicit&amp;also-supported=report-all,trim</capability>
+<capability>urn:example:module?module=example&amp;revision=2019-01-01</capability>
+</capabilities></hello>`), &hello)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caps := hello.Capabilities
+
+	tt := []struct {
+		urn    string
+		has    bool
+		params map[string]string
+	}{
+		{"urn:ietf:params:netconf:base:1.1", true, map[string]string{}},
+		{CapabilityCandidate, true, map[string]string{}},
+		{CapabilityWithDefaults, true, map[string]string{"basic-mode": "explicit", "also-supported": "report-all,trim"}},
+		{"urn:example:module", true, map[string]string{"module": "example", "revision": "2019-01-01"}},
+		{CapabilityStartup, false, nil},
+		{"urn:ietf:params:netconf:capability", false, nil},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.urn, func(t *testing.T) {
+			if got := caps.Has(tc.urn); got != tc.has {
+				t.Errorf("Has returned %t, expected %t", got, tc.has)
+			}
+			if got := caps.Params(tc.urn); !cmp.Equal(got, tc.params) {
+				t.Errorf("unexpected params:\n%s", cmp.Diff(tc.params, got))
+			}
+		})
+	}
+}
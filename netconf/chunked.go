@@ -0,0 +1,299 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// maxChunkSizeDigits is the number of digits of the largest chunk size,
+// 4294967295.
+const maxChunkSizeDigits = 10
+
+// chunkContextSize is the number of bytes kept on each side of an invalid
+// byte in a ChunkError.
+const chunkContextSize = 32
+
+// ChunkError is returned when a message received with chunked framing is
+// malformed, describing where and how for diagnosing the sender. It matches
+// ErrMalformedChunk with errors.Is.
+type ChunkError struct {
+	// Offset is the position of the invalid byte in the message, framing
+	// included.
+	Offset int64
+	// Context holds the bytes received around the invalid one.
+	Context []byte
+	// Expected describes what the framing requires at Offset, and Got what
+	// was received instead.
+	Expected string
+	Got      string
+}
+
+func (e *ChunkError) Error() string {
+	return fmt.Sprintf("netconf: invalid chunk at offset %d: expected %s, got %s near %q", e.Offset, e.Expected, e.Got, e.Context)
+}
+
+func (e *ChunkError) Unwrap() error {
+	return ErrMalformedChunk
+}
+
+// States of a chunkDecoder.
+const (
+	chunkStateLF        = iota // expecting the LF starting a chunk header
+	chunkStateHash             // expecting the # following it
+	chunkStateSizeStart        // expecting a chunk size or the # ending the message
+	chunkStateSize             // reading a chunk size
+	chunkStateData             // reading chunk data
+	chunkStateEndLF            // expecting the LF ending the message
+)
+
+// chunkDecoder decodes a message framed in chunks (RFC6242 section 4.2). The
+// message can be fed in pieces of any size, the decoder carrying its state
+// from one to the next.
+type chunkDecoder struct {
+	state int
+	// digits holds the chunk size being read.
+	digits  [maxChunkSizeDigits]byte
+	ndigits int
+	// size is the count of bytes left to read in the current chunk.
+	size uint64
+	// offset is the count of bytes of the message decoded before the current
+	// input, recent holding the last nrecent of them for errors.
+	offset  int64
+	recent  [chunkContextSize]byte
+	nrecent int
+}
+
+// fail returns a ChunkError for the byte at i in in.
+func (d *chunkDecoder) fail(in []byte, i int, expected, got string) error {
+	context := append([]byte(nil), d.recent[:d.nrecent]...)
+	before := in[:i]
+	if len(before) > chunkContextSize {
+		before = before[len(before)-chunkContextSize:]
+	}
+	context = append(context, before...)
+	if len(context) > chunkContextSize {
+		context = context[len(context)-chunkContextSize:]
+	}
+	after := in[i:]
+	if len(after) > chunkContextSize {
+		after = after[:chunkContextSize]
+	}
+
+	return &ChunkError{
+		Offset:   d.offset + int64(i),
+		Context:  append(context, after...),
+		Expected: expected,
+		Got:      got,
+	}
+}
+
+// remember keeps the last bytes of p, decoded, in recent.
+func (d *chunkDecoder) remember(p []byte) {
+	d.offset += int64(len(p))
+	if len(p) >= chunkContextSize {
+		d.nrecent = copy(d.recent[:], p[len(p)-chunkContextSize:])
+		return
+	}
+	keep := chunkContextSize - len(p)
+	if keep > d.nrecent {
+		keep = d.nrecent
+	}
+	copy(d.recent[:], d.recent[d.nrecent-keep:d.nrecent])
+	d.nrecent = keep + copy(d.recent[keep:], p)
+}
+
+// decode appends the data of the chunks in in to out, returning the number of
+// bytes consumed and whether the end of the message was reached, in which case
+// the bytes past it were not consumed and the decoder is ready for the next
+// message.
+func (d *chunkDecoder) decode(out *bytes.Buffer, in []byte) (int, bool, error) {
+	i := 0
+	for i < len(in) {
+		c := in[i]
+		switch d.state {
+		case chunkStateLF:
+			if c != '\n' {
+				return i, false, d.fail(in, i, "LF starting a chunk", strconv.QuoteRune(rune(c)))
+			}
+			d.state = chunkStateHash
+		case chunkStateHash:
+			if c != '#' {
+				return i, false, d.fail(in, i, "# starting a chunk", strconv.QuoteRune(rune(c)))
+			}
+			d.state = chunkStateSizeStart
+		case chunkStateSizeStart:
+			if c == '#' {
+				d.state = chunkStateEndLF
+				break
+			}
+			// Chunk sizes have no leading zero and can't be zero.
+			if c < '1' || c > '9' {
+				return i, false, d.fail(in, i, "chunk size or # ending the message", strconv.QuoteRune(rune(c)))
+			}
+			d.digits[0] = c
+			d.ndigits = 1
+			d.state = chunkStateSize
+		case chunkStateSize:
+			if c == '\n' {
+				size, err := strconv.ParseUint(string(d.digits[:d.ndigits]), 10, 32)
+				if err != nil {
+					return i, false, d.fail(in, i, "chunk size up to 4294967295", "chunk size "+string(d.digits[:d.ndigits]))
+				}
+				d.size = size
+				d.state = chunkStateData
+				break
+			}
+			if c < '0' || c > '9' {
+				return i, false, d.fail(in, i, "chunk size digit or LF", strconv.QuoteRune(rune(c)))
+			}
+			if d.ndigits == maxChunkSizeDigits {
+				return i, false, d.fail(in, i, "chunk size up to 4294967295", "chunk size "+string(d.digits[:d.ndigits])+"...")
+			}
+			d.digits[d.ndigits] = c
+			d.ndigits++
+		case chunkStateData:
+			n := uint64(len(in) - i)
+			if n > d.size {
+				n = d.size
+			}
+			out.Write(in[i : i+int(n)])
+			i += int(n)
+			if d.size -= n; d.size == 0 {
+				d.state = chunkStateLF
+			}
+			continue
+		case chunkStateEndLF:
+			if c != '\n' {
+				return i, false, d.fail(in, i, "LF ending the message", strconv.QuoteRune(rune(c)))
+			}
+			*d = chunkDecoder{}
+			return i + 1, true, nil
+		}
+		i++
+	}
+	d.remember(in)
+	return i, false, nil
+}
+
+// DefaultMinChunkSize and DefaultMaxChunkSize are the bounds of the size of
+// the chunks sent with 1.1 framing when TransportBasicIO.MinChunkSize and
+// MaxChunkSize are not set.
+const (
+	DefaultMinChunkSize = 4 * 1024
+	DefaultMaxChunkSize = 64 * 1024
+)
+
+// chunkSizer tunes the size of the chunks sent to the throughput measured
+// writing them, starting at min and doubling up to max while larger chunks
+// are written at least as fast, halving when writes slow down.
+type chunkSizer struct {
+	min, max int
+	size     int
+	// rate is the smoothed throughput of the previous writes, in bytes per
+	// second.
+	rate float64
+}
+
+// next returns the size of the next chunk.
+func (c *chunkSizer) next() int {
+	if c.size == 0 {
+		c.size = c.min
+	}
+	return c.size
+}
+
+// observe tunes the size to the time d it took to write a chunk of n bytes.
+func (c *chunkSizer) observe(n int, d time.Duration) {
+	if c.min >= c.max || n < c.next() {
+		return
+	}
+	if d <= 0 {
+		d = time.Nanosecond
+	}
+	rate := float64(n) / d.Seconds()
+
+	switch {
+	case c.rate == 0 || rate >= c.rate:
+		c.size *= 2
+	case rate < c.rate/2:
+		c.size /= 2
+	}
+	if c.size > c.max {
+		c.size = c.max
+	}
+	if c.size < c.min {
+		c.size = c.min
+	}
+
+	if c.rate == 0 {
+		c.rate = rate
+	} else {
+		c.rate = (3*c.rate + rate) / 4
+	}
+}
+
+// appendChunks appends the chunks framing data (RFC6242 section 4.2) to
+// frames, each chunk header followed by at most size bytes of data, which
+// isn't copied.
+func appendChunks(frames net.Buffers, data []byte, size int) net.Buffers {
+	for len(data) > 0 {
+		n := len(data)
+		if n > size {
+			n = size
+		}
+		frames = append(frames, []byte(fmt.Sprintf("\n#%d\n", n)), data[:n])
+		data = data[n:]
+	}
+	return frames
+}
+
+// writeChunks writes data to w framed in chunks whose size is given by
+// sizer, timing each write to tune the size of the next one. With a fixed
+// size, the chunks are written at once.
+func writeChunks(w io.Writer, data []byte, sizer *chunkSizer) error {
+	if sizer.min >= sizer.max {
+		frames := appendChunks(nil, data, sizer.next())
+		_, err := frames.WriteTo(w)
+		return err
+	}
+
+	for len(data) > 0 {
+		n := sizer.next()
+		if n > len(data) {
+			n = len(data)
+		}
+		frames := appendChunks(nil, data[:n], n)
+		start := time.Now()
+		if _, err := frames.WriteTo(w); err != nil {
+			return err
+		}
+		sizer.observe(n, time.Since(start))
+		data = data[n:]
+	}
+	return nil
+}
+
+// chunkWriter frames what is written to it in chunks (RFC6242 section 4.2),
+// each Write making up one chunk, or several ones past the size given by
+// sizer. The end of message marker is left to the caller.
+type chunkWriter struct {
+	w     io.Writer
+	sizer *chunkSizer
+}
+
+func (cw *chunkWriter) Write(p []byte) (int, error) {
+	if err := writeChunks(cw.w, p, cw.sizer); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,349 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// errIncomplete marks a test input as not holding a whole message.
+var errIncomplete = errors.New("incomplete message")
+
+func TestChunkDecoder(t *testing.T) {
+	tt := []struct {
+		name     string
+		input    string
+		expected string
+		rest     string
+		err      error
+	}{
+		{
+			name:     "single chunk",
+			input:    "\n#5\nhello\n##\n",
+			expected: "hello",
+		},
+		{
+			name:     "multiple chunks",
+			input:    "\n#4\n<rpc\n#14\n>\n##\n#4\n</rpc>\n##\n\n#1\n>\n##\n",
+			expected: "<rpc>\n##\n#4\n</rpc>",
+			rest:     "\n#1\n>\n##\n",
+		},
+		{
+			name:     "multi-digit size",
+			input:    "\n#12\nhello world!\n##\n",
+			expected: "hello world!",
+		},
+		{
+			name:  "missing hash",
+			input: "\n5\nhello\n##\n",
+			err:   ErrMalformedChunk,
+		},
+		{
+			name:  "invalid size",
+			input: "\n#5a\nhello\n##\n",
+			err:   ErrMalformedChunk,
+		},
+		{
+			name:  "zero size",
+			input: "\n#0\n\n##\n",
+			err:   ErrMalformedChunk,
+		},
+		{
+			name:  "leading zero",
+			input: "\n#05\nhello\n##\n",
+			err:   ErrMalformedChunk,
+		},
+		{
+			name:     "largest size",
+			input:    "\n#4294967295\nhello",
+			expected: "hello",
+			err:      errIncomplete,
+		},
+		{
+			name:  "size out of range",
+			input: "\n#4294967296\nhello\n##\n",
+			err:   ErrMalformedChunk,
+		},
+		{
+			name:  "size too long",
+			input: "\n#10000000000\nhello\n##\n",
+			err:   ErrMalformedChunk,
+		},
+		{
+			name:  "missing end",
+			input: "\n#5\nhello\n#\n",
+			err:   ErrMalformedChunk,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			// Feed the input a byte at a time, then all at once.
+			for _, step := range []int{1, len(tc.input)} {
+				var d chunkDecoder
+				var out bytes.Buffer
+				var err error
+				done := false
+				i := 0
+				for i < len(tc.input) && !done && err == nil {
+					end := i + step
+					if end > len(tc.input) {
+						end = len(tc.input)
+					}
+					var n int
+					n, done, err = d.decode(&out, []byte(tc.input[i:end]))
+					i += n
+				}
+
+				if err == nil && !done {
+					err = errIncomplete
+				}
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("step %d: expected error %v, got %v", step, tc.err, err)
+				}
+				if (err == nil || err == errIncomplete) && out.String() != tc.expected {
+					t.Errorf("step %d: got %q, expected %q", step, out.String(), tc.expected)
+				}
+				if rest := tc.input[i:]; err == nil && rest != tc.rest {
+					t.Errorf("step %d: got rest %q, expected %q", step, rest, tc.rest)
+				}
+			}
+		})
+	}
+}
+
+func TestChunkError(t *testing.T) {
+	long := strings.Repeat("x", 40)
+
+	tt := []struct {
+		name     string
+		input    string
+		expected ChunkError
+		// after is the number of bytes of the context following the
+		// invalid one.
+		after int
+	}{
+		{
+			name:  "missing end",
+			input: "\n#5\nhello\n#\n",
+			expected: ChunkError{
+				Offset:   11,
+				Context:  []byte("\n#5\nhello\n#\n"),
+				Expected: "chunk size or # ending the message",
+				Got:      `'\n'`,
+			},
+		},
+		{
+			name:  "size out of range",
+			input: "\n#4294967296\n",
+			expected: ChunkError{
+				Offset:   12,
+				Context:  []byte("\n#4294967296\n"),
+				Expected: "chunk size up to 4294967295",
+				Got:      "chunk size 4294967296",
+			},
+		},
+		{
+			name:  "context",
+			input: "\n#40\n" + long + "\n#2\nab#" + long,
+			expected: ChunkError{
+				Offset:   51,
+				Context:  []byte(long[:26] + "\n#2\nab" + "#" + long[:31]),
+				Expected: "LF starting a chunk",
+				Got:      "'#'",
+			},
+			after: 31,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, step := range []int{1, len(tc.input)} {
+				var d chunkDecoder
+				var out bytes.Buffer
+				var err error
+				for i := 0; i < len(tc.input) && err == nil; i += step {
+					end := i + step
+					if end > len(tc.input) {
+						end = len(tc.input)
+					}
+					_, _, err = d.decode(&out, []byte(tc.input[i:end]))
+				}
+
+				var chunkErr *ChunkError
+				if !errors.As(err, &chunkErr) || !errors.Is(err, ErrMalformedChunk) {
+					t.Fatalf("step %d: expected a ChunkError, got %v", step, err)
+				}
+				// Fed a byte at a time, the decoder can't see past the
+				// invalid byte.
+				expected := tc.expected
+				if step == 1 {
+					expected.Context = expected.Context[:len(expected.Context)-tc.after]
+				}
+				if !reflect.DeepEqual(*chunkErr, expected) {
+					t.Errorf("step %d: got %+q, expected %+q", step, *chunkErr, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestReceiveChunkedByteByByte(t *testing.T) {
+	input := "\n#6\n<rpc-r\n#12\neply><ok/></\n#10\nrpc-reply>\n##\n\n#3\n<a/\n#1\n>\n##\n"
+
+	var trans TransportBasicIO
+	trans.ReadWriteCloser = newNilCloser(&shortReader{r: bytes.NewReader([]byte(input)), n: 1}, new(bytes.Buffer))
+	trans.SetVersion("v1.1")
+
+	for _, expected := range []string{"<rpc-reply><ok/></rpc-reply>", "<a/>"} {
+		msg, err := trans.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(msg) != expected {
+			t.Errorf("got %q, expected %q", msg, expected)
+		}
+	}
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	tt := []struct {
+		name    string
+		version string
+		input   string
+	}{
+		{"netconf10", "v1.0", "<rpc-reply><data>0123456789</data></rpc-reply>]]>]]>"},
+		{"netconf11", "v1.1", "\n#21\n<rpc-reply><data>0123\n#25\n456789</data></rpc-reply>\n##\n"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			trans, _ := newTransportTest(tc.input)
+			trans.SetVersion(tc.version)
+			trans.BufferSize = 4
+			trans.MaxMessageSize = 32
+
+			if _, err := trans.Receive(); !errors.Is(err, ErrMessageTooLarge) {
+				t.Errorf("expected ErrMessageTooLarge, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSendChunked(t *testing.T) {
+	data := bytes.Repeat([]byte("<interface><name>ge-0/0/0</name></interface>"), 5000)
+
+	var out bytes.Buffer
+	var trans TransportBasicIO
+	trans.ReadWriteCloser = newNilCloser(new(bytes.Buffer), &out)
+	trans.SetVersion("v1.1")
+	trans.MinChunkSize, trans.MaxChunkSize = 65536, 65536
+	if err := trans.Send(data); err != nil {
+		t.Fatal(err)
+	}
+
+	// 220000 bytes make three full chunks and a last one of 23392 bytes.
+	if n := bytes.Count(out.Bytes(), []byte("\n#65536\n")); n != 3 {
+		t.Errorf("expected 3 chunks of 65536 bytes, got %d", n)
+	}
+	if !bytes.Contains(out.Bytes(), []byte("\n#23392\n")) {
+		t.Error("expected a last chunk of 23392 bytes")
+	}
+
+	trans.ReadWriteCloser = newNilCloser(&out, new(bytes.Buffer))
+	msg, err := trans.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(msg, data) {
+		t.Errorf("received %d bytes, expected the %d bytes sent", len(msg), len(data))
+	}
+}
+
+func TestSendChunkedAdaptive(t *testing.T) {
+	data := bytes.Repeat([]byte("<interface><name>ge-0/0/0</name></interface>"), 5000)
+
+	var out bytes.Buffer
+	var trans TransportBasicIO
+	trans.ReadWriteCloser = newNilCloser(new(bytes.Buffer), &out)
+	trans.SetVersion("v1.1")
+	trans.MinChunkSize, trans.MaxChunkSize = 1024, 16384
+	if err := trans.Send(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.HasPrefix(out.Bytes(), []byte("\n#1024\n")) {
+		t.Errorf("expected a first chunk of 1024 bytes, got %.10q", out.Bytes())
+	}
+	if bytes.Contains(out.Bytes(), []byte("\n#32768\n")) {
+		t.Error("expected chunks of at most 16384 bytes")
+	}
+
+	trans.ReadWriteCloser = newNilCloser(&out, new(bytes.Buffer))
+	msg, err := trans.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(msg, data) {
+		t.Errorf("received %d bytes, expected the %d bytes sent", len(msg), len(data))
+	}
+}
+
+func TestChunkSizer(t *testing.T) {
+	tt := []struct {
+		name     string
+		min, max int
+		writes   []time.Duration
+		expected []int
+	}{
+		{
+			name:     "grows to the maximum",
+			min:      1024,
+			max:      8192,
+			writes:   []time.Duration{time.Millisecond, time.Millisecond, time.Millisecond, time.Millisecond},
+			expected: []int{2048, 4096, 8192, 8192},
+		},
+		{
+			name:     "shrinks when writes slow down",
+			min:      1024,
+			max:      65536,
+			writes:   []time.Duration{time.Millisecond, time.Millisecond, 100 * time.Millisecond, 100 * time.Millisecond},
+			expected: []int{2048, 4096, 2048, 1024},
+		},
+		{
+			name:     "holds on a small slowdown",
+			min:      1024,
+			max:      65536,
+			writes:   []time.Duration{time.Millisecond, 3 * time.Millisecond},
+			expected: []int{2048, 2048},
+		},
+		{
+			name:     "fixed",
+			min:      4096,
+			max:      4096,
+			writes:   []time.Duration{time.Millisecond, time.Millisecond},
+			expected: []int{4096, 4096},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &chunkSizer{min: tc.min, max: tc.max}
+			for i, d := range tc.writes {
+				c.observe(c.next(), d)
+				if size := c.next(); size != tc.expected[i] {
+					t.Errorf("write %d: expected a size of %d, got %d", i, tc.expected[i], size)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// Commit commits the candidate configuration as the device's new running
+// configuration. It also confirms a pending confirmed commit that was not
+// made persistent. See CommitWithOptions for vendor extensions.
+func (s *Session) Commit() error {
+	if err := requireCapability(s.ServerCapabilities, CapabilityCandidate, "commit"); err != nil {
+		return err
+	}
+
+	_, err := s.Exec(RawMethod("<commit/>"))
+	return err
+}
+
+// CommitOption is a vendor extension of commit, see CommitWithOptions.
+type CommitOption func(*commitOptions)
+
+type commitOptions struct {
+	comment     string
+	synchronize bool
+}
+
+// CommitComment records comment with the commit in the commit history of the
+// device, as Junos "commit comment" does. It requires CapabilityJunos.
+func CommitComment(comment string) CommitOption {
+	return func(o *commitOptions) {
+		o.comment = comment
+	}
+}
+
+// CommitSynchronize commits on both routing engines of the device, as Junos
+// "commit synchronize" does. It requires CapabilityJunos.
+func CommitSynchronize() CommitOption {
+	return func(o *commitOptions) {
+		o.synchronize = true
+	}
+}
+
+// CommitWithOptions is like Commit with vendor extensions, failing with
+// ErrCapabilityNotSupported when the server doesn't advertise the capability
+// they require. The extensions of Junos are sent as its commit-configuration
+// RPC. Without options it is Commit.
+func (s *Session) CommitWithOptions(opts ...CommitOption) error {
+	var o commitOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o == (commitOptions{}) {
+		return s.Commit()
+	}
+
+	if err := requireCapability(s.ServerCapabilities, CapabilityCandidate, "commit"); err != nil {
+		return err
+	}
+	if err := requireCapability(s.ServerCapabilities, CapabilityJunos, "commit comment and synchronize"); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("<commit-configuration>")
+	writeElement(&buf, "log", o.comment)
+	if o.synchronize {
+		buf.WriteString("<synchronize/>")
+	}
+	buf.WriteString("</commit-configuration>")
+
+	_, err := s.Exec(RawMethod(buf.String()))
+	return err
+}
+
+// ConfirmedCommit commits the candidate configuration, which the server
+// reverts unless it is confirmed within timeout (or the server default of 10
+// minutes when zero) by a Commit. A non-empty persist makes the commit survive
+// the end of this session so that it can be confirmed from another one using
+// persist as its persistID. A non-empty persistID confirms or extends such a
+// pending persistent commit. persist and persistID require the
+// :confirmed-commit:1.1 capability.
+func (s *Session) ConfirmedCommit(timeout time.Duration, persist, persistID string) error {
+	if err := requireCapability(s.ServerCapabilities, CapabilityCandidate, "commit"); err != nil {
+		return err
+	}
+	if !hasCapability(s.ServerCapabilities, CapabilityConfirmedCommit11) {
+		if err := requireCapability(s.ServerCapabilities, CapabilityConfirmedCommit, "confirmed commit"); err != nil {
+			return err
+		}
+		if persist != "" || persistID != "" {
+			return requireCapability(s.ServerCapabilities, CapabilityConfirmedCommit11, "persistent confirmed commit")
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("<commit><confirmed/>")
+	if timeout > 0 {
+		fmt.Fprintf(&buf, "<confirm-timeout>%d</confirm-timeout>", int64(timeout/time.Second))
+	}
+	writeElement(&buf, "persist", persist)
+	writeElement(&buf, "persist-id", persistID)
+	buf.WriteString("</commit>")
+
+	_, err := s.Exec(RawMethod(buf.String()))
+	return err
+}
+
+// PendingCommit is a confirmed commit awaiting confirmation, returned by
+// StartConfirmedCommit. The server reverts it unless Confirm is called before
+// its timeout expires. Servers supporting RFC6470 notify the outcome with a
+// netconf-confirmed-commit notification, see Notification.ConfirmedCommitEvent.
+type PendingCommit struct {
+	s         *Session
+	persistID string
+}
+
+// StartConfirmedCommit makes a confirmed commit like ConfirmedCommit and
+// returns a handle to confirm or cancel it. When persist is true, the commit
+// is made persistent with a random persist-id so that it survives the end of
+// this session and can be confirmed or canceled from another one, see
+// PersistID.
+func (s *Session) StartConfirmedCommit(timeout time.Duration, persist bool) (*PendingCommit, error) {
+	c := &PendingCommit{s: s}
+	if persist {
+		c.persistID = uuid()
+	}
+
+	if err := s.ConfirmedCommit(timeout, c.persistID, ""); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ResumeConfirmedCommit returns a handle to the persistent confirmed commit
+// identified by persistID, made from another session.
+func (s *Session) ResumeConfirmedCommit(persistID string) *PendingCommit {
+	return &PendingCommit{s: s, persistID: persistID}
+}
+
+// PersistID returns the persist-id of a persistent confirmed commit, empty
+// for one tied to the session it was made from.
+func (c *PendingCommit) PersistID() string {
+	return c.persistID
+}
+
+// Confirm confirms the commit, making it permanent.
+func (c *PendingCommit) Confirm() error {
+	if c.persistID == "" {
+		return c.s.Commit()
+	}
+	if err := requireCapability(c.s.ServerCapabilities, CapabilityCandidate, "commit"); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("<commit>")
+	writeElement(&buf, "persist-id", c.persistID)
+	buf.WriteString("</commit>")
+
+	_, err := c.s.Exec(RawMethod(buf.String()))
+	return err
+}
+
+// Cancel cancels the commit, reverting the running configuration. It requires
+// the :confirmed-commit:1.1 capability.
+func (c *PendingCommit) Cancel() error {
+	return c.s.CancelCommit(c.persistID)
+}
+
+// CancelCommit cancels a pending confirmed commit, reverting the running
+// configuration. persistID identifies a persistent confirmed commit and must
+// be empty to cancel one made from this session.
+func (s *Session) CancelCommit(persistID string) error {
+	if err := requireCapability(s.ServerCapabilities, CapabilityConfirmedCommit11, "cancel-commit"); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("<cancel-commit>")
+	writeElement(&buf, "persist-id", persistID)
+	buf.WriteString("</cancel-commit>")
+
+	_, err := s.Exec(RawMethod(buf.String()))
+	return err
+}
+
+// DiscardChanges reverts the candidate configuration to the current running
+// configuration.
+func (s *Session) DiscardChanges() error {
+	if err := requireCapability(s.ServerCapabilities, CapabilityCandidate, "discard-changes"); err != nil {
+		return err
+	}
+
+	_, err := s.Exec(RawMethod("<discard-changes/>"))
+	return err
+}
@@ -0,0 +1,160 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCommitOperations(t *testing.T) {
+	caps := append([]string{CapabilityCandidate, CapabilityConfirmedCommit11, CapabilityJunos}, DefaultCapabilities...)
+	requests := make(chan string, 1)
+	s := newSessionTest(t, caps, serveRequests(requests, "<ok/>"))
+	defer s.Close()
+
+	tt := []struct {
+		name     string
+		op       func() error
+		expected string
+	}{
+		{
+			name:     "commit",
+			op:       s.Commit,
+			expected: "<commit/>",
+		},
+		{
+			name:     "no options",
+			op:       func() error { return s.CommitWithOptions() },
+			expected: "<commit/>",
+		},
+		{
+			name:     "junos options",
+			op:       func() error { return s.CommitWithOptions(CommitComment("change <42>"), CommitSynchronize()) },
+			expected: "<commit-configuration><log>change &lt;42&gt;</log><synchronize/></commit-configuration>",
+		},
+		{
+			name:     "confirmed",
+			op:       func() error { return s.ConfirmedCommit(2*time.Minute, "", "") },
+			expected: "<commit><confirmed/><confirm-timeout>120</confirm-timeout></commit>",
+		},
+		{
+			name:     "persist",
+			op:       func() error { return s.ConfirmedCommit(0, "abc", "") },
+			expected: "<commit><confirmed/><persist>abc</persist></commit>",
+		},
+		{
+			name:     "cancel",
+			op:       func() error { return s.CancelCommit("abc") },
+			expected: "<cancel-commit><persist-id>abc</persist-id></cancel-commit>",
+		},
+		{
+			name:     "discard",
+			op:       s.DiscardChanges,
+			expected: "<discard-changes/>",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.op(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := requestBody(<-requests); got != tc.expected {
+				t.Errorf("got %s, expected %s", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestCommitCapabilities(t *testing.T) {
+	tt := []struct {
+		name string
+		caps []string
+		op   func(s *Session) error
+	}{
+		{
+			name: "commit",
+			op:   func(s *Session) error { return s.Commit() },
+		},
+		{
+			name: "comment",
+			caps: []string{CapabilityCandidate},
+			op:   func(s *Session) error { return s.CommitWithOptions(CommitComment("change")) },
+		},
+		{
+			name: "confirmed",
+			caps: []string{CapabilityCandidate},
+			op:   func(s *Session) error { return s.ConfirmedCommit(time.Minute, "", "") },
+		},
+		{
+			name: "persist",
+			caps: []string{CapabilityCandidate, CapabilityConfirmedCommit},
+			op:   func(s *Session) error { return s.ConfirmedCommit(time.Minute, "abc", "") },
+		},
+		{
+			name: "cancel",
+			caps: []string{CapabilityCandidate, CapabilityConfirmedCommit},
+			op:   func(s *Session) error { return s.CancelCommit("") },
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &Session{ServerCapabilities: tc.caps}
+			if err := tc.op(s); !errors.Is(err, ErrCapabilityNotSupported) {
+				t.Errorf("expected ErrCapabilityNotSupported, got %v", err)
+			}
+		})
+	}
+}
+
+func TestPendingCommit(t *testing.T) {
+	caps := append([]string{CapabilityCandidate, CapabilityConfirmedCommit11}, DefaultCapabilities...)
+	requests := make(chan string, 1)
+	s := newSessionTest(t, caps, serveRequests(requests, "<ok/>"))
+	defer s.Close()
+
+	c, err := s.StartConfirmedCommit(time.Minute, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := c.PersistID()
+	if id == "" {
+		t.Fatal("expected a persist-id")
+	}
+	if got, want := requestBody(<-requests), "<commit><confirmed/><confirm-timeout>60</confirm-timeout><persist>"+id+"</persist></commit>"; got != want {
+		t.Errorf("got %s, expected %s", got, want)
+	}
+
+	if err := c.Confirm(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := requestBody(<-requests), "<commit><persist-id>"+id+"</persist-id></commit>"; got != want {
+		t.Errorf("got %s, expected %s", got, want)
+	}
+
+	if err := s.ResumeConfirmedCommit(id).Cancel(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := requestBody(<-requests), "<cancel-commit><persist-id>"+id+"</persist-id></cancel-commit>"; got != want {
+		t.Errorf("got %s, expected %s", got, want)
+	}
+
+	c, err = s.StartConfirmedCommit(0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-requests
+	if err := c.Confirm(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := requestBody(<-requests), "<commit/>"; got != want {
+		t.Errorf("got %s, expected %s", got, want)
+	}
+}
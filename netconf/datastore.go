@@ -0,0 +1,343 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Datastore identifies a NETCONF configuration datastore, or a URL to be used
+// in its place by servers supporting the :url capability.
+type Datastore string
+
+// Configuration datastores defined by RFC6241
+const (
+	Running   Datastore = "running"
+	Candidate Datastore = "candidate"
+	Startup   Datastore = "startup"
+)
+
+// URL returns a Datastore referring to the configuration file at url, such as
+// ftp://example.com/backup.xml.
+func URL(url string) Datastore {
+	return Datastore(url)
+}
+
+// IsURL reports whether d refers to a URL rather than a datastore. Datastore
+// names never contain a colon while URLs always do, after their scheme.
+func (d Datastore) IsURL() bool {
+	return strings.Contains(string(d), ":")
+}
+
+// validate checks that the server supports d, i.e. for a URL that it has the
+// :url capability with the scheme of the URL among those it lists.
+func (d Datastore) validate(caps []string) error {
+	if !d.IsURL() {
+		return nil
+	}
+	if err := requireCapability(caps, CapabilityURL, "url"); err != nil {
+		return err
+	}
+
+	scheme := strings.ToLower(string(d)[:strings.IndexByte(string(d), ':')])
+	supported := Capabilities(caps).Params(CapabilityURL)["scheme"]
+	if supported == "" {
+		return nil
+	}
+	for _, s := range strings.Split(supported, ",") {
+		if strings.ToLower(strings.TrimSpace(s)) == scheme {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: url scheme %s, server supports %s", ErrCapabilityNotSupported, scheme, supported)
+}
+
+// validateDatastores checks that the server supports each of ds.
+func validateDatastores(caps []string, ds ...Datastore) error {
+	for _, d := range ds {
+		if err := d.validate(caps); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// element returns the XML element used to refer to d as a source or target.
+func (d Datastore) element() string {
+	if d.IsURL() {
+		var buf bytes.Buffer
+		buf.WriteString("<url>")
+		xml.EscapeText(&buf, []byte(d))
+		buf.WriteString("</url>")
+		return buf.String()
+	}
+	return fmt.Sprintf("<%s/>", string(d))
+}
+
+// Get retrieves the running configuration and state data, restricted to the
+// given subtree filter unless it is empty, in which case the whole tree is
+// retrieved. A Filter can be given as option instead.
+func (s *Session) Get(filter string, opts ...GetOption) (*RPCReply, error) {
+	return s.Exec(newGet("", filter, opts))
+}
+
+// GetInto is like Get but decodes the data element of the reply into out, as
+// ExecInto does, so that the fields of out map its children:
+//
+//	var state struct {
+//		Interfaces []struct {
+//			Name     string `xml:"name"`
+//			InOctets uint64 `xml:"statistics>in-octets"`
+//		} `xml:"interfaces-state>interface"`
+//	}
+//	err := s.GetInto(&state, `<interfaces-state xmlns="urn:ietf:params:xml:ns:yang:ietf-interfaces"/>`)
+//
+// Fields are matched whatever the prefix of the elements in the reply.
+func (s *Session) GetInto(out interface{}, filter string, opts ...GetOption) error {
+	return s.ExecInto(out, newGet("", filter, opts))
+}
+
+// GetConfig retrieves the configuration held in source, restricted to the
+// given subtree filter unless it is empty. A Filter can be given as option
+// instead.
+func (s *Session) GetConfig(source Datastore, filter string, opts ...GetOption) (*RPCReply, error) {
+	return s.Exec(newGet(source, filter, opts))
+}
+
+// GetOption is an option of Get and GetConfig.
+type GetOption interface {
+	applyGet(*getOptions)
+}
+
+type getOptions struct {
+	filter       Filter
+	withDefaults WithDefaultsMode
+}
+
+// get is a get request, or a get-config one when source is set.
+type get struct {
+	source Datastore
+	filter string
+	opts   getOptions
+}
+
+func newGet(source Datastore, filter string, opts []GetOption) *get {
+	m := &get{source: source, filter: filter}
+	for _, opt := range opts {
+		opt.applyGet(&m.opts)
+	}
+	return m
+}
+
+// MarshalMethod converts the method's output into a string
+func (m *get) MarshalMethod() string {
+	var buf bytes.Buffer
+
+	name := "get"
+	if m.source != "" {
+		name = "get-config"
+	}
+	fmt.Fprintf(&buf, "<%s>", name)
+	if m.source != "" {
+		fmt.Fprintf(&buf, "<source>%s</source>", m.source.element())
+	}
+	if m.filter != "" {
+		buf.WriteString(subtreeFilterElement(m.filter))
+	} else if m.opts.filter != nil {
+		buf.WriteString(m.opts.filter.filterElement())
+	}
+	if m.opts.withDefaults != "" {
+		fmt.Fprintf(&buf, `<with-defaults xmlns="%s">%s</with-defaults>`, withDefaultsNamespace, m.opts.withDefaults)
+	}
+	fmt.Fprintf(&buf, "</%s>", name)
+
+	return buf.String()
+}
+
+func (m *get) validate(caps []string) error {
+	if m.filter != "" && m.opts.filter != nil {
+		return errors.New("netconf: both a subtree filter string and a Filter given")
+	}
+	if v, ok := m.opts.filter.(capabilityValidator); ok {
+		if err := v.validate(caps); err != nil {
+			return err
+		}
+	}
+	if m.opts.withDefaults != "" {
+		return m.opts.withDefaults.validate(caps)
+	}
+	return nil
+}
+
+// CopyConfig replaces the whole configuration held in target with the one
+// held in source. Either can be a URL on servers supporting the :url
+// capability with its scheme, and both can, e.g. to back up a configuration
+// file to a file server in one RPC. source and target must differ.
+func (s *Session) CopyConfig(source, target Datastore) error {
+	if source == target {
+		return fmt.Errorf("netconf: copy-config source and target are both %s", source)
+	}
+	if err := validateDatastores(s.ServerCapabilities, source, target); err != nil {
+		return err
+	}
+
+	_, err := s.Exec(RawMethod(fmt.Sprintf("<copy-config><target>%s</target><source>%s</source></copy-config>",
+		target.element(), source.element())))
+	return err
+}
+
+// ErrNoStartupDatastore is returned by SaveConfig and ClearStartup when the
+// server has no startup datastore.
+var ErrNoStartupDatastore = errors.New("netconf: no startup datastore")
+
+// SaveConfig copies the running configuration to the startup datastore so that
+// it is kept across reboots, on servers advertising the :startup capability.
+// Other servers have no startup datastore and SaveConfig returns
+// ErrNoStartupDatastore without sending anything: the running configuration
+// persists as is there, changes to it being made through the candidate
+// datastore and Commit when the server supports it.
+func (s *Session) SaveConfig() error {
+	if !hasCapability(s.ServerCapabilities, CapabilityStartup) {
+		return ErrNoStartupDatastore
+	}
+	return s.CopyConfig(Running, Startup)
+}
+
+// ClearStartup deletes the startup configuration, the one loaded at the next
+// boot, on servers advertising the :startup capability. What the device
+// boots with then is device specific, often its factory default
+// configuration. Other servers have no startup datastore and ClearStartup
+// returns ErrNoStartupDatastore without sending anything.
+func (s *Session) ClearStartup() error {
+	if !hasCapability(s.ServerCapabilities, CapabilityStartup) {
+		return ErrNoStartupDatastore
+	}
+	return s.DeleteConfig(Startup)
+}
+
+// ResetRunning replaces the whole running configuration with config, an
+// empty config clearing it, as a factory reset flow would. The result is
+// device dependent: most devices reject an empty configuration or keep
+// mandatory nodes, such as the management interface or users, so config is
+// usually the default configuration of the device. Servers whose running
+// datastore is only written through the candidate one reject it; edit the
+// candidate datastore with EditConfig and DefaultOperationReplace and Commit
+// instead.
+func (s *Session) ResetRunning(config string) error {
+	_, err := s.Exec(EditConfig(Running, config, EditConfigOptions{DefaultOperation: DefaultOperationReplace}))
+	return err
+}
+
+// DeleteConfig deletes the configuration held in target. The running
+// datastore can't be deleted.
+func (s *Session) DeleteConfig(target Datastore) error {
+	if target == Running {
+		return errors.New("netconf: the running datastore can't be deleted")
+	}
+	if err := target.validate(s.ServerCapabilities); err != nil {
+		return err
+	}
+
+	_, err := s.Exec(RawMethod(fmt.Sprintf("<delete-config><target>%s</target></delete-config>", target.element())))
+	return err
+}
+
+// Validate checks the configuration held in source, typically the candidate
+// datastore before a commit, for errors without applying it. It requires the
+// :validate capability. Validation failures are returned as an *RPCErrors
+// whose errors locate the offending nodes in their Path.
+func (s *Session) Validate(source Datastore) error {
+	if err := source.validate(s.ServerCapabilities); err != nil {
+		return err
+	}
+	return s.validateSource(source.element())
+}
+
+// ValidateConfig is like Validate for the configuration config, given inline.
+func (s *Session) ValidateConfig(config string) error {
+	return s.validateSource(fmt.Sprintf("<config>%s</config>", config))
+}
+
+func (s *Session) validateSource(source string) error {
+	if !hasCapability(s.ServerCapabilities, CapabilityValidate11) {
+		if err := requireCapability(s.ServerCapabilities, CapabilityValidate, "validate"); err != nil {
+			return err
+		}
+	}
+
+	_, err := s.Exec(RawMethod(fmt.Sprintf("<validate><source>%s</source></validate>", source)))
+	return err
+}
+
+// Lock locks target, preventing other sessions from modifying it until it is
+// unlocked or this session ends.
+func (s *Session) Lock(target Datastore) error {
+	_, err := s.Exec(RawMethod(fmt.Sprintf("<lock><target>%s</target></lock>", target.element())))
+	return err
+}
+
+// LockWithRetry locks target like Lock, trying again while it fails with
+// lock-denied because another session holds the lock, up to attempts times in
+// total. It waits backoff before the first retry, doubling the wait before
+// each following one. Any other error is returned at once. When all attempts
+// are denied the last error is returned, and LockHolder gives the session
+// holding the lock.
+func (s *Session) LockWithRetry(target Datastore, attempts int, backoff time.Duration) error {
+	for attempt := 1; ; attempt++ {
+		err := s.Lock(target)
+		if err == nil || attempt >= attempts || !errors.Is(err, errLockDenied) {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// errLockDenied matches the rpc-errors reporting a lock held by another
+// session.
+var errLockDenied = &RPCError{Tag: "lock-denied"}
+
+// LockHolder returns the session-id of the session holding the lock when err
+// holds a lock-denied rpc-error, as returned by Lock and LockWithRetry. ok is
+// false when err isn't lock-denied or the lock isn't held by a NETCONF
+// session.
+func LockHolder(err error) (sessionID int, ok bool) {
+	var rpcErrs *RPCErrors
+	if !errors.As(err, &rpcErrs) {
+		return 0, false
+	}
+	for _, re := range rpcErrs.Errors() {
+		if re.Tag == errLockDenied.Tag && re.ErrorInfo.SessionID != 0 {
+			return re.ErrorInfo.SessionID, true
+		}
+	}
+	return 0, false
+}
+
+// Unlock releases a lock on target held by this session.
+func (s *Session) Unlock(target Datastore) error {
+	_, err := s.Exec(RawMethod(fmt.Sprintf("<unlock><target>%s</target></unlock>", target.element())))
+	return err
+}
+
+// WithLock locks target, runs fn and unlocks target, even when fn panics. The
+// errors of fn and Unlock are both returned.
+func (s *Session) WithLock(target Datastore, fn func() error) (err error) {
+	if err := s.Lock(target); err != nil {
+		return err
+	}
+	defer func() {
+		err = joinErrors(err, s.Unlock(target))
+	}()
+
+	return fn()
+}
@@ -0,0 +1,392 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDatastoreElement(t *testing.T) {
+	tt := []struct {
+		ds       Datastore
+		expected string
+	}{
+		{Running, "<running/>"},
+		{Candidate, "<candidate/>"},
+		{URL("ftp://example.com/a&b.xml"), "<url>ftp://example.com/a&amp;b.xml</url>"},
+	}
+
+	for _, tc := range tt {
+		if got := tc.ds.element(); got != tc.expected {
+			t.Errorf("got %s, expected %s", got, tc.expected)
+		}
+	}
+}
+
+func TestDatastoreOperations(t *testing.T) {
+	caps := append([]string{CapabilityURL + "?scheme=file,ftp"}, DefaultCapabilities...)
+	requests := make(chan string, 1)
+	s := newSessionTest(t, caps, serveRequests(requests, "<ok/>"))
+	defer s.Close()
+
+	tt := []struct {
+		name     string
+		op       func() error
+		expected string
+	}{
+		{
+			name: "get-config",
+			op: func() error {
+				_, err := s.GetConfig(Running, "<interfaces/>")
+				return err
+			},
+			expected: `<get-config><source><running/></source><filter type="subtree"><interfaces/></filter></get-config>`,
+		},
+		{
+			name: "get",
+			op: func() error {
+				_, err := s.Get("")
+				return err
+			},
+			expected: `<get></get>`,
+		},
+		{
+			name:     "copy-config",
+			op:       func() error { return s.CopyConfig(Running, URL("file:///backup.xml")) },
+			expected: `<copy-config><target><url>file:///backup.xml</url></target><source><running/></source></copy-config>`,
+		},
+		{
+			name:     "copy-config between urls",
+			op:       func() error { return s.CopyConfig(URL("file:///config.xml"), URL("ftp://example.com/backup.xml")) },
+			expected: `<copy-config><target><url>ftp://example.com/backup.xml</url></target><source><url>file:///config.xml</url></source></copy-config>`,
+		},
+		{
+			name:     "delete-config",
+			op:       func() error { return s.DeleteConfig(Startup) },
+			expected: `<delete-config><target><startup/></target></delete-config>`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.op(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := requestBody(<-requests); got != tc.expected {
+				t.Errorf("got %s, expected %s", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestDatastoreURLCapability(t *testing.T) {
+	tt := []struct {
+		name string
+		caps []string
+		ds   Datastore
+		ok   bool
+	}{
+		{name: "datastore", ds: Running, ok: true},
+		{name: "no capability", ds: URL("file:///backup.xml")},
+		{name: "scheme", caps: []string{CapabilityURL + "?scheme=http,FTP"}, ds: URL("ftp://example.com/backup.xml"), ok: true},
+		{name: "unsupported scheme", caps: []string{CapabilityURL + "?scheme=http,ftp"}, ds: URL("file:///backup.xml")},
+		{name: "schemes not listed", caps: []string{CapabilityURL}, ds: URL("sftp://example.com/backup.xml"), ok: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.ds.validate(tc.caps)
+			if tc.ok && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !tc.ok && !errors.Is(err, ErrCapabilityNotSupported) {
+				t.Errorf("expected ErrCapabilityNotSupported, got %v", err)
+			}
+
+			// Operations are rejected before anything is sent.
+			if !tc.ok {
+				s := &Session{ServerCapabilities: append([]string{CapabilityBase10}, tc.caps...)}
+				if err := s.CopyConfig(tc.ds, Candidate); !errors.Is(err, ErrCapabilityNotSupported) {
+					t.Errorf("expected copy-config to fail with ErrCapabilityNotSupported, got %v", err)
+				}
+				if err := s.CopyConfig(URL("http://example.com/config.xml"), tc.ds); !errors.Is(err, ErrCapabilityNotSupported) {
+					t.Errorf("expected copy-config to a url to fail with ErrCapabilityNotSupported, got %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestCopyConfigSameDatastore(t *testing.T) {
+	s := &Session{ServerCapabilities: []string{CapabilityBase10, CapabilityURL}}
+	for _, ds := range []Datastore{Running, URL("file:///backup.xml")} {
+		if err := s.CopyConfig(ds, ds); err == nil {
+			t.Errorf("expected an error copying %s to itself", ds)
+		}
+	}
+}
+
+func TestGetInto(t *testing.T) {
+	requests := make(chan string, 1)
+	s := newSessionTest(t, DefaultCapabilities, func(st *TransportBasicIO) {
+		for {
+			req, err := st.Receive()
+			if err != nil {
+				return
+			}
+			select {
+			case requests <- string(req):
+			default:
+			}
+			// Reply with prefixed elements, as some servers do.
+			reply := `<nc:rpc-reply xmlns:nc="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="` + replyMessageID(req) + `"><nc:data>` +
+				`<if:interfaces-state xmlns:if="urn:ietf:params:xml:ns:yang:ietf-interfaces"><if:interface><if:name>eth0</if:name><if:statistics><if:in-octets>42</if:in-octets></if:statistics></if:interface></if:interfaces-state>` +
+				`</nc:data></nc:rpc-reply>`
+			if err := st.Send([]byte(reply)); err != nil {
+				return
+			}
+		}
+	})
+	defer s.Close()
+
+	var state struct {
+		Interfaces []struct {
+			Name     string `xml:"name"`
+			InOctets uint64 `xml:"statistics>in-octets"`
+		} `xml:"urn:ietf:params:xml:ns:yang:ietf-interfaces interfaces-state>interface"`
+	}
+	if err := s.GetInto(&state, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := requestBody(<-requests); got != "<get></get>" {
+		t.Errorf("unexpected request %s", got)
+	}
+	if len(state.Interfaces) != 1 || state.Interfaces[0].Name != "eth0" || state.Interfaces[0].InOctets != 42 {
+		t.Errorf("unexpected state %+v", state)
+	}
+}
+
+func TestDeleteRunning(t *testing.T) {
+	s := &Session{}
+	if err := s.DeleteConfig(Running); err == nil {
+		t.Errorf("expected deleting running to fail")
+	}
+}
+
+func TestDatastoreOperationError(t *testing.T) {
+	requests := make(chan string, 1)
+	s := newSessionTest(t, DefaultCapabilities, serveRequests(requests, `<rpc-error><error-type>protocol</error-type><error-tag>lock-denied</error-tag><error-severity>error</error-severity><error-message>locked</error-message></rpc-error>`))
+	defer s.Close()
+
+	err := s.CopyConfig(Candidate, Running)
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Tag != "lock-denied" {
+		t.Errorf("expected a lock-denied rpc error, got %v", err)
+	}
+}
+
+func TestWithLock(t *testing.T) {
+	errFn := errors.New("fn failed")
+	unlockErr := `<rpc-error><error-type>protocol</error-type><error-tag>operation-failed</error-tag><error-severity>error</error-severity></rpc-error>`
+
+	requests := make(chan string, 10)
+	s := newSessionTest(t, DefaultCapabilities, func(st *TransportBasicIO) {
+		for {
+			req, err := st.Receive()
+			if err != nil {
+				return
+			}
+			requests <- requestBody(string(req))
+			content := "<ok/>"
+			if strings.HasPrefix(requestBody(string(req)), "<unlock>") {
+				content = unlockErr
+			}
+			replyTo(st, req, content)
+		}
+	})
+	defer s.Close()
+
+	err := s.WithLock(Candidate, func() error { return errFn })
+	if !errors.Is(err, errFn) || !errors.Is(err, &RPCError{Tag: "operation-failed"}) {
+		t.Errorf("expected both errors, got %v", err)
+	}
+	for _, expected := range []string{"<lock><target><candidate/></target></lock>", "<unlock><target><candidate/></target></unlock>"} {
+		if got := <-requests; got != expected {
+			t.Errorf("got %s, expected %s", got, expected)
+		}
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected the panic to propagate")
+			}
+		}()
+		s.WithLock(Running, func() error { panic("fn panicked") })
+	}()
+	for _, expected := range []string{"<lock><target><running/></target></lock>", "<unlock><target><running/></target></unlock>"} {
+		if got := <-requests; got != expected {
+			t.Errorf("got %s, expected %s", got, expected)
+		}
+	}
+}
+
+func TestLockWithRetry(t *testing.T) {
+	lockDenied := `<rpc-error><error-type>protocol</error-type><error-tag>lock-denied</error-tag><error-severity>error</error-severity><error-info><session-id>42</session-id></error-info></rpc-error>`
+	inUse := `<rpc-error><error-type>protocol</error-type><error-tag>in-use</error-tag><error-severity>error</error-severity></rpc-error>`
+
+	tt := []struct {
+		name     string
+		replies  []string
+		attempts int
+		sent     int
+		holder   int
+		err      *RPCError
+	}{
+		{"locked at once", []string{"<ok/>"}, 3, 1, 0, nil},
+		{"locked after retries", []string{lockDenied, lockDenied, "<ok/>"}, 3, 3, 0, nil},
+		{"still denied", []string{lockDenied, lockDenied, lockDenied}, 2, 2, 42, errLockDenied},
+		{"other error", []string{inUse, "<ok/>"}, 3, 1, 0, &RPCError{Tag: "in-use"}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			requests := make(chan string, len(tc.replies))
+			s := newSessionTest(t, DefaultCapabilities, func(st *TransportBasicIO) {
+				for _, content := range tc.replies {
+					req, err := st.Receive()
+					if err != nil {
+						return
+					}
+					requests <- requestBody(string(req))
+					replyTo(st, req, content)
+				}
+				st.Receive()
+			})
+			defer s.Close()
+
+			err := s.LockWithRetry(Candidate, tc.attempts, time.Millisecond)
+			if tc.err == nil && err != nil || tc.err != nil && !errors.Is(err, tc.err) {
+				t.Errorf("unexpected error %v", err)
+			}
+			if len(requests) != tc.sent {
+				t.Errorf("expected %d lock requests, got %d", tc.sent, len(requests))
+			}
+			if holder, ok := LockHolder(err); holder != tc.holder || ok != (tc.holder != 0) {
+				t.Errorf("unexpected lock holder %d, %v", holder, ok)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	caps := append([]string{CapabilityValidate11}, DefaultCapabilities...)
+	requests := make(chan string, 1)
+	s := newSessionTest(t, caps, serveRequests(requests, "<ok/>"))
+	defer s.Close()
+
+	if err := s.Validate(Candidate); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := requestBody(<-requests), "<validate><source><candidate/></source></validate>"; got != want {
+		t.Errorf("got %s, expected %s", got, want)
+	}
+	if err := s.ValidateConfig("<system><host-name>r1</host-name></system>"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := requestBody(<-requests), "<validate><source><config><system><host-name>r1</host-name></system></config></source></validate>"; got != want {
+		t.Errorf("got %s, expected %s", got, want)
+	}
+
+	s = newSessionTest(t, DefaultCapabilities, nil)
+	defer s.ForceClose()
+	if err := s.Validate(Candidate); !errors.Is(err, ErrCapabilityNotSupported) {
+		t.Errorf("expected ErrCapabilityNotSupported, got %v", err)
+	}
+}
+
+func TestValidateError(t *testing.T) {
+	caps := append([]string{CapabilityValidate}, DefaultCapabilities...)
+	s := newSessionTest(t, caps, serveRequests(make(chan string), `<rpc-error><error-type>application</error-type><error-tag>invalid-value</error-tag><error-severity>error</error-severity><error-path>/system/host-name</error-path><error-message>invalid host name</error-message></rpc-error>`))
+	defer s.Close()
+
+	err := s.Validate(Candidate)
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Path != "/system/host-name" {
+		t.Errorf("expected an error at /system/host-name, got %v", err)
+	}
+}
+
+func TestClearStartup(t *testing.T) {
+	caps := append([]string{CapabilityStartup}, DefaultCapabilities...)
+	requests := make(chan string, 1)
+	s := newSessionTest(t, caps, serveRequests(requests, "<ok/>"))
+	defer s.Close()
+
+	if err := s.ClearStartup(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := requestBody(<-requests), "<delete-config><target><startup/></target></delete-config>"; got != want {
+		t.Errorf("got %s, expected %s", got, want)
+	}
+
+	s = newSessionTest(t, DefaultCapabilities, serveRequests(requests, "<ok/>"))
+	defer s.Close()
+
+	if err := s.ClearStartup(); err != ErrNoStartupDatastore {
+		t.Errorf("expected ErrNoStartupDatastore, got %v", err)
+	}
+	select {
+	case req := <-requests:
+		t.Errorf("unexpected request %s", req)
+	default:
+	}
+}
+
+func TestResetRunning(t *testing.T) {
+	requests := make(chan string, 1)
+	s := newSessionTest(t, DefaultCapabilities, serveRequests(requests, "<ok/>"))
+	defer s.Close()
+
+	if err := s.ResetRunning(""); err != nil {
+		t.Fatal(err)
+	}
+	want := "<edit-config><target><running/></target><default-operation>replace</default-operation><config></config></edit-config>"
+	if got := requestBody(<-requests); got != want {
+		t.Errorf("got %s, expected %s", got, want)
+	}
+}
+
+func TestSaveConfig(t *testing.T) {
+	caps := append([]string{CapabilityStartup}, DefaultCapabilities...)
+	requests := make(chan string, 1)
+	s := newSessionTest(t, caps, serveRequests(requests, "<ok/>"))
+	defer s.Close()
+
+	if err := s.SaveConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := requestBody(<-requests), "<copy-config><target><startup/></target><source><running/></source></copy-config>"; got != want {
+		t.Errorf("got %s, expected %s", got, want)
+	}
+
+	caps = append([]string{CapabilityCandidate}, DefaultCapabilities...)
+	s = newSessionTest(t, caps, serveRequests(requests, "<ok/>"))
+	defer s.Close()
+
+	if err := s.SaveConfig(); err != ErrNoStartupDatastore {
+		t.Errorf("expected ErrNoStartupDatastore, got %v", err)
+	}
+	select {
+	case req := <-requests:
+		t.Errorf("unexpected request %s", req)
+	default:
+	}
+}
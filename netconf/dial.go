@@ -0,0 +1,70 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Dial creates a new NETCONF session to target, a URL such as
+// "ssh://host:830" or "tls://host:6513", for tools storing connection URLs in
+// their configuration. Without a scheme, target is a host, with an optional
+// port, reached over SSH unless the port is the NETCONF over TLS one, 6513.
+// Without a port, the default one of the scheme is used.
+//
+// SSH requires WithSSHConfig and TLS WithTLSConfig. WithHostKeyCallback,
+// WithSubsystem, WithCommand, WithPTY and WithKeepalive only apply to SSH, as
+// with DialSSH; the other options, such as WithDialer, WithLogger or
+// WithHelloTimeout, apply to both transports.
+func Dial(target string, opts ...Option) (*Session, error) {
+	scheme, addr, err := dialTarget(target)
+	if err != nil {
+		return nil, err
+	}
+
+	o := newOptions(opts)
+	switch scheme {
+	case "tls":
+		if o.tlsConfig == nil {
+			return nil, errors.New("netconf: dialing over tls requires WithTLSConfig")
+		}
+		return dialTLS(addr, o.tlsConfig, o)
+	default:
+		if o.sshConfig == nil {
+			return nil, errors.New("netconf: dialing over ssh requires WithSSHConfig")
+		}
+		return DialSSH(addr, o.sshConfig, opts...)
+	}
+}
+
+// dialTarget returns the scheme of target and the address to dial, with the
+// default port of the scheme if it has none.
+func dialTarget(target string) (scheme, addr string, err error) {
+	scheme, addr = "ssh", target
+	if strings.Contains(target, "://") {
+		u, err := url.Parse(target)
+		if err != nil {
+			return "", "", fmt.Errorf("netconf: invalid target %q: %w", target, err)
+		}
+		scheme, addr = u.Scheme, u.Host
+	} else if _, port, err := net.SplitHostPort(target); err == nil && port == strconv.Itoa(tlsDefaultPort) {
+		scheme = "tls"
+	}
+
+	switch scheme {
+	case "ssh":
+		return scheme, sshTarget(addr), nil
+	case "tls":
+		return scheme, withDefaultPort(addr, tlsDefaultPort), nil
+	}
+	return "", "", fmt.Errorf("netconf: unsupported scheme %q in target %q, supported schemes are ssh and tls", scheme, target)
+}
@@ -0,0 +1,87 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDialTarget(t *testing.T) {
+	tt := []struct {
+		name   string
+		target string
+		scheme string
+		addr   string
+		err    string
+	}{
+		{name: "host", target: "router1", scheme: "ssh", addr: "router1:830"},
+		{name: "port", target: "router1:2022", scheme: "ssh", addr: "router1:2022"},
+		{name: "tls port", target: "router1:6513", scheme: "tls", addr: "router1:6513"},
+		{name: "ssh", target: "ssh://router1", scheme: "ssh", addr: "router1:830"},
+		{name: "ssh port", target: "ssh://admin@router1:22", scheme: "ssh", addr: "router1:22"},
+		{name: "tls", target: "tls://router1", scheme: "tls", addr: "router1:6513"},
+		{name: "tls uppercase", target: "TLS://router1:7000", scheme: "tls", addr: "router1:7000"},
+		{name: "ipv6", target: "2001:db8::1", scheme: "ssh", addr: "[2001:db8::1]:830"},
+		{name: "ipv6 brackets", target: "[2001:db8::1]", scheme: "ssh", addr: "[2001:db8::1]:830"},
+		{name: "ipv6 port", target: "[2001:db8::1]:2022", scheme: "ssh", addr: "[2001:db8::1]:2022"},
+		{name: "ipv6 tls port", target: "[2001:db8::1]:6513", scheme: "tls", addr: "[2001:db8::1]:6513"},
+		{name: "ipv6 zone", target: "fe80::1%eth0", scheme: "ssh", addr: "[fe80::1%eth0]:830"},
+		{name: "ssh ipv6", target: "ssh://[2001:db8::1]", scheme: "ssh", addr: "[2001:db8::1]:830"},
+		{name: "tls ipv6 port", target: "tls://[2001:db8::1]:7000", scheme: "tls", addr: "[2001:db8::1]:7000"},
+		{name: "unknown", target: "http://router1", err: `unsupported scheme "http" in target "http://router1", supported schemes are ssh and tls`},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			scheme, addr, err := dialTarget(tc.target)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if scheme != tc.scheme || addr != tc.addr {
+				t.Errorf("expected %s %s, got %s %s", tc.scheme, tc.addr, scheme, addr)
+			}
+		})
+	}
+}
+
+func TestWithDefaultPort(t *testing.T) {
+	tt := []struct {
+		target   string
+		expected string
+	}{
+		{"router1", "router1:830"},
+		{"router1:22", "router1:22"},
+		{"172.16.1.1", "172.16.1.1:830"},
+		{"172.16.1.1:22", "172.16.1.1:22"},
+		{"2001:db8::1", "[2001:db8::1]:830"},
+		{"[2001:db8::1]", "[2001:db8::1]:830"},
+		{"[2001:db8::1]:22", "[2001:db8::1]:22"},
+		{"::1", "[::1]:830"},
+		{"", ":830"},
+	}
+
+	for _, tc := range tt {
+		if addr := withDefaultPort(tc.target, sshDefaultPort); addr != tc.expected {
+			t.Errorf("%q: expected %s, got %s", tc.target, tc.expected, addr)
+		}
+	}
+}
+
+func TestDialWithoutConfig(t *testing.T) {
+	for _, target := range []string{"ssh://router1", "tls://router1"} {
+		if _, err := Dial(target); err == nil || !strings.Contains(err.Error(), "requires With") {
+			t.Errorf("%s: expected a missing configuration error, got %v", target, err)
+		}
+	}
+}
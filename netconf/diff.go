@@ -0,0 +1,305 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"sort"
+	"strings"
+)
+
+// CandidateDiff retrieves the candidate and running configurations and returns
+// the changes the candidate one would make once committed, as DiffXML does,
+// to preview them before Commit. It returns nil when both are the same.
+func (s *Session) CandidateDiff() ([]byte, error) {
+	if err := requireCapability(s.ServerCapabilities, CapabilityCandidate, "candidate diff"); err != nil {
+		return nil, err
+	}
+
+	running, err := s.GetConfig(Running, "")
+	if err != nil {
+		return nil, err
+	}
+	candidate, err := s.GetConfig(Candidate, "")
+	if err != nil {
+		return nil, err
+	}
+	return DiffXML(running.Payload(), candidate.Payload())
+}
+
+// DiffXML compares the XML documents, or sequences of elements, a and b and
+// returns the lines of b, indented as by IndentXML, that differ from a: those
+// added prefixed with "+ ", those removed prefixed with "- ", and the start
+// and end tags of their unchanged parents prefixed with "  " to locate them.
+// A changed element shows as removed then added. It returns nil when a and b
+// are the same.
+//
+// The elements are compared by namespace rather than prefix: both are
+// written with default namespace declarations, so that documents differing
+// only in the prefixes they use are the same. Whitespace around text and the
+// order of attributes are ignored, comments and processing instructions are
+// dropped. The comparison is textual, the order of elements matters.
+func DiffXML(a, b []byte) ([]byte, error) {
+	al, err := canonicalLines(a)
+	if err != nil {
+		return nil, err
+	}
+	bl, err := canonicalLines(b)
+	if err != nil {
+		return nil, err
+	}
+
+	ops := diffLines(al, bl)
+	var out bytes.Buffer
+	// parents holds the unchanged start tags enclosing the current line by
+	// depth, written once a change is found inside them.
+	var parents []*diffParent
+	changed := false
+	for _, op := range ops {
+		l := op.line
+		switch {
+		case op.kind == ' ' && l.kind == lineStart:
+			parents = append(parents[:minInt(l.depth, len(parents))], &diffParent{line: l})
+		case op.kind == ' ' && l.kind == lineEnd:
+			if l.depth < len(parents) {
+				if parents[l.depth].written {
+					writeDiffLine(&out, ' ', l.text)
+				}
+				parents = parents[:l.depth]
+			}
+		case op.kind != ' ':
+			changed = true
+			for i := 0; i < l.depth && i < len(parents); i++ {
+				if !parents[i].written {
+					writeDiffLine(&out, ' ', parents[i].line.text)
+					parents[i].written = true
+				}
+			}
+			writeDiffLine(&out, op.kind, l.text)
+		}
+	}
+	if !changed {
+		return nil, nil
+	}
+	return out.Bytes(), nil
+}
+
+// diffParent is an unchanged start tag enclosing changes.
+type diffParent struct {
+	line    xmlLine
+	written bool
+}
+
+func writeDiffLine(out *bytes.Buffer, kind byte, text string) {
+	out.WriteByte(kind)
+	out.WriteByte(' ')
+	out.WriteString(text)
+	out.WriteByte('\n')
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Kinds of xmlLine.
+const (
+	lineLeaf = iota
+	lineStart
+	lineEnd
+)
+
+// xmlLine is a line of a document written by canonicalLines.
+type xmlLine struct {
+	text  string
+	kind  int
+	depth int
+}
+
+// xmlNode is an element of a document read by canonicalLines.
+type xmlNode struct {
+	name     xml.Name
+	attrs    []xml.Attr
+	text     string
+	children []*xmlNode
+}
+
+// canonicalLines returns the elements of b one per line, indented, with their
+// namespaces declared as default namespaces where they change.
+func canonicalLines(b []byte) ([]xmlLine, error) {
+	d := xml.NewDecoder(bytes.NewReader(b))
+	root := &xmlNode{}
+	stack := []*xmlNode{root}
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		parent := stack[len(stack)-1]
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{name: tok.Name}
+			for _, attr := range tok.Attr {
+				if attr.Name.Space != "xmlns" && !(attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+					n.attrs = append(n.attrs, attr)
+				}
+			}
+			sort.Slice(n.attrs, func(i, j int) bool {
+				if n.attrs[i].Name.Space != n.attrs[j].Name.Space {
+					return n.attrs[i].Name.Space < n.attrs[j].Name.Space
+				}
+				return n.attrs[i].Name.Local < n.attrs[j].Name.Local
+			})
+			parent.children = append(parent.children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if text := strings.TrimSpace(string(tok)); text != "" {
+				parent.text += text
+			}
+		}
+	}
+
+	var lines []xmlLine
+	for _, n := range root.children {
+		lines = appendNodeLines(lines, n, "", 0)
+	}
+	return lines, nil
+}
+
+// appendNodeLines appends the lines of n, whose parent has namespace space,
+// to lines.
+func appendNodeLines(lines []xmlLine, n *xmlNode, space string, depth int) []xmlLine {
+	var buf bytes.Buffer
+	indent := strings.Repeat(indentUnit, depth)
+	buf.WriteString(indent + "<" + n.name.Local)
+	if n.name.Space != space {
+		buf.WriteString(` xmlns="`)
+		escapeXML(&buf, n.name.Space, true)
+		buf.WriteString(`"`)
+	}
+	for _, attr := range n.attrs {
+		buf.WriteString(" ")
+		if attr.Name.Space != "" {
+			buf.WriteString("{" + attr.Name.Space + "}")
+		}
+		buf.WriteString(attr.Name.Local + `="`)
+		escapeXML(&buf, attr.Value, true)
+		buf.WriteString(`"`)
+	}
+
+	switch {
+	case len(n.children) == 0 && n.text == "":
+		buf.WriteString("/>")
+		return append(lines, xmlLine{text: buf.String(), kind: lineLeaf, depth: depth})
+	case len(n.children) == 0:
+		buf.WriteString(">")
+		escapeXML(&buf, n.text, false)
+		buf.WriteString("</" + n.name.Local + ">")
+		return append(lines, xmlLine{text: buf.String(), kind: lineLeaf, depth: depth})
+	}
+
+	buf.WriteString(">")
+	lines = append(lines, xmlLine{text: buf.String(), kind: lineStart, depth: depth})
+	if n.text != "" {
+		buf.Reset()
+		buf.WriteString(indent + indentUnit)
+		escapeXML(&buf, n.text, false)
+		lines = append(lines, xmlLine{text: buf.String(), kind: lineLeaf, depth: depth + 1})
+	}
+	for _, c := range n.children {
+		lines = appendNodeLines(lines, c, n.name.Space, depth+1)
+	}
+	return append(lines, xmlLine{text: indent + "</" + n.name.Local + ">", kind: lineEnd, depth: depth})
+}
+
+// diffOp is a line kept (' '), removed ('-') or added ('+') by diffLines.
+type diffOp struct {
+	kind byte
+	line xmlLine
+}
+
+// diffLines returns the shortest edit script turning a into b, using the
+// algorithm of Myers, "An O(ND) Difference Algorithm and Its Variations".
+func diffLines(a, b []xmlLine) []diffOp {
+	n, m := len(a), len(b)
+	maxD := n + m
+	offset := maxD + 1
+	v := make([]int, 2*maxD+3)
+	// trace holds v[-d:d+1] as it was before each step d, to walk back the
+	// path found.
+	var trace [][]int
+
+	done := false
+	for d := 0; d <= maxD && !done; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x].text == b[y].text {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				done = true
+				break
+			}
+		}
+	}
+
+	var ops []diffOp
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && prev[k-1+d] < prev[k+1+d]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := prev[prevK+d]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, diffOp{' ', a[x]})
+		}
+		if x == prevX {
+			y--
+			ops = append(ops, diffOp{'+', b[y]})
+		} else {
+			x--
+			ops = append(ops, diffOp{'-', a[x]})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		ops = append(ops, diffOp{' ', a[x]})
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
@@ -0,0 +1,134 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDiffXML(t *testing.T) {
+	tt := []struct {
+		name     string
+		a, b     string
+		expected string
+	}{
+		{
+			name: "same",
+			a:    `<system xmlns="urn:sys"><host-name>r1</host-name></system>`,
+			b:    `<system xmlns="urn:sys"><host-name>r1</host-name></system>`,
+		},
+		{
+			name: "prefixes and whitespace",
+			a:    `<system xmlns="urn:sys"><host-name>r1</host-name><ntp a="1" b="2"/></system>`,
+			b: `<s:system xmlns:s="urn:sys">
+	<s:host-name> r1 </s:host-name>
+	<s:ntp b="2" a="1"></s:ntp>
+</s:system>`,
+		},
+		{
+			name: "changed leaf",
+			a:    `<system xmlns="urn:sys"><host-name>r1</host-name><domain>lab</domain></system>`,
+			b:    `<system xmlns="urn:sys"><host-name>r2</host-name><domain>lab</domain></system>`,
+			expected: `  <system xmlns="urn:sys">
+-   <host-name>r1</host-name>
++   <host-name>r2</host-name>
+  </system>
+`,
+		},
+		{
+			name: "added and removed elements",
+			a: `<interfaces xmlns="urn:if">
+	<interface><name>eth0</name><mtu>1500</mtu></interface>
+	<interface><name>eth1</name></interface>
+</interfaces>
+<system xmlns="urn:sys"><host-name>r1</host-name></system>`,
+			b: `<interfaces xmlns="urn:if">
+	<interface><name>eth0</name><mtu>1500</mtu><enabled/></interface>
+</interfaces>
+<system xmlns="urn:sys"><host-name>r1</host-name></system>`,
+			expected: `  <interfaces xmlns="urn:if">
+    <interface>
++     <enabled/>
+    </interface>
+-   <interface>
+-     <name>eth1</name>
+-   </interface>
+  </interfaces>
+`,
+		},
+		{
+			name: "changed namespace",
+			a:    `<a:system xmlns:a="urn:sys"><a:host-name>r1</a:host-name></a:system>`,
+			b:    `<a:system xmlns:a="urn:sys"><host-name xmlns="urn:other">r1</host-name></a:system>`,
+			expected: `  <system xmlns="urn:sys">
+-   <host-name>r1</host-name>
++   <host-name xmlns="urn:other">r1</host-name>
+  </system>
+`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			diff, err := DiffXML([]byte(tc.a), []byte(tc.b))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(diff) != tc.expected {
+				t.Errorf("got:\n%s\nexpected:\n%s", diff, tc.expected)
+			}
+		})
+	}
+
+	if _, err := DiffXML([]byte("<a>"), nil); err == nil {
+		t.Error("expected an error for a malformed document")
+	}
+}
+
+func TestCandidateDiff(t *testing.T) {
+	configs := map[string]string{
+		"<running/>":   `<data><system xmlns="urn:sys"><host-name>r1</host-name></system></data>`,
+		"<candidate/>": `<data><s:system xmlns:s="urn:sys"><s:host-name>r2</s:host-name></s:system></data>`,
+	}
+	s := newSessionTest(t, append([]string{CapabilityCandidate}, DefaultCapabilities...), func(st *TransportBasicIO) {
+		for {
+			req, err := st.Receive()
+			if err != nil {
+				return
+			}
+			content := "<ok/>"
+			for source, config := range configs {
+				if strings.Contains(requestBody(string(req)), source) {
+					content = config
+				}
+			}
+			replyTo(st, req, content)
+		}
+	})
+	defer s.Close()
+
+	diff, err := s.CandidateDiff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `  <system xmlns="urn:sys">
+-   <host-name>r1</host-name>
++   <host-name>r2</host-name>
+  </system>
+`
+	if string(diff) != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", diff, expected)
+	}
+
+	s = newSessionTest(t, DefaultCapabilities, serveRequests(make(chan string, 1), "<ok/>"))
+	defer s.Close()
+	if _, err := s.CandidateDiff(); !errors.Is(err, ErrCapabilityNotSupported) {
+		t.Errorf("expected ErrCapabilityNotSupported, got %v", err)
+	}
+}
@@ -0,0 +1,281 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ErrorElement returns the element of sentConfig the error-path of re points
+// to, as it was sent, to show what the server rejected, e.g. in an
+// edit-config. sentConfig is the content of the config element sent, or the
+// whole rpc: the leading steps of the path naming the rpc and its parameters,
+// such as /rpc/edit-config/config, are skipped when they aren't found in it.
+//
+// The lookup is a best effort, supporting the paths servers commonly report:
+// child steps, possibly "*", with predicates on the value of a child
+// ([name='eth0']), of an attribute ([@id='1']) or of the element itself
+// ([.='a']), or on a position ([2]). Prefixes are ignored, elements being
+// matched by local name. The element returned doesn't carry the namespace
+// declarations it inherits.
+func (re *RPCError) ErrorElement(sentConfig []byte) ([]byte, error) {
+	path := strings.TrimSpace(re.Path)
+	if path == "" {
+		return nil, errors.New("netconf: rpc-error without error-path")
+	}
+	steps, err := parseErrorPath(path)
+	if err != nil {
+		return nil, err
+	}
+	root, err := parsePathTree(sentConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range steps {
+		if n := root.find(steps[i:]); n != nil {
+			return sentConfig[n.start:n.end], nil
+		}
+	}
+	return nil, fmt.Errorf("netconf: error-path %s not found in the configuration", path)
+}
+
+// pathStep is a step of an error-path.
+type pathStep struct {
+	name       string
+	predicates []pathPredicate
+}
+
+// pathPredicate is a predicate of a step, matching either the element at
+// position, when non-zero, or the elements whose child name, or attribute
+// when attr is set, or value when name is ".", equals value.
+type pathPredicate struct {
+	position int
+	name     string
+	attr     bool
+	value    string
+}
+
+// parseErrorPath splits path into its steps.
+func parseErrorPath(path string) ([]pathStep, error) {
+	var steps []pathStep
+	var quote rune
+	depth, start := 0, 0
+	for i, r := range path + "/" {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '[':
+			depth++
+		case r == ']':
+			depth--
+		case r == '/' && depth == 0:
+			if s := strings.TrimSpace(path[start:i]); s != "" {
+				step, err := parsePathStep(s)
+				if err != nil {
+					return nil, fmt.Errorf("netconf: invalid error-path %s: %w", path, err)
+				}
+				steps = append(steps, step)
+			}
+			start = i + 1
+		}
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("netconf: invalid error-path %s", path)
+	}
+	return steps, nil
+}
+
+// parsePathStep parses a step such as if:interface[if:name='eth0'].
+func parsePathStep(s string) (pathStep, error) {
+	i := strings.IndexByte(s, '[')
+	if i < 0 {
+		i = len(s)
+	}
+	step := pathStep{name: localPathName(s[:i])}
+
+	rest := s[i:]
+	for rest != "" {
+		end := predicateEnd(rest)
+		if rest[0] != '[' || end < 0 {
+			return step, fmt.Errorf("malformed predicate %s", rest)
+		}
+		p, err := parsePathPredicate(strings.TrimSpace(rest[1:end]))
+		if err != nil {
+			return step, err
+		}
+		step.predicates = append(step.predicates, p)
+		rest = strings.TrimSpace(rest[end+1:])
+	}
+	return step, nil
+}
+
+// predicateEnd returns the index of the bracket closing the predicate s
+// starts with, -1 if there is none.
+func predicateEnd(s string) int {
+	var quote rune
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == ']':
+			return i
+		}
+	}
+	return -1
+}
+
+func parsePathPredicate(s string) (pathPredicate, error) {
+	if n, err := strconv.Atoi(s); err == nil && n > 0 {
+		return pathPredicate{position: n}, nil
+	}
+
+	i := strings.IndexByte(s, '=')
+	if i < 0 {
+		return pathPredicate{}, fmt.Errorf("unsupported predicate [%s]", s)
+	}
+	name, value := strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:])
+	if len(value) < 2 || (value[0] != '\'' && value[0] != '"') || value[len(value)-1] != value[0] {
+		return pathPredicate{}, fmt.Errorf("unsupported predicate [%s]", s)
+	}
+
+	p := pathPredicate{value: value[1 : len(value)-1]}
+	if strings.HasPrefix(name, "@") {
+		p.attr = true
+		name = name[1:]
+	}
+	p.name = localPathName(name)
+	return p, nil
+}
+
+// localPathName returns name without its prefix.
+func localPathName(name string) string {
+	name = strings.TrimSpace(name)
+	if i := strings.LastIndexByte(name, ':'); i > -1 {
+		return name[i+1:]
+	}
+	return name
+}
+
+// pathNode is an element of the document searched by ErrorElement, start and
+// end being its offsets in the document.
+type pathNode struct {
+	name       string
+	attrs      []xml.Attr
+	text       string
+	start, end int64
+	children   []*pathNode
+}
+
+// parsePathTree returns a node holding the elements of b as children.
+func parsePathTree(b []byte) (*pathNode, error) {
+	d := xml.NewDecoder(bytes.NewReader(b))
+	root := &pathNode{}
+	stack := []*pathNode{root}
+	for {
+		offset := d.InputOffset()
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		parent := stack[len(stack)-1]
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			n := &pathNode{name: tok.Name.Local, attrs: tok.Attr, start: offset}
+			parent.children = append(parent.children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			parent.end = d.InputOffset()
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			parent.text += string(tok)
+		}
+	}
+	return root, nil
+}
+
+// find returns the first element under n reached by steps, nil if there is
+// none.
+func (n *pathNode) find(steps []pathStep) *pathNode {
+	if len(steps) == 0 {
+		return n
+	}
+
+	step := steps[0]
+	var candidates []*pathNode
+	for _, c := range n.children {
+		if step.name == "*" || c.name == step.name {
+			candidates = append(candidates, c)
+		}
+	}
+	for _, p := range step.predicates {
+		candidates = p.filter(candidates)
+	}
+
+	for _, c := range candidates {
+		if found := c.find(steps[1:]); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// filter returns the nodes matching the predicate.
+func (p pathPredicate) filter(nodes []*pathNode) []*pathNode {
+	if p.position > 0 {
+		if p.position > len(nodes) {
+			return nil
+		}
+		return nodes[p.position-1 : p.position]
+	}
+
+	var matched []*pathNode
+	for _, n := range nodes {
+		if p.matches(n) {
+			matched = append(matched, n)
+		}
+	}
+	return matched
+}
+
+func (p pathPredicate) matches(n *pathNode) bool {
+	switch {
+	case p.attr:
+		for _, attr := range n.attrs {
+			if attr.Name.Local == p.name && attr.Value == p.value {
+				return true
+			}
+		}
+	case p.name == ".":
+		return strings.TrimSpace(n.text) == p.value
+	default:
+		for _, c := range n.children {
+			if c.name == p.name && strings.TrimSpace(c.text) == p.value {
+				return true
+			}
+		}
+	}
+	return false
+}
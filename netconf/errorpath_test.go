@@ -0,0 +1,80 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"testing"
+)
+
+func TestErrorElement(t *testing.T) {
+	config := `<interfaces xmlns="urn:if">
+	<interface id="a"><name>eth0</name><mtu>1500</mtu></interface>
+	<interface id="b"><name>eth1</name><mtu>90000</mtu><address>10.0.0.1</address><address>10.0.0.2</address></interface>
+</interfaces>`
+
+	tt := []struct {
+		name     string
+		path     string
+		expected string
+	}{
+		{
+			name:     "full path",
+			path:     "/rpc/edit-config/config/if:interfaces/if:interface[if:name='eth1']/if:mtu",
+			expected: "<mtu>90000</mtu>",
+		},
+		{
+			name:     "relative to config",
+			path:     "\n  /if:interfaces/if:interface[if:name=\"eth0\"]\n",
+			expected: `<interface id="a"><name>eth0</name><mtu>1500</mtu></interface>`,
+		},
+		{
+			name:     "position",
+			path:     "/interfaces/interface[2]/address[2]",
+			expected: "<address>10.0.0.2</address>",
+		},
+		{
+			name:     "attribute and value",
+			path:     "/interfaces/*[@id='b']/address[.='10.0.0.1']",
+			expected: "<address>10.0.0.1</address>",
+		},
+		{
+			name:     "several predicates",
+			path:     "/interfaces/interface[name='eth1'][mtu='90000']/name",
+			expected: "<name>eth1</name>",
+		},
+		{
+			name: "not found",
+			path: "/interfaces/interface[name='eth2']/mtu",
+		},
+		{
+			name: "unsupported predicate",
+			path: "/interfaces/interface[last()]",
+		},
+		{
+			name: "no path",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			re := &RPCError{Path: tc.path}
+			got, err := re.ErrorElement([]byte(config))
+			if tc.expected == "" {
+				if err == nil {
+					t.Errorf("expected an error, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.expected {
+				t.Errorf("got %s, expected %s", got, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"sort"
+)
+
+// Filter restricts the data retrieved by Get and GetConfig, to which it is
+// given as a GetOption in place of a subtree filter string.
+type Filter interface {
+	GetOption
+	// filterElement returns the filter element of the request.
+	filterElement() string
+	// dataFilterElement returns the filter element of a get-data request.
+	dataFilterElement() string
+}
+
+// SubtreeFilter builds a subtree filter (RFC6241 section 6) element by
+// element. Elements are added under the current container, starting at the
+// top level, and are in the namespace last set with Namespace:
+//
+//	NewSubtreeFilter().Namespace(ns).Container("interfaces").
+//		Container("interface").Match("name", "eth0").Select("mtu")
+//
+// Attribute match expressions are added to the element last added with Attr.
+//
+// A SubtreeFilter is a Filter, and String returns it as the filter string
+// accepted by Get and GetConfig.
+type SubtreeFilter struct {
+	root    filterNode
+	current *filterNode
+	last    *filterNode
+	ns      string
+}
+
+type filterNode struct {
+	name     string
+	ns       string
+	value    *string
+	attrs    []filterAttr
+	parent   *filterNode
+	children []*filterNode
+}
+
+// filterAttr is an attribute match expression.
+type filterAttr struct {
+	ns, name, value string
+}
+
+// NewSubtreeFilter returns an empty subtree filter.
+func NewSubtreeFilter() *SubtreeFilter {
+	f := &SubtreeFilter{}
+	f.current = &f.root
+	return f
+}
+
+// Namespace sets the namespace of the elements added next.
+func (f *SubtreeFilter) Namespace(ns string) *SubtreeFilter {
+	f.ns = ns
+	return f
+}
+
+// Container adds a containment node under the current container and makes it
+// the current container.
+func (f *SubtreeFilter) Container(name string) *SubtreeFilter {
+	f.current = f.add(name, nil)
+	return f
+}
+
+// Up makes the parent of the current container the current container, so
+// that siblings can be added.
+func (f *SubtreeFilter) Up() *SubtreeFilter {
+	if f.current.parent != nil {
+		f.current = f.current.parent
+	}
+	return f
+}
+
+// Select adds selection nodes under the current container, selecting the
+// named elements.
+func (f *SubtreeFilter) Select(names ...string) *SubtreeFilter {
+	for _, name := range names {
+		f.add(name, nil)
+	}
+	return f
+}
+
+// Match adds a content match node under the current container, restricting
+// the data to the instances whose element name has the given value.
+func (f *SubtreeFilter) Match(name, value string) *SubtreeFilter {
+	f.add(name, &value)
+	return f
+}
+
+// Attr adds an attribute match expression to the element last added,
+// restricting the data to the instances of that element having the attribute
+// name with the given value. ns is the namespace of the attribute, empty for
+// an unqualified attribute; a prefix is declared for it on the element. It
+// does nothing before an element is added.
+func (f *SubtreeFilter) Attr(ns, name, value string) *SubtreeFilter {
+	if f.last != nil {
+		f.last.attrs = append(f.last.attrs, filterAttr{ns: ns, name: name, value: value})
+	}
+	return f
+}
+
+func (f *SubtreeFilter) add(name string, value *string) *filterNode {
+	n := &filterNode{name: name, ns: f.ns, value: value, parent: f.current}
+	f.current.children = append(f.current.children, n)
+	f.last = n
+	return n
+}
+
+func (f *SubtreeFilter) applyGet(opts *getOptions) {
+	opts.filter = f
+}
+
+func (f *SubtreeFilter) filterElement() string {
+	return subtreeFilterElement(f.String())
+}
+
+func (f *SubtreeFilter) dataFilterElement() string {
+	return fmt.Sprintf("<subtree-filter>%s</subtree-filter>", f.String())
+}
+
+// subtreeFilterElement returns the filter element of a subtree filter.
+func subtreeFilterElement(filter string) string {
+	return fmt.Sprintf(`<filter type="subtree">%s</filter>`, filter)
+}
+
+// String returns the XML of the filter. A namespace is declared on each
+// element whose namespace differs from the one of its parent.
+func (f *SubtreeFilter) String() string {
+	var buf bytes.Buffer
+	for _, n := range f.root.children {
+		n.write(&buf, "")
+	}
+	return buf.String()
+}
+
+func (n *filterNode) write(buf *bytes.Buffer, parentNS string) {
+	fmt.Fprintf(buf, "<%s", n.name)
+	if n.ns != parentNS {
+		buf.WriteString(` xmlns="`)
+		xml.EscapeText(buf, []byte(n.ns))
+		buf.WriteString(`"`)
+	}
+	n.writeAttrs(buf)
+
+	if n.value == nil && len(n.children) == 0 {
+		buf.WriteString("/>")
+		return
+	}
+
+	buf.WriteString(">")
+	if n.value != nil {
+		xml.EscapeText(buf, []byte(*n.value))
+	}
+	for _, child := range n.children {
+		child.write(buf, n.ns)
+	}
+	fmt.Fprintf(buf, "</%s>", n.name)
+}
+
+// writeAttrs writes the attribute match expressions of n, declaring a prefix
+// for each of their namespaces.
+func (n *filterNode) writeAttrs(buf *bytes.Buffer) {
+	prefixes := make(map[string]string)
+	for _, attr := range n.attrs {
+		if attr.ns == "" {
+			continue
+		}
+		if _, ok := prefixes[attr.ns]; !ok {
+			prefixes[attr.ns] = fmt.Sprintf("a%d", len(prefixes))
+			fmt.Fprintf(buf, ` xmlns:%s="`, prefixes[attr.ns])
+			xml.EscapeText(buf, []byte(attr.ns))
+			buf.WriteString(`"`)
+		}
+	}
+
+	for _, attr := range n.attrs {
+		buf.WriteString(" ")
+		if attr.ns != "" {
+			buf.WriteString(prefixes[attr.ns] + ":")
+		}
+		buf.WriteString(attr.name + `="`)
+		xml.EscapeText(buf, []byte(attr.value))
+		buf.WriteString(`"`)
+	}
+}
+
+type xpathFilter struct {
+	expr       string
+	namespaces map[string]string
+}
+
+// FilterXPath returns a filter selecting the data matching the XPath
+// expression expr, which requires the :xpath capability. namespaces maps the
+// prefixes used in expr to their namespace.
+func FilterXPath(expr string, namespaces map[string]string) Filter {
+	return &xpathFilter{expr: expr, namespaces: namespaces}
+}
+
+func (f *xpathFilter) applyGet(opts *getOptions) {
+	opts.filter = f
+}
+
+func (f *xpathFilter) filterElement() string {
+	var buf bytes.Buffer
+	buf.WriteString(`<filter type="xpath"`)
+	f.writeNamespaces(&buf)
+	buf.WriteString(` select="`)
+	xml.EscapeText(&buf, []byte(f.expr))
+	buf.WriteString(`"/>`)
+	return buf.String()
+}
+
+func (f *xpathFilter) dataFilterElement() string {
+	var buf bytes.Buffer
+	buf.WriteString(`<xpath-filter`)
+	f.writeNamespaces(&buf)
+	buf.WriteString(`>`)
+	xml.EscapeText(&buf, []byte(f.expr))
+	buf.WriteString(`</xpath-filter>`)
+	return buf.String()
+}
+
+// writeNamespaces writes the declarations of the prefixes used in the
+// expression as attributes.
+func (f *xpathFilter) writeNamespaces(buf *bytes.Buffer) {
+	prefixes := make([]string, 0, len(f.namespaces))
+	for prefix := range f.namespaces {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	for _, prefix := range prefixes {
+		fmt.Fprintf(buf, ` xmlns:%s="`, prefix)
+		xml.EscapeText(buf, []byte(f.namespaces[prefix]))
+		buf.WriteString(`"`)
+	}
+}
+
+func (f *xpathFilter) validate(caps []string) error {
+	return requireCapability(caps, CapabilityXPath, "xpath filter")
+}
@@ -0,0 +1,124 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSubtreeFilter(t *testing.T) {
+	tt := []struct {
+		name     string
+		filter   *SubtreeFilter
+		expected string
+	}{
+		{
+			name:     "empty",
+			filter:   NewSubtreeFilter(),
+			expected: "",
+		},
+		{
+			name:     "selection",
+			filter:   NewSubtreeFilter().Namespace("urn:if").Container("interfaces").Container("interface").Select("name", "mtu"),
+			expected: `<interfaces xmlns="urn:if"><interface><name/><mtu/></interface></interfaces>`,
+		},
+		{
+			name:     "content match",
+			filter:   NewSubtreeFilter().Container("users").Container("user").Match("name", "a&b").Select("uid"),
+			expected: `<users><user><name>a&amp;b</name><uid/></user></users>`,
+		},
+		{
+			name: "namespaces",
+			filter: NewSubtreeFilter().Namespace("urn:if").Container("interfaces").Container("interface").
+				Namespace("urn:ip").Container("ipv4").Select("address").Up().
+				Namespace("urn:if").Select("name"),
+			expected: `<interfaces xmlns="urn:if"><interface><ipv4 xmlns="urn:ip"><address/></ipv4><name/></interface></interfaces>`,
+		},
+		{
+			name: "siblings",
+			filter: NewSubtreeFilter().Namespace("urn:a").Container("a").Select("x").Up().
+				Namespace("urn:b").Container("b").Up().Up(),
+			expected: `<a xmlns="urn:a"><x/></a><b xmlns="urn:b"/>`,
+		},
+		{
+			name: "attribute match",
+			filter: NewSubtreeFilter().Namespace("urn:if").Container("interfaces").
+				Select("interface").Attr("urn:t", "ifName", "eth0").Attr("", "type", `"a"&b`).Attr("urn:t", "mtu", "1500"),
+			expected: `<interfaces xmlns="urn:if"><interface xmlns:a0="urn:t" a0:ifName="eth0" type="&#34;a&#34;&amp;b" a0:mtu="1500"/></interfaces>`,
+		},
+		{
+			name:     "attribute on container",
+			filter:   NewSubtreeFilter().Attr("", "ignored", "x").Container("top").Attr("", "id", "1").Select("x"),
+			expected: `<top id="1"><x/></top>`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.filter.String(); got != tc.expected {
+				t.Errorf("got %s, expected %s", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestFilterOption(t *testing.T) {
+	caps := append([]string{CapabilityXPath}, DefaultCapabilities...)
+
+	tt := []struct {
+		name     string
+		caps     []string
+		filter   string
+		opt      Filter
+		expected string
+		err      error
+	}{
+		{
+			name:     "subtree",
+			caps:     caps,
+			opt:      NewSubtreeFilter().Namespace("urn:if").Container("interfaces"),
+			expected: `<get-config><source><running/></source><filter type="subtree"><interfaces xmlns="urn:if"/></filter></get-config>`,
+		},
+		{
+			name:     "xpath",
+			caps:     caps,
+			opt:      FilterXPath(`/if:interfaces/if:interface[if:name="eth0"]`, map[string]string{"if": "urn:if", "ip": "urn:ip"}),
+			expected: `<get-config><source><running/></source><filter type="xpath" xmlns:if="urn:if" xmlns:ip="urn:ip" select="/if:interfaces/if:interface[if:name=&#34;eth0&#34;]"/></get-config>`,
+		},
+		{
+			name: "xpath unsupported",
+			caps: DefaultCapabilities,
+			opt:  FilterXPath("/interfaces", nil),
+			err:  ErrCapabilityNotSupported,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			requests := make(chan string, 1)
+			s := newSessionTest(t, tc.caps, serveRequests(requests, "<data/>"))
+			defer s.Close()
+
+			_, err := s.GetConfig(Running, tc.filter, tc.opt)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+			if tc.err != nil {
+				return
+			}
+			if got := requestBody(<-requests); got != tc.expected {
+				t.Errorf("got %s, expected %s", got, tc.expected)
+			}
+		})
+	}
+
+	s := &Session{}
+	if _, err := s.Get("<interfaces/>", NewSubtreeFilter()); err == nil {
+		t.Error("expected an error when giving two filters")
+	}
+}
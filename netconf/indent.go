@@ -0,0 +1,152 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// indentUnit is the indentation of each level of IndentXML.
+const indentUnit = "  "
+
+// IndentXML returns the XML document b indented, each element on its own line
+// but for those holding text only, for logging or diffing. Whitespace between
+// elements is replaced. Prefixes and namespace declarations are kept as they
+// are, so that the document means the same.
+func IndentXML(b []byte) ([]byte, error) {
+	d := xml.NewDecoder(bytes.NewReader(b))
+	var out bytes.Buffer
+
+	// names holds the names of the elements open, to check that they are
+	// closed in order.
+	var names []string
+	// open is set while the start tag last written is not closed yet, so that
+	// an element without content can be written as an empty element tag.
+	open := false
+	// text is set when the current element holds text, its end tag then
+	// following it on the same line.
+	text := false
+
+	closeTag := func() {
+		if open {
+			out.WriteString(">")
+			open = false
+		}
+	}
+	newLine := func() {
+		if out.Len() > 0 {
+			out.WriteString("\n")
+		}
+		out.WriteString(strings.Repeat(indentUnit, len(names)))
+	}
+
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			closeTag()
+			newLine()
+			out.WriteString("<" + rawName(tok.Name))
+			for _, attr := range tok.Attr {
+				out.WriteString(" " + rawName(attr.Name) + `="`)
+				escapeXML(&out, attr.Value, true)
+				out.WriteString(`"`)
+			}
+			names = append(names, rawName(tok.Name))
+			open = true
+			text = false
+		case xml.EndElement:
+			if len(names) == 0 || names[len(names)-1] != rawName(tok.Name) {
+				return nil, &xml.SyntaxError{Msg: "unexpected end element </" + rawName(tok.Name) + ">"}
+			}
+			names = names[:len(names)-1]
+			switch {
+			case open:
+				out.WriteString("/>")
+				open = false
+			case text:
+				out.WriteString("</" + rawName(tok.Name) + ">")
+			default:
+				newLine()
+				out.WriteString("</" + rawName(tok.Name) + ">")
+			}
+			text = false
+		case xml.CharData:
+			if len(bytes.TrimSpace(tok)) == 0 {
+				continue
+			}
+			closeTag()
+			escapeXML(&out, string(tok), false)
+			text = true
+		case xml.Comment:
+			closeTag()
+			newLine()
+			out.WriteString("<!--" + string(tok) + "-->")
+		case xml.ProcInst:
+			closeTag()
+			newLine()
+			out.WriteString("<?" + tok.Target)
+			if len(tok.Inst) > 0 {
+				out.WriteString(" " + string(tok.Inst))
+			}
+			out.WriteString("?>")
+		case xml.Directive:
+			closeTag()
+			newLine()
+			out.WriteString("<!" + string(tok) + ">")
+		}
+	}
+	if len(names) > 0 {
+		return nil, &xml.SyntaxError{Msg: "unexpected EOF"}
+	}
+
+	return out.Bytes(), nil
+}
+
+// rawName returns name as written in the document, with its prefix.
+func rawName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+// escapeXML writes s to buf escaping the characters that can't appear as is
+// in text, or in an attribute value when attr is set. Unlike xml.EscapeText,
+// newlines in text are kept as they are.
+func escapeXML(buf *bytes.Buffer, s string, attr bool) {
+	for _, r := range s {
+		switch {
+		case r == '&':
+			buf.WriteString("&amp;")
+		case r == '<':
+			buf.WriteString("&lt;")
+		case r == '>':
+			buf.WriteString("&gt;")
+		case r == '"' && attr:
+			buf.WriteString("&quot;")
+		case r == '\r':
+			buf.WriteString("&#xD;")
+		case r == '\n' && attr:
+			buf.WriteString("&#xA;")
+		case r == '\t' && attr:
+			buf.WriteString("&#x9;")
+		default:
+			buf.WriteRune(r)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"testing"
+)
+
+func TestIndentXML(t *testing.T) {
+	tt := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:  "elements",
+			input: `<rpc-reply message-id="1" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><data><name>eth0</name><enabled/></data></rpc-reply>`,
+			expected: `<rpc-reply message-id="1" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">
+  <data>
+    <name>eth0</name>
+    <enabled/>
+  </data>
+</rpc-reply>`,
+		},
+		{
+			name:  "reindent",
+			input: "<?xml version=\"1.0\"?>\n<a>\n\t\t<b>x</b>\n\t<!-- c -->\n</a>\n",
+			expected: `<?xml version="1.0"?>
+<a>
+  <b>x</b>
+  <!-- c -->
+</a>`,
+		},
+		{
+			name:  "namespaces",
+			input: `<junos:a xmlns:junos="http://xml.juniper.net/junos/*/junos" junos:style="brief"><b xmlns="urn:b"><c/></b></junos:a>`,
+			expected: `<junos:a xmlns:junos="http://xml.juniper.net/junos/*/junos" junos:style="brief">
+  <b xmlns="urn:b">
+    <c/>
+  </b>
+</junos:a>`,
+		},
+		{
+			name:     "escaping",
+			input:    `<a b="&quot;1&quot; &lt; 2"><![CDATA[x < y & z]]></a>`,
+			expected: `<a b="&quot;1&quot; &lt; 2">x &lt; y &amp; z</a>`,
+		},
+		{
+			name:     "multiline text",
+			input:    "<error-message>line 1\nline 2</error-message>",
+			expected: "<error-message>line 1\nline 2</error-message>",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := IndentXML([]byte(tc.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tc.expected {
+				t.Errorf("got\n%s\nexpected\n%s", out, tc.expected)
+			}
+		})
+	}
+}
+
+func TestIndentXMLInvalid(t *testing.T) {
+	for _, input := range []string{"<a><b></a>", "<a>", "<a></a></b>"} {
+		if _, err := IndentXML([]byte(input)); err == nil {
+			t.Errorf("expected %q to be rejected", input)
+		}
+	}
+}
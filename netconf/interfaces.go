@@ -0,0 +1,101 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+const ianaIfTypeNamespace = "urn:ietf:params:xml:ns:yang:iana-if-type"
+
+// Interfaces is the configuration of the interfaces of a device, as modeled
+// by ietf-interfaces (RFC8343) and ietf-ip (RFC8344). Marshal gives the config
+// to be loaded with EditConfig, and a get-config reply filtered on the
+// interfaces can be unmarshaled into it. Fields left empty are omitted, so
+// that merging the config leaves them as they are on the device.
+type Interfaces struct {
+	XMLName   xml.Name    `xml:"urn:ietf:params:xml:ns:yang:ietf-interfaces interfaces"`
+	Interface []Interface `xml:"interface"`
+}
+
+// Interface is the configuration of an interface.
+type Interface struct {
+	Name        string        `xml:"name"`
+	Description string        `xml:"description,omitempty"`
+	Type        InterfaceType `xml:"type,omitempty"`
+	Enabled     *bool         `xml:"enabled"`
+	IPv4        *IPv4         `xml:"urn:ietf:params:xml:ns:yang:ietf-ip ipv4"`
+	IPv6        *IPv6         `xml:"urn:ietf:params:xml:ns:yang:ietf-ip ipv6"`
+}
+
+// IPv4 is the IPv4 configuration of an interface.
+type IPv4 struct {
+	Enabled    *bool       `xml:"enabled"`
+	Forwarding *bool       `xml:"forwarding"`
+	MTU        uint16      `xml:"mtu,omitempty"`
+	Addresses  []IPAddress `xml:"address"`
+}
+
+// IPv6 is the IPv6 configuration of an interface.
+type IPv6 struct {
+	Enabled    *bool       `xml:"enabled"`
+	Forwarding *bool       `xml:"forwarding"`
+	MTU        uint32      `xml:"mtu,omitempty"`
+	Addresses  []IPAddress `xml:"address"`
+}
+
+// IPAddress is an address configured on an interface with the length of the
+// prefix of its subnet.
+type IPAddress struct {
+	IP           string `xml:"ip"`
+	PrefixLength uint8  `xml:"prefix-length"`
+}
+
+// Marshal returns the configuration as a config block for EditConfig.
+func (c *Interfaces) Marshal() (string, error) {
+	b, err := xml.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// InterfaceType is an interface type of iana-if-type, without its prefix.
+type InterfaceType string
+
+// Common interface types of iana-if-type
+const (
+	InterfaceTypeEthernet InterfaceType = "ethernetCsmacd"
+	InterfaceTypeLoopback InterfaceType = "softwareLoopback"
+	InterfaceTypeVLAN     InterfaceType = "l2vlan"
+	InterfaceTypeLAG      InterfaceType = "ieee8023adLag"
+	InterfaceTypeTunnel   InterfaceType = "tunnel"
+)
+
+// MarshalXML writes t as an identity of iana-if-type, declaring its prefix.
+func (t InterfaceType) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if t == "" {
+		return nil
+	}
+	start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "xmlns:ianaift"}, Value: ianaIfTypeNamespace})
+	return e.EncodeElement("ianaift:"+string(t), start)
+}
+
+// UnmarshalXML reads an identity of iana-if-type, whatever its prefix.
+func (t *InterfaceType) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var s string
+	if err := d.DecodeElement(&s, &start); err != nil {
+		return err
+	}
+	s = strings.TrimSpace(s)
+	if i := strings.LastIndex(s, ":"); i > -1 {
+		s = s[i+1:]
+	}
+	*t = InterfaceType(s)
+	return nil
+}
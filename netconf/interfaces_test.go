@@ -0,0 +1,71 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestInterfacesMarshal(t *testing.T) {
+	enabled := true
+
+	tt := []struct {
+		name     string
+		config   Interfaces
+		expected string
+	}{
+		{
+			name: "ipv4",
+			config: Interfaces{Interface: []Interface{{
+				Name:        "eth0",
+				Description: "uplink & mgmt",
+				Type:        InterfaceTypeEthernet,
+				Enabled:     &enabled,
+				IPv4: &IPv4{
+					MTU:       1500,
+					Addresses: []IPAddress{{IP: "192.0.2.1", PrefixLength: 24}},
+				},
+			}}},
+			expected: `<interfaces xmlns="urn:ietf:params:xml:ns:yang:ietf-interfaces"><interface><name>eth0</name><description>uplink &amp; mgmt</description><type xmlns:ianaift="urn:ietf:params:xml:ns:yang:iana-if-type">ianaift:ethernetCsmacd</type><enabled>true</enabled><ipv4 xmlns="urn:ietf:params:xml:ns:yang:ietf-ip"><mtu>1500</mtu><address><ip>192.0.2.1</ip><prefix-length>24</prefix-length></address></ipv4></interface></interfaces>`,
+		},
+		{
+			name: "ipv6",
+			config: Interfaces{Interface: []Interface{{
+				Name: "lo0",
+				IPv6: &IPv6{
+					Forwarding: &enabled,
+					Addresses:  []IPAddress{{IP: "2001:db8::1", PrefixLength: 128}},
+				},
+			}}},
+			expected: `<interfaces xmlns="urn:ietf:params:xml:ns:yang:ietf-interfaces"><interface><name>lo0</name><ipv6 xmlns="urn:ietf:params:xml:ns:yang:ietf-ip"><forwarding>true</forwarding><address><ip>2001:db8::1</ip><prefix-length>128</prefix-length></address></ipv6></interface></interfaces>`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := tc.config.Marshal()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config != tc.expected {
+				t.Errorf("unexpected config (want %q, got %q)", tc.expected, config)
+			}
+
+			var parsed Interfaces
+			if err := xml.Unmarshal([]byte(config), &parsed); err != nil {
+				t.Fatal(err)
+			}
+			parsed.XMLName = xml.Name{}
+			if !cmp.Equal(parsed, tc.config) {
+				t.Errorf("unexpected parsed config:\n%s", cmp.Diff(tc.config, parsed))
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"regexp"
+)
+
+// Logger receives the messages logged by sessions and transports. Debugf is
+// used for events such as the session being established or replies being
+// dropped, and Tracef for the raw frames sent and received.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Tracef(format string, args ...interface{})
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debugf(format string, args ...interface{}) {}
+func (nopLogger) Tracef(format string, args ...interface{}) {}
+
+// NopLogger returns a Logger discarding all messages, which is the default.
+func NopLogger() Logger {
+	return nopLogger{}
+}
+
+type stdLogger struct {
+	l *log.Logger
+}
+
+// NewStdLogger returns a Logger writing to l, or to the standard logger when
+// nil, with messages prefixed by their level.
+func NewStdLogger(l *log.Logger) Logger {
+	return &stdLogger{l: l}
+}
+
+func (s *stdLogger) Debugf(format string, args ...interface{}) {
+	s.output("DEBUG " + fmt.Sprintf(format, args...))
+}
+
+func (s *stdLogger) Tracef(format string, args ...interface{}) {
+	s.output("TRACE " + fmt.Sprintf(format, args...))
+}
+
+func (s *stdLogger) output(msg string) {
+	if s.l == nil {
+		log.Output(3, msg)
+		return
+	}
+	s.l.Output(3, msg)
+}
+
+type redactLogger struct {
+	l      Logger
+	redact func(string) string
+}
+
+// RedactLogger returns a Logger passing messages to l after rewriting them
+// with redact, which typically hides secrets such as passwords. See
+// RedactPasswords.
+func RedactLogger(l Logger, redact func(string) string) Logger {
+	return &redactLogger{l: l, redact: redact}
+}
+
+func (r *redactLogger) Debugf(format string, args ...interface{}) {
+	r.l.Debugf("%s", r.redact(fmt.Sprintf(format, args...)))
+}
+
+func (r *redactLogger) Tracef(format string, args ...interface{}) {
+	r.l.Tracef("%s", r.redact(fmt.Sprintf(format, args...)))
+}
+
+type indentLogger struct {
+	l Logger
+}
+
+// IndentLogger returns a Logger passing messages to l with the frames traced
+// by transports indented with IndentXML, their framing removed, for devices
+// sending XML on a single line. Frames that are not whole XML documents, such
+// as parts of a message sent as a stream, are passed as they are. When
+// combined with RedactLogger, IndentLogger must wrap it.
+func IndentLogger(l Logger) Logger {
+	return &indentLogger{l: l}
+}
+
+func (i *indentLogger) Debugf(format string, args ...interface{}) {
+	i.l.Debugf(format, args...)
+}
+
+func (i *indentLogger) Tracef(format string, args ...interface{}) {
+	indented := make([]interface{}, len(args))
+	for n, arg := range args {
+		indented[n] = arg
+		if frame, ok := arg.([]byte); ok {
+			if msg, err := IndentXML(unframe(frame)); err == nil {
+				indented[n] = "\n" + string(msg)
+			}
+		}
+	}
+	i.l.Tracef(format, indented...)
+}
+
+// unframe returns the message held in the 1.0 or 1.1 frame, or frame itself
+// when it isn't a whole one.
+func unframe(frame []byte) []byte {
+	if bytes.HasPrefix(frame, []byte("\n#")) {
+		var d chunkDecoder
+		var msg bytes.Buffer
+		if _, done, err := d.decode(&msg, frame); err == nil && done {
+			return msg.Bytes()
+		}
+		return frame
+	}
+	return bytes.TrimSuffix(bytes.TrimSpace(frame), []byte(msgSeperator))
+}
+
+var passwordRegexp = regexp.MustCompile(`(<(?:[\w.-]+:)?(?:[\w-]*password|secret|pre-shared-key)(?:\s[^>]*)?>)[^<]*`)
+
+// RedactPasswords replaces the content of elements named password, ending in
+// -password, secret or pre-shared-key with asterisks. It is meant to be used
+// with RedactLogger.
+func RedactPasswords(msg string) string {
+	return passwordRegexp.ReplaceAllString(msg, "${1}***")
+}
+
+// logger returns l, or a no-op Logger when nil.
+func logger(l Logger) Logger {
+	if l == nil {
+		return nopLogger{}
+	}
+	return l
+}
@@ -0,0 +1,38 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package netconf
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// LevelTrace is the slog level trace messages are logged at by the Logger
+// returned by NewSlogLogger, below slog.LevelDebug.
+const LevelTrace = slog.LevelDebug - 4
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+// NewSlogLogger returns a Logger writing to l, debug messages at
+// slog.LevelDebug and trace ones at LevelTrace.
+func NewSlogLogger(l *slog.Logger) Logger {
+	return &slogLogger{l: l}
+}
+
+func (s *slogLogger) Debugf(format string, args ...interface{}) {
+	s.l.Log(context.Background(), slog.LevelDebug, fmt.Sprintf(format, args...))
+}
+
+func (s *slogLogger) Tracef(format string, args ...interface{}) {
+	s.l.Log(context.Background(), LevelTrace, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,79 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+)
+
+// testLogger records the messages it receives.
+type testLogger struct {
+	debug []string
+	trace []string
+}
+
+func (l *testLogger) Debugf(format string, args ...interface{}) {
+	l.debug = append(l.debug, fmt.Sprintf(format, args...))
+}
+
+func (l *testLogger) Tracef(format string, args ...interface{}) {
+	l.trace = append(l.trace, fmt.Sprintf(format, args...))
+}
+
+func TestLoggerTrace(t *testing.T) {
+	var l testLogger
+	trans, _ := newTransportTest("<rpc-reply><ok/></rpc-reply>]]>]]>")
+	trans.Logger = &l
+
+	if err := trans.Send([]byte("<rpc><get/></rpc>")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := trans.Receive(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"send: <rpc><get/></rpc>]]>]]>", "receive: <rpc-reply><ok/></rpc-reply>]]>]]>"}
+	if strings.Join(l.trace, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected trace %q", l.trace)
+	}
+}
+
+func TestStdLogger(t *testing.T) {
+	var out bytes.Buffer
+	l := RedactLogger(NewStdLogger(log.New(&out, "", 0)), RedactPasswords)
+
+	l.Debugf("connected to %s", "device")
+	l.Tracef("send: %s", `<user><name>admin</name><password>s3cret</password><x:encrypted-password a="b">$1$x</x:encrypted-password></user>`)
+
+	expected := "DEBUG connected to device\n" +
+		`TRACE send: <user><name>admin</name><password>***</password><x:encrypted-password a="b">***</x:encrypted-password></user>` + "\n"
+	if out.String() != expected {
+		t.Errorf("got %q, expected %q", out.String(), expected)
+	}
+}
+
+func TestIndentLogger(t *testing.T) {
+	for _, version := range []string{"v1.0", "v1.1"} {
+		var l testLogger
+		trans, _ := newTransportTest("")
+		trans.SetVersion(version)
+		trans.Logger = IndentLogger(&l)
+
+		if err := trans.Send([]byte("<rpc><get/></rpc>")); err != nil {
+			t.Fatal(err)
+		}
+
+		expected := "send: \n<rpc>\n  <get/>\n</rpc>"
+		if len(l.trace) != 1 || l.trace[0] != expected {
+			t.Errorf("%s: got %q, expected %q", version, l.trace, expected)
+		}
+	}
+}
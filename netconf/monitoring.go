@@ -0,0 +1,183 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CapabilityMonitoring is advertised by servers supporting NETCONF monitoring
+// (RFC6022), which includes retrieving their YANG modules.
+const CapabilityMonitoring = "urn:ietf:params:xml:ns:yang:ietf-netconf-monitoring"
+
+// SchemaInfo describes a schema listed in the netconf-state of a server.
+type SchemaInfo struct {
+	Identifier string   `xml:"identifier"`
+	Version    string   `xml:"version"`
+	Format     string   `xml:"format"`
+	Namespace  string   `xml:"namespace"`
+	Location   []string `xml:"location"`
+}
+
+// SessionState describes a session to a server, as listed in its
+// netconf-state.
+type SessionState struct {
+	ID int `xml:"session-id"`
+	// Transport is the identity of the transport of the session, such as
+	// ncm:netconf-ssh.
+	Transport  string    `xml:"transport"`
+	Username   string    `xml:"username"`
+	SourceHost string    `xml:"source-host"`
+	LoginTime  time.Time `xml:"login-time"`
+	// InRPCs and InBadRPCs count the RPCs received from the session, and
+	// OutRPCErrors and OutNotifications the rpc-errors and notifications
+	// sent to it.
+	InRPCs           uint32 `xml:"in-rpcs"`
+	InBadRPCs        uint32 `xml:"in-bad-rpcs"`
+	OutRPCErrors     uint32 `xml:"out-rpc-errors"`
+	OutNotifications uint32 `xml:"out-notifications"`
+	// Locks lists the datastores the session holds a global or partial lock
+	// on.
+	Locks []Datastore `xml:"-"`
+}
+
+// monitoringLocks is the locks container of a datastore in netconf-state.
+type monitoringLocks struct {
+	Global *struct {
+		Session int `xml:"locked-by-session"`
+	} `xml:"global-lock"`
+	Partial []struct {
+		Session int `xml:"locked-by-session"`
+	} `xml:"partial-lock"`
+}
+
+// getMonitoring retrieves the netconf-state subtree selected by filter, e.g.
+// <sessions/>, and unmarshals it into v.
+func (s *Session) getMonitoring(what, filter string, v interface{}) error {
+	if err := requireCapability(s.ServerCapabilities, CapabilityMonitoring, what); err != nil {
+		return err
+	}
+
+	reply, err := s.Exec(MethodGet("subtree", fmt.Sprintf(`<netconf-state xmlns="%s">%s</netconf-state>`, CapabilityMonitoring, filter)))
+	if err != nil {
+		return err
+	}
+	return xml.Unmarshal([]byte(reply.Data), v)
+}
+
+// MonitoringSessions returns the sessions established to the server, this
+// one included, with the locks they hold, to find out who else is connected
+// before editing the configuration. It requires NETCONF monitoring (RFC6022).
+func (s *Session) MonitoringSessions() ([]SessionState, error) {
+	var data struct {
+		Sessions   []SessionState `xml:"netconf-state>sessions>session"`
+		Datastores []struct {
+			Name  Datastore       `xml:"name"`
+			Locks monitoringLocks `xml:"locks"`
+		} `xml:"netconf-state>datastores>datastore"`
+	}
+	if err := s.getMonitoring("listing sessions", "<sessions/><datastores/>", &data); err != nil {
+		return nil, err
+	}
+
+	for _, ds := range data.Datastores {
+		var holders []int
+		if ds.Locks.Global != nil {
+			holders = append(holders, ds.Locks.Global.Session)
+		}
+		for _, lock := range ds.Locks.Partial {
+			holders = append(holders, lock.Session)
+		}
+		for _, id := range holders {
+			for i := range data.Sessions {
+				if data.Sessions[i].ID == id && !containsDatastore(data.Sessions[i].Locks, ds.Name) {
+					data.Sessions[i].Locks = append(data.Sessions[i].Locks, ds.Name)
+				}
+			}
+		}
+	}
+	return data.Sessions, nil
+}
+
+// containsDatastore reports whether ds holds d.
+func containsDatastore(ds []Datastore, d Datastore) bool {
+	for _, x := range ds {
+		if x == d {
+			return true
+		}
+	}
+	return false
+}
+
+// MonitoringCapabilities returns the capabilities of the server as listed in
+// its netconf-state, which unlike those of its hello may change during the
+// session. It requires NETCONF monitoring (RFC6022).
+func (s *Session) MonitoringCapabilities() (Capabilities, error) {
+	var data struct {
+		Capabilities []string `xml:"netconf-state>capabilities>capability"`
+	}
+	if err := s.getMonitoring("listing capabilities", "<capabilities/>", &data); err != nil {
+		return nil, err
+	}
+
+	caps := make(Capabilities, len(data.Capabilities))
+	for i, capability := range data.Capabilities {
+		caps[i] = strings.TrimSpace(capability)
+	}
+	return caps, nil
+}
+
+// GetSchema retrieves the schema with the given identifier, such as a YANG
+// module name. version and format are optional, the server then picking the
+// schema and returning it as YANG. The schema is returned as text, which is
+// XML for the yin format.
+func (s *Session) GetSchema(identifier, version, format string) (string, error) {
+	if err := requireCapability(s.ServerCapabilities, CapabilityMonitoring, "get-schema"); err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<get-schema xmlns="%s">`, CapabilityMonitoring)
+	writeElement(&buf, "identifier", identifier)
+	writeElement(&buf, "version", version)
+	writeElement(&buf, "format", format)
+	buf.WriteString("</get-schema>")
+
+	reply, err := s.Exec(RawMethod(buf.String()))
+	if err != nil {
+		return "", err
+	}
+
+	var data struct {
+		Text  string `xml:",chardata"`
+		Inner string `xml:",innerxml"`
+	}
+	if err := xml.Unmarshal([]byte(reply.Data), &data); err != nil {
+		return "", err
+	}
+
+	// A yin schema is made of elements while a yang one is plain text.
+	if format == "yin" || strings.HasSuffix(format, ":yin") {
+		return strings.TrimSpace(data.Inner), nil
+	}
+	return data.Text, nil
+}
+
+// ListSchemas returns the schemas the server can provide with GetSchema.
+func (s *Session) ListSchemas() ([]SchemaInfo, error) {
+	var data struct {
+		Schemas []SchemaInfo `xml:"netconf-state>schemas>schema"`
+	}
+	if err := s.getMonitoring("listing schemas", "<schemas/>", &data); err != nil {
+		return nil, err
+	}
+	return data.Schemas, nil
+}
@@ -0,0 +1,155 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGetSchema(t *testing.T) {
+	caps := append([]string{CapabilityMonitoring}, DefaultCapabilities...)
+
+	tt := []struct {
+		name     string
+		version  string
+		format   string
+		data     string
+		request  string
+		expected string
+	}{
+		{
+			name:     "yang",
+			version:  "2019-01-01",
+			format:   "yang",
+			data:     "module m {\n  leaf a { type string; } // a &lt; b\n}",
+			request:  `<get-schema xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-monitoring"><identifier>m</identifier><version>2019-01-01</version><format>yang</format></get-schema>`,
+			expected: "module m {\n  leaf a { type string; } // a < b\n}",
+		},
+		{
+			name:     "yin",
+			format:   "yin",
+			data:     `<module name="m" xmlns="urn:ietf:params:xml:ns:yang:yin:1"/>`,
+			request:  `<get-schema xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-monitoring"><identifier>m</identifier><format>yin</format></get-schema>`,
+			expected: `<module name="m" xmlns="urn:ietf:params:xml:ns:yang:yin:1"/>`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			requests := make(chan string, 1)
+			s := newSessionTest(t, caps, serveRequests(requests,
+				`<data xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-monitoring">`+tc.data+`</data>`))
+			defer s.Close()
+
+			schema, err := s.GetSchema("m", tc.version, tc.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := requestBody(<-requests); got != tc.request {
+				t.Errorf("unexpected request %s", got)
+			}
+			if schema != tc.expected {
+				t.Errorf("got %q, expected %q", schema, tc.expected)
+			}
+		})
+	}
+}
+
+func TestListSchemas(t *testing.T) {
+	caps := append([]string{CapabilityMonitoring}, DefaultCapabilities...)
+	requests := make(chan string, 1)
+	s := newSessionTest(t, caps, serveRequests(requests, `<data><netconf-state xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-monitoring"><schemas>
+<schema><identifier>a</identifier><version>2019-01-01</version><format>yang</format><namespace>urn:a</namespace><location>NETCONF</location></schema>
+<schema><identifier>b</identifier><version></version><format>yin</format><namespace>urn:b</namespace><location>NETCONF</location><location>https://example.com/b.yin</location></schema>
+</schemas></netconf-state></data>`))
+	defer s.Close()
+
+	schemas, err := s.ListSchemas()
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-requests
+
+	expected := []SchemaInfo{
+		{Identifier: "a", Version: "2019-01-01", Format: "yang", Namespace: "urn:a", Location: []string{"NETCONF"}},
+		{Identifier: "b", Format: "yin", Namespace: "urn:b", Location: []string{"NETCONF", "https://example.com/b.yin"}},
+	}
+	if !cmp.Equal(schemas, expected) {
+		t.Errorf("unexpected schemas:\n%s", cmp.Diff(expected, schemas))
+	}
+}
+
+func TestGetSchemaCapability(t *testing.T) {
+	s := &Session{}
+	if _, err := s.GetSchema("m", "", ""); !errors.Is(err, ErrCapabilityNotSupported) {
+		t.Errorf("expected ErrCapabilityNotSupported, got %v", err)
+	}
+	if _, err := s.ListSchemas(); !errors.Is(err, ErrCapabilityNotSupported) {
+		t.Errorf("expected ErrCapabilityNotSupported, got %v", err)
+	}
+}
+
+func TestMonitoringSessions(t *testing.T) {
+	caps := append([]string{CapabilityMonitoring}, DefaultCapabilities...)
+	requests := make(chan string, 1)
+	s := newSessionTest(t, caps, serveRequests(requests, `<data><netconf-state xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-monitoring">
+<datastores>
+<datastore><name>running</name></datastore>
+<datastore><name>candidate</name><locks><global-lock><locked-by-session>12</locked-by-session><locked-time>2020-01-01T00:00:00Z</locked-time></global-lock></locks></datastore>
+</datastores>
+<sessions>
+<session><session-id>12</session-id><transport xmlns:ncm="urn:ietf:params:xml:ns:yang:ietf-netconf-monitoring">ncm:netconf-ssh</transport><username>admin</username><source-host>192.0.2.1</source-host><login-time>2020-01-01T00:00:00Z</login-time><in-rpcs>5</in-rpcs><in-bad-rpcs>1</in-bad-rpcs><out-rpc-errors>2</out-rpc-errors><out-notifications>0</out-notifications></session>
+<session><session-id>13</session-id><transport xmlns:ncm="urn:ietf:params:xml:ns:yang:ietf-netconf-monitoring">ncm:netconf-ssh</transport><username>ops</username><login-time>2020-01-02T00:00:00Z</login-time></session>
+</sessions>
+</netconf-state></data>`))
+	defer s.Close()
+
+	sessions, err := s.MonitoringSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := requestBody(<-requests), `<get><filter type="subtree"><netconf-state xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-monitoring"><sessions/><datastores/></netconf-state></filter></get>`; got != want {
+		t.Errorf("unexpected request (want %q, got %q)", want, got)
+	}
+
+	expected := []SessionState{
+		{ID: 12, Transport: "ncm:netconf-ssh", Username: "admin", SourceHost: "192.0.2.1", LoginTime: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), InRPCs: 5, InBadRPCs: 1, OutRPCErrors: 2, Locks: []Datastore{Candidate}},
+		{ID: 13, Transport: "ncm:netconf-ssh", Username: "ops", LoginTime: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)},
+	}
+	if !cmp.Equal(sessions, expected) {
+		t.Errorf("unexpected sessions:\n%s", cmp.Diff(expected, sessions))
+	}
+}
+
+func TestMonitoringCapabilities(t *testing.T) {
+	caps := append([]string{CapabilityMonitoring}, DefaultCapabilities...)
+	requests := make(chan string, 1)
+	s := newSessionTest(t, caps, serveRequests(requests, `<data><netconf-state xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-monitoring"><capabilities>
+<capability>urn:ietf:params:netconf:base:1.1</capability>
+<capability> urn:ietf:params:netconf:capability:url:1.0?scheme=file </capability>
+</capabilities></netconf-state></data>`))
+	defer s.Close()
+
+	got, err := s.MonitoringCapabilities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-requests
+
+	expected := Capabilities{CapabilityBase11, CapabilityURL + "?scheme=file"}
+	if !cmp.Equal(got, expected) {
+		t.Errorf("unexpected capabilities:\n%s", cmp.Diff(expected, got))
+	}
+
+	if _, err := (&Session{}).MonitoringSessions(); !errors.Is(err, ErrCapabilityNotSupported) {
+		t.Errorf("expected ErrCapabilityNotSupported, got %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+)
+
+const (
+	datastoresNamespace = "urn:ietf:params:xml:ns:yang:ietf-datastores"
+	originNamespace     = "urn:ietf:params:xml:ns:yang:ietf-origin"
+)
+
+// Datastores of the Network Management Datastore Architecture (RFC8342) only
+// reachable with GetData.
+const (
+	Intended    Datastore = "intended"
+	Operational Datastore = "operational"
+)
+
+// GetDataOptions holds the optional parameters of a get-data request.
+// Parameters left empty are omitted, leaving the server default in effect.
+type GetDataOptions struct {
+	// Filter restricts the data retrieved, see NewSubtreeFilter and
+	// FilterXPath.
+	Filter Filter
+	// ConfigFilter, when set, retrieves only configuration data if true and
+	// only other data if false.
+	ConfigFilter *bool
+	// OriginFilter retrieves only the data of the given origins, identities
+	// of ietf-origin such as "intended" or "learned", from the operational
+	// datastore. With NegateOriginFilter the data of the other origins is
+	// retrieved instead.
+	OriginFilter       []string
+	NegateOriginFilter bool
+	// MaxDepth, when non-zero, limits the depth of the subtrees retrieved.
+	MaxDepth int
+	// WithOrigin reports the origin of the data retrieved from the
+	// operational datastore.
+	WithOrigin   bool
+	WithDefaults WithDefaultsMode
+}
+
+type getData struct {
+	datastore Datastore
+	opts      GetDataOptions
+}
+
+// GetData retrieves the data held in datastore, such as Operational, with the
+// get-data operation of servers supporting the Network Management Datastore
+// Architecture (RFC8526). The data element, in the ietf-netconf-nmda
+// namespace, is in RPCReply.Data.
+func (s *Session) GetData(datastore Datastore, opts GetDataOptions) (*RPCReply, error) {
+	return s.Exec(&getData{datastore: datastore, opts: opts})
+}
+
+// MarshalMethod converts the method's output into a string
+func (m *getData) MarshalMethod() string {
+	var buf bytes.Buffer
+
+	// The order of the parameters is mandated by the RFC8526 schema.
+	fmt.Fprintf(&buf, `<get-data xmlns="%s">`, CapabilityNMDA)
+	buf.WriteString(datastoreElement(m.datastore))
+	if m.opts.Filter != nil {
+		buf.WriteString(m.opts.Filter.dataFilterElement())
+	}
+	if m.opts.ConfigFilter != nil {
+		fmt.Fprintf(&buf, "<config-filter>%t</config-filter>", *m.opts.ConfigFilter)
+	}
+	if len(m.opts.OriginFilter) > 0 {
+		name := "origin-filter"
+		if m.opts.NegateOriginFilter {
+			name = "negated-origin-filter"
+		}
+		for _, origin := range m.opts.OriginFilter {
+			fmt.Fprintf(&buf, `<%s xmlns:or="%s">or:`, name, originNamespace)
+			xml.EscapeText(&buf, []byte(origin))
+			fmt.Fprintf(&buf, "</%s>", name)
+		}
+	}
+	if m.opts.MaxDepth > 0 {
+		fmt.Fprintf(&buf, "<max-depth>%d</max-depth>", m.opts.MaxDepth)
+	}
+	if m.opts.WithOrigin {
+		buf.WriteString("<with-origin/>")
+	}
+	if m.opts.WithDefaults != "" {
+		fmt.Fprintf(&buf, `<with-defaults xmlns="%s">%s</with-defaults>`, withDefaultsNamespace, m.opts.WithDefaults)
+	}
+	buf.WriteString("</get-data>")
+
+	return buf.String()
+}
+
+func (m *getData) validate(caps []string) error {
+	if err := validateNMDA(caps, m.datastore, "get-data"); err != nil {
+		return err
+	}
+	if v, ok := m.opts.Filter.(capabilityValidator); ok {
+		if err := v.validate(caps); err != nil {
+			return err
+		}
+	}
+	if m.opts.WithDefaults != "" {
+		return m.opts.WithDefaults.validate(caps)
+	}
+	return nil
+}
+
+type editData struct {
+	datastore Datastore
+	config    string
+}
+
+// EditData loads config into datastore with the edit-data operation of
+// servers supporting the Network Management Datastore Architecture (RFC8526),
+// merging it with the configuration held there.
+func (s *Session) EditData(datastore Datastore, config string) error {
+	_, err := s.Exec(&editData{datastore: datastore, config: config})
+	return err
+}
+
+// MarshalMethod converts the method's output into a string
+func (m *editData) MarshalMethod() string {
+	return fmt.Sprintf(`<edit-data xmlns="%s">%s<config>%s</config></edit-data>`,
+		CapabilityNMDA, datastoreElement(m.datastore), m.config)
+}
+
+func (m *editData) validate(caps []string) error {
+	return validateNMDA(caps, m.datastore, "edit-data")
+}
+
+// datastoreElement returns the datastore element of a get-data or edit-data
+// request, referring to the identity of d.
+func datastoreElement(d Datastore) string {
+	return fmt.Sprintf(`<datastore xmlns:ds="%s">ds:%s</datastore>`, datastoresNamespace, string(d))
+}
+
+// validateNMDA checks that the server supports the operation what, on d. NMDA
+// servers list the ietf-netconf-nmda module in their YANG library, which many
+// only advertise with the yang-library:1.1 capability (RFC8526 section 2).
+func validateNMDA(caps []string, d Datastore, what string) error {
+	if d.IsURL() {
+		return errors.New("netconf: " + what + " doesn't accept a URL as datastore")
+	}
+	if hasCapability(caps, CapabilityYANGLibrary11) {
+		return nil
+	}
+	return requireCapability(caps, CapabilityNMDA, what)
+}
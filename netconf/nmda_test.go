@@ -0,0 +1,120 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGetData(t *testing.T) {
+	configOnly := false
+	tt := []struct {
+		name      string
+		datastore Datastore
+		opts      GetDataOptions
+		expected  string
+	}{
+		{
+			name:      "datastore",
+			datastore: Operational,
+			expected: `<get-data xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-nmda">` +
+				`<datastore xmlns:ds="urn:ietf:params:xml:ns:yang:ietf-datastores">ds:operational</datastore></get-data>`,
+		},
+		{
+			name:      "subtree filter",
+			datastore: Running,
+			opts:      GetDataOptions{Filter: NewSubtreeFilter().Namespace("urn:example").Container("interfaces")},
+			expected: `<get-data xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-nmda">` +
+				`<datastore xmlns:ds="urn:ietf:params:xml:ns:yang:ietf-datastores">ds:running</datastore>` +
+				`<subtree-filter><interfaces xmlns="urn:example"/></subtree-filter></get-data>`,
+		},
+		{
+			name:      "all options",
+			datastore: Operational,
+			opts: GetDataOptions{
+				Filter:             FilterXPath("/if:interfaces", map[string]string{"if": "urn:ietf:params:xml:ns:yang:ietf-interfaces"}),
+				ConfigFilter:       &configOnly,
+				OriginFilter:       []string{"learned", "system"},
+				NegateOriginFilter: true,
+				MaxDepth:           3,
+				WithOrigin:         true,
+				WithDefaults:       WithDefaultsReportAll,
+			},
+			expected: `<get-data xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-nmda">` +
+				`<datastore xmlns:ds="urn:ietf:params:xml:ns:yang:ietf-datastores">ds:operational</datastore>` +
+				`<xpath-filter xmlns:if="urn:ietf:params:xml:ns:yang:ietf-interfaces">/if:interfaces</xpath-filter>` +
+				`<config-filter>false</config-filter>` +
+				`<negated-origin-filter xmlns:or="urn:ietf:params:xml:ns:yang:ietf-origin">or:learned</negated-origin-filter>` +
+				`<negated-origin-filter xmlns:or="urn:ietf:params:xml:ns:yang:ietf-origin">or:system</negated-origin-filter>` +
+				`<max-depth>3</max-depth><with-origin/>` +
+				`<with-defaults xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-with-defaults">report-all</with-defaults></get-data>`,
+		},
+	}
+
+	caps := append([]string{
+		CapabilityNMDA + "?module=ietf-netconf-nmda&revision=2019-01-07",
+		CapabilityXPath,
+		CapabilityWithDefaults + "?basic-mode=explicit&also-supported=report-all",
+	}, DefaultCapabilities...)
+	requests := make(chan string, 1)
+	s := newSessionTest(t, caps, serveRequests(requests, `<data xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-nmda"/>`))
+	defer s.Close()
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := s.GetData(tc.datastore, tc.opts); err != nil {
+				t.Fatal(err)
+			}
+			if got := requestBody(<-requests); got != tc.expected {
+				t.Errorf("got %s, expected %s", got, tc.expected)
+			}
+		})
+	}
+
+	if err := s.EditData(Running, "<system><host-name>r1</host-name></system>"); err != nil {
+		t.Fatal(err)
+	}
+	expected := `<edit-data xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-nmda">` +
+		`<datastore xmlns:ds="urn:ietf:params:xml:ns:yang:ietf-datastores">ds:running</datastore>` +
+		`<config><system><host-name>r1</host-name></system></config></edit-data>`
+	if got := requestBody(<-requests); got != expected {
+		t.Errorf("got %s, expected %s", got, expected)
+	}
+}
+
+func TestGetDataYANGLibrary(t *testing.T) {
+	caps := append([]string{CapabilityYANGLibrary11 + "?revision=2019-01-04&content-id=1"}, DefaultCapabilities...)
+	requests := make(chan string, 1)
+	s := newSessionTest(t, caps, serveRequests(requests, `<data xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-nmda"/>`))
+	defer s.Close()
+
+	if _, err := s.GetData(Operational, GetDataOptions{OriginFilter: []string{"a<b&c"}}); err != nil {
+		t.Fatal(err)
+	}
+	expected := `<get-data xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-nmda">` +
+		`<datastore xmlns:ds="urn:ietf:params:xml:ns:yang:ietf-datastores">ds:operational</datastore>` +
+		`<origin-filter xmlns:or="urn:ietf:params:xml:ns:yang:ietf-origin">or:a&lt;b&amp;c</origin-filter></get-data>`
+	if got := requestBody(<-requests); got != expected {
+		t.Errorf("got %s, expected %s", got, expected)
+	}
+	if err := s.EditData(Running, "<system/>"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetDataUnsupported(t *testing.T) {
+	s := newSessionTest(t, DefaultCapabilities, nil)
+	defer s.ForceClose()
+
+	if _, err := s.GetData(Operational, GetDataOptions{}); !errors.Is(err, ErrCapabilityNotSupported) {
+		t.Errorf("expected ErrCapabilityNotSupported, got %v", err)
+	}
+	if err := s.EditData(Running, "<system/>"); !errors.Is(err, ErrCapabilityNotSupported) {
+		t.Errorf("expected ErrCapabilityNotSupported, got %v", err)
+	}
+}
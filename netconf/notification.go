@@ -0,0 +1,249 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	notificationXml = `<create-subscription xmlns="urn:ietf:params:xml:ns:netconf:notification:1.0">%s</create-subscription>`
+
+	// netconfNotificationsNamespace is the namespace of the notifications
+	// defined by RFC6470.
+	netconfNotificationsNamespace = "urn:ietf:params:xml:ns:yang:ietf-netconf-notifications"
+
+	// streamsNamespace is the namespace of the list of event streams defined
+	// by RFC5277.
+	streamsNamespace = "urn:ietf:params:xml:ns:netmod:notification"
+
+	// notificationBufferSize is the number of notifications buffered before
+	// the session stops reading incoming messages.
+	notificationBufferSize = 64
+)
+
+// ErrSubscriptionActive is returned by RPCs sent while a subscription is
+// active on a session with a server not supporting :interleave, which only
+// processes close-session and kill-session until the subscription ends.
+var ErrSubscriptionActive = errors.New("netconf: subscription active")
+
+// Notification is an event notification received on a subscription (RFC5277)
+type Notification struct {
+	XMLName   xml.Name  `xml:"notification"`
+	EventTime time.Time `xml:"eventTime"`
+	// Event is the name of the element describing the event.
+	Event xml.Name `xml:"-"`
+	// Data is the content of the notification, eventTime included.
+	Data            string `xml:",innerxml"`
+	RawNotification string `xml:"-"`
+}
+
+func newNotification(rawXML []byte) (*Notification, error) {
+	n := &Notification{RawNotification: string(rawXML)}
+	if err := xml.Unmarshal(rawXML, n); err != nil {
+		return nil, err
+	}
+
+	// The event is the first child of the notification besides eventTime.
+	d := xml.NewDecoder(bytes.NewReader(rawXML))
+	depth := 0
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			break
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 2 && tok.Name.Local != "eventTime" {
+				n.Event = tok.Name
+				return n, nil
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+	return n, nil
+}
+
+// ReplayComplete reports whether n marks the end of the replayed events of a
+// subscription with a start time.
+func (n *Notification) ReplayComplete() bool {
+	return n.Event.Local == "replayComplete"
+}
+
+// NotificationComplete reports whether n marks the end of a subscription with
+// a stop time. No further notifications are sent on that subscription.
+func (n *Notification) NotificationComplete() bool {
+	return n.Event.Local == "notificationComplete"
+}
+
+// ConfirmedCommitEvent returns the confirm-event of a netconf-confirmed-commit
+// notification (RFC6470): "start", "cancel", "timeout", "extend" or
+// "complete", "timeout" meaning that a confirmed commit was reverted for lack
+// of confirmation. It returns an empty string for other notifications.
+func (n *Notification) ConfirmedCommitEvent() string {
+	if n.Event.Space != netconfNotificationsNamespace || n.Event.Local != "netconf-confirmed-commit" {
+		return ""
+	}
+
+	var event struct {
+		ConfirmEvent string `xml:"netconf-confirmed-commit>confirm-event"`
+	}
+	if err := xml.Unmarshal([]byte(n.RawNotification), &event); err != nil {
+		return ""
+	}
+	return event.ConfirmEvent
+}
+
+// CreateSubscription subscribes to the given event stream, or to the default
+// NETCONF stream when empty. startTime requests replay of past events and
+// stopTime, which requires a startTime, ends the subscription once reached.
+// filter is an optional subtree filter on the events.
+//
+// Notifications are delivered on the channel returned by Notifications, which
+// must be read continuously as replies to other RPCs are not received while
+// the channel is full. Other RPCs can be run during the subscription only when
+// the server advertises CapabilityInterleave (RFC5277 section 6); otherwise
+// they fail with ErrSubscriptionActive until it ends, but for Close and
+// KillSession.
+func (s *Session) CreateSubscription(stream string, startTime, stopTime *time.Time, filter string) error {
+	if stopTime != nil && startTime == nil {
+		return errors.New("netconf: subscription stop time requires a start time")
+	}
+
+	var buf bytes.Buffer
+	writeElement(&buf, "stream", stream)
+	if filter != "" {
+		fmt.Fprintf(&buf, `<filter type="subtree">%s</filter>`, filter)
+	}
+	if startTime != nil {
+		fmt.Fprintf(&buf, "<startTime>%s</startTime>", startTime.Format(time.RFC3339Nano))
+	}
+	if stopTime != nil {
+		fmt.Fprintf(&buf, "<stopTime>%s</stopTime>", stopTime.Format(time.RFC3339Nano))
+	}
+
+	// Create the channel before any notification can be read.
+	s.mu.Lock()
+	notifications := s.notifications
+	if notifications == nil {
+		s.notifications = make(chan Notification, notificationBufferSize)
+	}
+	s.mu.Unlock()
+
+	if _, err := s.Exec(RawMethod(fmt.Sprintf(notificationXml, buf.String()))); err != nil {
+		s.mu.Lock()
+		s.notifications = notifications
+		s.mu.Unlock()
+		return err
+	}
+
+	s.mu.Lock()
+	s.subscribed = s.notifications != nil
+	s.mu.Unlock()
+	return nil
+}
+
+// checkInterleave returns an error wrapping ErrSubscriptionActive when methods
+// can't be sent because of an active subscription.
+func (s *Session) checkInterleave(methods []RPCMethod) error {
+	s.mu.Lock()
+	subscribed := s.subscribed
+	s.mu.Unlock()
+	if !subscribed || hasCapability(s.ServerCapabilities, CapabilityInterleave) {
+		return nil
+	}
+
+	for _, method := range methods {
+		m, ok := unwrapMethod(method).(RawMethod)
+		if !ok || !strings.HasPrefix(string(m), "<close-session") && !strings.HasPrefix(string(m), "<kill-session") {
+			return fmt.Errorf("%w: the server doesn't support %s", ErrSubscriptionActive, CapabilityInterleave)
+		}
+	}
+	return nil
+}
+
+// StreamInfo describes an event stream a server offers for subscriptions.
+type StreamInfo struct {
+	Name        string `xml:"name"`
+	Description string `xml:"description"`
+	// ReplaySupport reports whether past events can be replayed with a start
+	// time, as far back as ReplayLogCreationTime.
+	ReplaySupport         bool      `xml:"replaySupport"`
+	ReplayLogCreationTime time.Time `xml:"replayLogCreationTime"`
+}
+
+// Streams returns the event streams the server offers for CreateSubscription.
+// They are listed in /netconf/streams, as defined by RFC5277 for servers
+// supporting notifications.
+func (s *Session) Streams() ([]StreamInfo, error) {
+	if err := requireCapability(s.ServerCapabilities, CapabilityNotification, "listing streams"); err != nil {
+		return nil, err
+	}
+
+	reply, err := s.Exec(MethodGet("subtree", fmt.Sprintf(`<netconf xmlns="%s"><streams/></netconf>`, streamsNamespace)))
+	if err != nil {
+		return nil, err
+	}
+
+	var data struct {
+		Streams []StreamInfo `xml:"netconf>streams>stream"`
+	}
+	if err := xml.Unmarshal([]byte(reply.Data), &data); err != nil {
+		return nil, err
+	}
+	return data.Streams, nil
+}
+
+// Notifications returns the channel notifications of the current subscription
+// are delivered on. The channel is closed when the subscription ends, i.e.
+// after its notificationComplete notification or when the session stops, and
+// is nil if there is no subscription.
+func (s *Session) Notifications() <-chan Notification {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.notifications
+}
+
+// notify delivers a notification read by the listening goroutine.
+func (s *Session) notify(rawXML []byte) {
+	n, err := newNotification(rawXML)
+	if err != nil {
+		logger(s.logger).Debugf("session %d: dropping unparsable notification: %v: %s", s.SessionID, err, rawXML)
+		return
+	}
+
+	s.mu.Lock()
+	notifications := s.notifications
+	s.mu.Unlock()
+	if notifications == nil {
+		return
+	}
+
+	notifications <- *n
+
+	if n.NotificationComplete() {
+		s.mu.Lock()
+		s.endSubscription()
+		s.mu.Unlock()
+	}
+}
+
+// endSubscription closes the notification channel. s.mu must be held.
+func (s *Session) endSubscription() {
+	if s.notifications != nil {
+		close(s.notifications)
+		s.notifications = nil
+	}
+	s.subscribed = false
+}
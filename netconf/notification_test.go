@@ -0,0 +1,254 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// sendNotification sends a notification for event from the server side.
+func sendNotification(st *TransportBasicIO, event string) error {
+	return st.Send([]byte(`<notification xmlns="urn:ietf:params:xml:ns:netconf:notification:1.0"><eventTime>2020-01-01T00:00:00Z</eventTime>` + event + `</notification>`))
+}
+
+func TestNewNotification(t *testing.T) {
+	rawXML := `<notification xmlns="urn:ietf:params:xml:ns:netconf:notification:1.0">
+<eventTime>2007-07-08T00:01:00Z</eventTime>
+<event xmlns="http://example.com/event/1.0"><eventClass>fault</eventClass></event>
+</notification>`
+
+	n, err := newNotification([]byte(rawXML))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !n.EventTime.Equal(time.Date(2007, 7, 8, 0, 1, 0, 0, time.UTC)) {
+		t.Errorf("unexpected event time %v", n.EventTime)
+	}
+	if expected := (xml.Name{Space: "http://example.com/event/1.0", Local: "event"}); n.Event != expected {
+		t.Errorf("unexpected event %v, want %v", n.Event, expected)
+	}
+	if n.RawNotification != rawXML {
+		t.Errorf("unexpected raw notification %q", n.RawNotification)
+	}
+}
+
+func TestSubscription(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	stop := start.Add(time.Hour)
+	requests := make(chan string, 2)
+
+	caps := append([]string{CapabilityNotification, CapabilityInterleave}, DefaultCapabilities...)
+	s := newSessionTest(t, caps, func(st *TransportBasicIO) {
+		req, _ := st.Receive()
+		requests <- string(req)
+		replyTo(st, req, "<ok/>")
+
+		sendNotification(st, "<event>one</event>")
+		sendNotification(st, "<replayComplete/>")
+
+		req, _ = st.Receive()
+		requests <- string(req)
+		sendNotification(st, "<event>two</event>")
+		replyTo(st, req, "<data/>")
+		sendNotification(st, "<notificationComplete/>")
+		st.Receive()
+	})
+	defer s.Close()
+
+	if err := s.CreateSubscription("NETCONF", &start, &stop, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if req := <-requests; !strings.Contains(req, "<create-subscription xmlns=\"urn:ietf:params:xml:ns:netconf:notification:1.0\"><stream>NETCONF</stream><startTime>2020-01-01T00:00:00Z</startTime><stopTime>2020-01-01T01:00:00Z</stopTime></create-subscription>") {
+		t.Errorf("unexpected request %s", req)
+	}
+	// The subscription may end, and Notifications return nil, as soon as the
+	// reply below has been received.
+	notifications := s.Notifications()
+
+	reply, err := s.Exec(MethodGetConfig("running"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reply.Data != "<data/>" {
+		t.Errorf("unexpected reply %q", reply.Data)
+	}
+	<-requests
+
+	var events []string
+	for n := range notifications {
+		events = append(events, n.Event.Local)
+	}
+	if got := strings.Join(events, ","); got != "event,replayComplete,event,notificationComplete" {
+		t.Errorf("unexpected events %s", got)
+	}
+}
+
+// chanLogger sends the debug messages it receives on its channel, dropping
+// them when it is full, for loggers used from the listening goroutine.
+type chanLogger chan string
+
+func (l chanLogger) Debugf(format string, args ...interface{}) {
+	select {
+	case l <- fmt.Sprintf(format, args...):
+	default:
+	}
+}
+
+func (l chanLogger) Tracef(format string, args ...interface{}) {}
+
+func TestUnparsableNotification(t *testing.T) {
+	s := newSessionTest(t, append([]string{CapabilityNotification}, DefaultCapabilities...), func(st *TransportBasicIO) {
+		req, _ := st.Receive()
+		replyTo(st, req, "<ok/>")
+		st.Send([]byte(`<notification xmlns="urn:ietf:params:xml:ns:netconf:notification:1.0"><eventTime>yesterday</eventTime><event>bad</event></notification>`))
+		sendNotification(st, "<event>good</event>")
+		st.Receive()
+	})
+	defer s.Close()
+	log := make(chanLogger, 1)
+	s.SetLogger(log)
+
+	if err := s.CreateSubscription("", nil, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case n := <-s.Notifications():
+		if !strings.Contains(n.RawNotification, "<event>good</event>") {
+			t.Errorf("unexpected notification %q", n.RawNotification)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the notification after the unparsable one to be delivered")
+	}
+	select {
+	case msg := <-log:
+		if !strings.Contains(msg, "dropping unparsable notification") || !strings.Contains(msg, "<eventTime>yesterday</eventTime>") {
+			t.Errorf("unexpected log message %q", msg)
+		}
+	default:
+		t.Error("expected the unparsable notification to be logged")
+	}
+}
+
+func TestSubscriptionWithoutInterleave(t *testing.T) {
+	requests := make(chan string, 3)
+	s := newSessionTest(t, append([]string{CapabilityNotification}, DefaultCapabilities...), func(st *TransportBasicIO) {
+		for {
+			req, err := st.Receive()
+			if err != nil {
+				return
+			}
+			requests <- requestBody(string(req))
+			replyTo(st, req, "<ok/>")
+			if strings.Contains(string(req), "<kill-session>") {
+				sendNotification(st, "<notificationComplete/>")
+			}
+		}
+	})
+	defer s.Close()
+
+	if err := s.CreateSubscription("", nil, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	notifications := s.Notifications()
+	<-requests
+
+	if _, err := s.Exec(MethodGetConfig("running")); !errors.Is(err, ErrSubscriptionActive) {
+		t.Errorf("expected ErrSubscriptionActive, got %v", err)
+	}
+	if err := s.KillSession(17); err != nil {
+		t.Errorf("expected kill-session to be sent, got %v", err)
+	}
+	if got := <-requests; got != "<kill-session><session-id>17</session-id></kill-session>" {
+		t.Errorf("unexpected request %s", got)
+	}
+
+	// RPCs can be run again once the subscription ended.
+	for range notifications {
+	}
+	if _, err := s.Exec(MethodGetConfig("running")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSubscriptionStopTimeWithoutStart(t *testing.T) {
+	s := &Session{}
+	stop := time.Now()
+	if err := s.CreateSubscription("", nil, &stop, ""); err == nil {
+		t.Errorf("expected error for stop time without start time")
+	}
+}
+
+func TestConfirmedCommitEvent(t *testing.T) {
+	tt := []struct {
+		name     string
+		rawXML   string
+		expected string
+	}{
+		{
+			name: "timeout",
+			rawXML: `<notification xmlns="urn:ietf:params:xml:ns:netconf:notification:1.0"><eventTime>2020-01-01T00:00:00Z</eventTime>
+<netconf-confirmed-commit xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-notifications"><confirm-event>timeout</confirm-event></netconf-confirmed-commit></notification>`,
+			expected: "timeout",
+		},
+		{
+			name:     "other event",
+			rawXML:   `<notification xmlns="urn:ietf:params:xml:ns:netconf:notification:1.0"><eventTime>2020-01-01T00:00:00Z</eventTime><event><confirm-event>timeout</confirm-event></event></notification>`,
+			expected: "",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			n, err := newNotification([]byte(tc.rawXML))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := n.ConfirmedCommitEvent(); got != tc.expected {
+				t.Errorf("got %q, expected %q", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestStreams(t *testing.T) {
+	caps := append([]string{CapabilityNotification}, DefaultCapabilities...)
+	requests := make(chan string, 1)
+	s := newSessionTest(t, caps, serveRequests(requests, `<data><netconf xmlns="urn:ietf:params:xml:ns:netmod:notification"><streams>
+<stream><name>NETCONF</name><description>default stream</description><replaySupport>true</replaySupport><replayLogCreationTime>2020-01-01T00:00:00Z</replayLogCreationTime></stream>
+<stream><name>vendor</name><description>vendor events</description><replaySupport>false</replaySupport></stream>
+</streams></netconf></data>`))
+	defer s.Close()
+
+	streams, err := s.Streams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := requestBody(<-requests), `<get><filter type="subtree"><netconf xmlns="urn:ietf:params:xml:ns:netmod:notification"><streams/></netconf></filter></get>`; got != want {
+		t.Errorf("unexpected request (want %q, got %q)", want, got)
+	}
+
+	expected := []StreamInfo{
+		{Name: "NETCONF", Description: "default stream", ReplaySupport: true, ReplayLogCreationTime: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{Name: "vendor", Description: "vendor events"},
+	}
+	if !cmp.Equal(streams, expected) {
+		t.Errorf("unexpected streams:\n%s", cmp.Diff(expected, streams))
+	}
+
+	if _, err := (&Session{}).Streams(); !errors.Is(err, ErrCapabilityNotSupported) {
+		t.Errorf("expected ErrCapabilityNotSupported, got %v", err)
+	}
+}
@@ -0,0 +1,308 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"crypto/tls"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Option configures how a session is established, see DialSSH.
+type Option func(*options)
+
+type options struct {
+	// subsystem is the SSH subsystem NETCONF is requested as.
+	subsystem string
+	// command is the command NETCONF is run over instead of a subsystem.
+	command string
+	// pty requests a pseudo-terminal for the SSH session.
+	pty bool
+	// keepaliveInterval is how often SSH keepalives are sent, none when zero.
+	keepaliveInterval time.Duration
+	// keepaliveMaxMissed is how many keepalives in a row may go unanswered.
+	keepaliveMaxMissed int
+	// sshConfig and tlsConfig are the configurations Dial connects with.
+	sshConfig *ssh.ClientConfig
+	tlsConfig *tls.Config
+	// dialer, when set, opens the connections to the device.
+	dialer *net.Dialer
+	// hostKeyCallback, when set, replaces the HostKeyCallback of sshConfig.
+	hostKeyCallback ssh.HostKeyCallback
+	// caps are the capabilities advertised, DefaultCapabilities when nil.
+	caps []string
+	// baseVersion is the only base protocol version advertised when set.
+	baseVersion string
+	// timeout is the Timeout of the session.
+	timeout time.Duration
+	// maxMessageSize limits the size of the messages received when set.
+	maxMessageSize int
+	// minChunkSize and maxChunkSize bound the size of the chunks sent when
+	// set.
+	minChunkSize, maxChunkSize int
+	// logger, when set, is the Logger of the session.
+	logger Logger
+	// readTimeout and writeTimeout are the ReadTimeout and WriteTimeout of
+	// the session.
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	// helloTimeout is how long the hello of the server is waited for, without
+	// limit when zero.
+	helloTimeout time.Duration
+	// spillOver is the size over which replies are written to disk by
+	// ExecStream.
+	spillOver int
+	// xmlHeader, when set, is the header starting every message sent.
+	xmlHeader *string
+	// frameEnd and sanitize are the FrameEnd and Sanitize of the transport.
+	frameEnd func([]byte) (int, int, error)
+	sanitize func([]byte) []byte
+}
+
+func newOptions(opts []Option) options {
+	o := options{subsystem: sshNetconfSubsystem, helloTimeout: DefaultHelloTimeout}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// dial connects to addr over TCP with the dialer of the options, its connection
+// attempt bounded by timeout unless the dialer has its own.
+func (o options) dial(addr string, timeout time.Duration) (net.Conn, error) {
+	d := net.Dialer{Timeout: timeout}
+	if o.dialer != nil {
+		d = *o.dialer
+		if d.Timeout == 0 {
+			d.Timeout = timeout
+		}
+	}
+	return d.Dial("tcp", addr)
+}
+
+// sshClientConfig returns config with the HostKeyCallback of the options, if
+// any.
+func (o options) sshClientConfig(config *ssh.ClientConfig) *ssh.ClientConfig {
+	if o.hostKeyCallback == nil {
+		return config
+	}
+	var c ssh.ClientConfig
+	if config != nil {
+		c = *config
+	}
+	c.HostKeyCallback = o.hostKeyCallback
+	return &c
+}
+
+// capabilities returns the capabilities the client advertises in its hello,
+// nil for DefaultCapabilities.
+func (o options) capabilities() []string {
+	if o.baseVersion == "" {
+		return o.caps
+	}
+
+	advertised := o.caps
+	if len(advertised) == 0 {
+		advertised = DefaultCapabilities
+	}
+	caps := []string{"urn:ietf:params:netconf:base:" + o.baseVersion}
+	for _, capability := range advertised {
+		if !strings.HasPrefix(capabilityURN(capability), "urn:ietf:params:netconf:base:") {
+			caps = append(caps, capability)
+		}
+	}
+	return caps
+}
+
+// WithSubsystem sets the SSH subsystem NETCONF is requested as, "netconf" by
+// default.
+func WithSubsystem(name string) Option {
+	return func(o *options) {
+		o.subsystem = name
+	}
+}
+
+// WithCommand runs NETCONF over the standard input and output of command, run
+// in the SSH session, instead of requesting the netconf subsystem. This is
+// for devices exposing NETCONF through a shell command only.
+func WithCommand(command string) Option {
+	return func(o *options) {
+		o.command = command
+	}
+}
+
+// WithPTY requests a pseudo-terminal, with echo disabled, for the SSH session
+// before starting NETCONF, for devices misbehaving without one.
+func WithPTY() Option {
+	return func(o *options) {
+		o.pty = true
+	}
+}
+
+// WithKeepalive sends a SSH keepalive every interval, to detect a device that
+// went away, e.g. after a NAT timeout or a reboot, while the session is idle.
+// Once maxMissed keepalives in a row went unanswered for interval the
+// transport is closed, failing reads and writes with an error wrapping
+// ErrTransportClosed. Keepalives are disabled by default.
+func WithKeepalive(interval time.Duration, maxMissed int) Option {
+	return func(o *options) {
+		if maxMissed < 1 {
+			maxMissed = 1
+		}
+		o.keepaliveInterval = interval
+		o.keepaliveMaxMissed = maxMissed
+	}
+}
+
+// WithSSHConfig sets the configuration Dial connects over SSH with, holding
+// the user and authentication methods, see SSHConfigAuth.
+func WithSSHConfig(config *ssh.ClientConfig) Option {
+	return func(o *options) {
+		o.sshConfig = config
+	}
+}
+
+// WithTLSConfig sets the configuration Dial connects over TLS with, see
+// TransportTLS.Dial.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(o *options) {
+		o.tlsConfig = config
+	}
+}
+
+// WithDialer sets the dialer opening the TCP connection to the device, e.g. to
+// choose the local address connections originate from with LocalAddr on
+// multi-homed hosts, or to set socket options with Control. The timeout of
+// the dialer, when set, takes precedence over that of the SSH configuration
+// or DialSSHTimeout.
+func WithDialer(d *net.Dialer) Option {
+	return func(o *options) {
+		o.dialer = d
+	}
+}
+
+// WithHostKeyCallback sets the callback checking the host key of the device,
+// replacing the HostKeyCallback of the SSH configuration, e.g. to share one
+// configuration between devices checked against different known hosts, see
+// KnownHostsCallback.
+func WithHostKeyCallback(callback ssh.HostKeyCallback) Option {
+	return func(o *options) {
+		o.hostKeyCallback = callback
+	}
+}
+
+// WithCapabilities advertises caps in the hello of the client instead of
+// DefaultCapabilities, as NewSessionWithCapabilities does. caps must include
+// the base protocol versions to use, unless ForceBaseVersion is given.
+func WithCapabilities(caps ...string) Option {
+	return func(o *options) {
+		o.caps = caps
+	}
+}
+
+// ForceBaseVersion advertises only the base protocol version, "1.0" or "1.1",
+// in the hello of the client, instead of both. Forcing "1.0" makes the session
+// use end of message markers whatever the server advertises, for devices
+// claiming base:1.1 while implementing chunked framing incorrectly.
+func ForceBaseVersion(version string) Option {
+	return func(o *options) {
+		o.baseVersion = version
+	}
+}
+
+// WithReadTimeout sets the ReadTimeout of the session: an RPC fails once no
+// data has been received for d while its reply is awaited, so that a device
+// taking minutes to reply, e.g. while committing, isn't given up on as long
+// as the reply keeps arriving.
+func WithReadTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.readTimeout = d
+	}
+}
+
+// WithWriteTimeout sets the WriteTimeout of the session: an RPC fails when its
+// request can't be sent within d.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.writeTimeout = d
+	}
+}
+
+// WithTimeout sets the time each RPC is given to complete, see
+// Session.SetTimeout.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+// WithMaxMessageSize limits the size of the messages received to n bytes, see
+// Session.SetMaxMessageSize. The hello of the server is limited as well.
+func WithMaxMessageSize(n int) Option {
+	return func(o *options) {
+		o.maxMessageSize = n
+	}
+}
+
+// WithChunkSize bounds the size of the chunks messages are sent in with 1.1
+// framing, tuned from min up to max to the throughput of the link, see
+// TransportBasicIO.MinChunkSize. WithChunkSize(n, n) pins the size to n.
+func WithChunkSize(min, max int) Option {
+	return func(o *options) {
+		o.minChunkSize = min
+		o.maxChunkSize = max
+	}
+}
+
+// WithLogger sets the Logger of the session and its transport, see
+// Session.SetLogger. The hellos exchanged are logged as well.
+func WithLogger(l Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+// WithHelloTimeout sets how long the hello of the server is waited for once
+// connected, DefaultHelloTimeout by default, so that a device accepting the
+// connection but never starting NETCONF fails the dial with ErrHelloTimeout
+// instead of hanging. Zero waits without limit. The timeouts of RPCs are set
+// separately, see WithReadTimeout.
+func WithHelloTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.helloTimeout = d
+	}
+}
+
+// WithXMLHeader makes every message sent start with header instead of only
+// the hello starting with xml.Header, an empty header omitting the XML
+// declaration altogether, see TransportBasicIO.SetXMLHeader.
+func WithXMLHeader(header string) Option {
+	return func(o *options) {
+		o.xmlHeader = &header
+	}
+}
+
+// WithFrameEnd sets the FrameEnd of the transport, replacing the detection of
+// the end of messages with 1.0 framing for devices whose framing doesn't
+// conform, see TransportBasicIO.
+func WithFrameEnd(f func(buf []byte) (end, next int, err error)) Option {
+	return func(o *options) {
+		o.frameEnd = f
+	}
+}
+
+// WithSanitizer sets the Sanitize of the transport, given each message
+// received to remove what some devices emit around it, such as trailing
+// prompts, before it is parsed, see TransportBasicIO.
+func WithSanitizer(f func(msg []byte) []byte) Option {
+	return func(o *options) {
+		o.sanitize = f
+	}
+}
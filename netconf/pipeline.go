@@ -0,0 +1,151 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Pipeline sends several RPCs on a session without waiting for the reply to
+// each before sending the next, as RFC6241 section 4.1 allows, saving a round
+// trip per RPC on high latency links. Replies are collected by message-id with
+// Receive once sent.
+//
+// The RPCs are sent in the order Send is called and servers reply to them in
+// that order. Replies are matched by message-id, so Receive can be called for
+// any pending message-id in any order: a reply arriving before it is asked for
+// is kept until Receive is called. A Pipeline is safe for concurrent use and
+// can be used along with Exec on the same session.
+type Pipeline struct {
+	s *Session
+
+	mu sync.Mutex
+	// pending holds the RPCs sent whose reply hasn't been received yet, by
+	// message-id.
+	pending map[string]*pipelined
+}
+
+// pipelined is an RPC sent whose reply is awaited.
+type pipelined struct {
+	replies chan []byte
+	sent    time.Time
+}
+
+// Pipeline returns a new Pipeline sending RPCs on the session.
+func (s *Session) Pipeline() *Pipeline {
+	return &Pipeline{
+		s:       s,
+		pending: make(map[string]*pipelined),
+	}
+}
+
+// Send sends an RPC made of methods without waiting for its reply, returning
+// its message-id to get the reply with Receive.
+func (p *Pipeline) Send(methods ...RPCMethod) (string, error) {
+	return p.SendContext(context.Background(), methods...)
+}
+
+// SendContext is like Send but gives up when ctx is done before the RPC has
+// been sent.
+func (p *Pipeline) SendContext(ctx context.Context, methods ...RPCMethod) (string, error) {
+	s := p.s
+	if err := s.begin(); err != nil {
+		return "", err
+	}
+	if err := s.validate(methods); err != nil {
+		s.end()
+		return "", err
+	}
+
+	rpc := NewRPCMessage(methods)
+	rpc.MessageID = s.nextMessageID()
+	replies := s.expect(rpc.MessageID)
+
+	if err := s.sendRPC(ctx, rpc); err != nil {
+		s.forget(rpc.MessageID)
+		s.end()
+		return "", err
+	}
+
+	p.mu.Lock()
+	p.pending[rpc.MessageID] = &pipelined{replies: replies, sent: time.Now()}
+	p.mu.Unlock()
+	return rpc.MessageID, nil
+}
+
+// Receive waits for the reply to the RPC sent with messageID, failing as Exec
+// does when the reply holds rpc-errors. It is not bound by the timeout of the
+// session: when ctx is done first, ctx.Err() is returned and the reply can
+// still be received later.
+func (p *Pipeline) Receive(ctx context.Context, messageID string) (*RPCReply, error) {
+	p.mu.Lock()
+	rpc, ok := p.pending[messageID]
+	p.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("netconf: no pipelined RPC pending with message-id %q", messageID)
+	}
+
+	rawXML, err := p.s.receive(ctx, rpc.replies)
+	if err != nil && ctx.Err() != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	_, ok = p.pending[messageID]
+	delete(p.pending, messageID)
+	p.mu.Unlock()
+	if !ok {
+		// Received concurrently.
+		return nil, fmt.Errorf("netconf: no pipelined RPC pending with message-id %q", messageID)
+	}
+	defer p.s.end()
+	if err != nil {
+		return nil, err
+	}
+	if _, id := parseMessageHeader(rawXML); id != "" && id != messageID {
+		return nil, fmt.Errorf("%w: sent %q, received %q", ErrMessageIDMismatch, messageID, id)
+	}
+
+	reply, err := newRPCReply(rawXML, p.s.ErrOnWarning, messageID)
+	_, failed := err.(*RPCErrors)
+	p.s.countReply(rpc.sent, failed)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// Pending returns the message-ids of the RPCs sent whose reply hasn't been
+// received yet, in no particular order.
+func (p *Pipeline) Pending() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ids := make([]string, 0, len(p.pending))
+	for id := range p.pending {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Close gives up on the replies not received yet, which are dropped when they
+// arrive. The session is left open.
+func (p *Pipeline) Close() error {
+	p.mu.Lock()
+	pending := p.pending
+	p.pending = make(map[string]*pipelined)
+	p.mu.Unlock()
+
+	for id := range pending {
+		p.s.forget(id)
+		p.s.end()
+	}
+	return nil
+}
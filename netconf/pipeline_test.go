@@ -0,0 +1,93 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPipeline(t *testing.T) {
+	// Reply to three requests once all are received, the last one first,
+	// then to the next one once released.
+	release := make(chan struct{})
+	s := newSessionTest(t, DefaultCapabilities, func(st *TransportBasicIO) {
+		var requests [][]byte
+		for len(requests) < 3 {
+			req, err := st.Receive()
+			if err != nil {
+				return
+			}
+			requests = append(requests, req)
+		}
+		for i := len(requests) - 1; i >= 0; i-- {
+			replyTo(st, requests[i], fmt.Sprintf("<data><n>%d</n></data>", i))
+		}
+		req, err := st.Receive()
+		if err != nil {
+			return
+		}
+		<-release
+		replyTo(st, req, "<ok/>")
+		serveRequests(make(chan string), "<ok/>")(st)
+	})
+	defer s.Close()
+
+	p := s.Pipeline()
+	var ids []string
+	for i := 0; i < 3; i++ {
+		id, err := p.Send(MethodGetConfig("running"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if len(p.Pending()) != 3 {
+		t.Errorf("expected 3 pending RPCs, got %v", p.Pending())
+	}
+
+	for i, id := range ids {
+		reply, err := p.Receive(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := fmt.Sprintf("<data><n>%d</n></data>", i); reply.Data != expected || reply.MessageID != id {
+			t.Errorf("unexpected reply %q to message-id %s", reply.Data, reply.MessageID)
+		}
+	}
+	if len(p.Pending()) != 0 {
+		t.Errorf("expected no pending RPC, got %v", p.Pending())
+	}
+	if _, err := p.Receive(context.Background(), ids[0]); err == nil {
+		t.Error("expected an error receiving a reply twice")
+	}
+
+	// A reply not received in time can be received later.
+	id, err := p.Send(MethodGetConfig("running"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := p.Receive(ctx, id); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	close(release)
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if reply, err := p.Receive(ctx, id); err != nil || !reply.OK() {
+		t.Errorf("unexpected reply %v, %v", reply, err)
+	}
+
+	// The session remains usable.
+	if _, err := s.Exec(MethodGetConfig("running")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,213 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrPoolClosed is returned by Pool.Acquire once the pool is closed.
+var ErrPoolClosed = errors.New("netconf: pool closed")
+
+// Pool keeps sessions to a fleet of devices open for reuse, within limits on
+// the number of sessions per device and overall, as devices only accept a few
+// concurrent NETCONF sessions. A Pool is safe for concurrent use.
+type Pool struct {
+	// HealthCheck checks that an idle session still works before it is
+	// handed out again, those failing it being discarded. By default
+	// Session.Ping is run. It must be set before the pool is used.
+	HealthCheck func(ctx context.Context, s *Session) error
+
+	dial       func(host string) (*Session, error)
+	maxPerHost int
+	maxTotal   int
+
+	mu sync.Mutex
+	// idle holds the sessions released by host, open the number of sessions
+	// by host, in use or idle, and total their sum.
+	idle   map[string][]*Session
+	open   map[string]int
+	total  int
+	closed bool
+	// wake is closed when a session is released or discarded, for Acquire
+	// to try again.
+	wake chan struct{}
+}
+
+// NewPool returns a Pool opening sessions with dial, e.g. calling Dial with
+// the options of each host. At most maxPerHost sessions are open to each host
+// and maxTotal overall, zero meaning no limit.
+func NewPool(dial func(host string) (*Session, error), maxPerHost, maxTotal int) *Pool {
+	return &Pool{
+		dial:       dial,
+		maxPerHost: maxPerHost,
+		maxTotal:   maxTotal,
+		idle:       make(map[string][]*Session),
+		open:       make(map[string]int),
+		wake:       make(chan struct{}),
+	}
+}
+
+// Acquire returns a session to host, reusing an idle one that passes the
+// health check or opening a new one, and waiting for one to be released when
+// the limits are reached. release must be called once the session is no
+// longer used, to return it to the pool; the session must not be closed.
+func (p *Pool) Acquire(host string) (s *Session, release func(), err error) {
+	return p.AcquireContext(context.Background(), host)
+}
+
+// AcquireContext is like Acquire but gives up when ctx is done, which also
+// bounds the health check.
+func (p *Pool) AcquireContext(ctx context.Context, host string) (s *Session, release func(), err error) {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, nil, ErrPoolClosed
+		}
+
+		if idle := p.idle[host]; len(idle) > 0 {
+			s := idle[len(idle)-1]
+			p.idle[host] = idle[:len(idle)-1]
+			p.mu.Unlock()
+
+			if err := p.check(ctx, s); err != nil {
+				p.discard(host, s)
+				if ctx.Err() != nil {
+					return nil, nil, ctx.Err()
+				}
+				continue
+			}
+			return s, p.releaser(host, s), nil
+		}
+
+		if p.maxPerHost > 0 && p.open[host] >= p.maxPerHost {
+			wake := p.wake
+			p.mu.Unlock()
+			if err := waitWake(ctx, wake); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		if p.maxTotal > 0 && p.total >= p.maxTotal {
+			// Make room by closing an idle session to another host.
+			if evicted, evictedHost := p.evict(); evicted != nil {
+				p.mu.Unlock()
+				p.discard(evictedHost, evicted)
+				continue
+			}
+			wake := p.wake
+			p.mu.Unlock()
+			if err := waitWake(ctx, wake); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		p.open[host]++
+		p.total++
+		p.mu.Unlock()
+
+		s, err := p.dial(host)
+		if err != nil {
+			p.discard(host, nil)
+			return nil, nil, err
+		}
+		return s, p.releaser(host, s), nil
+	}
+}
+
+// waitWake waits for wake to be closed or ctx to be done.
+func waitWake(ctx context.Context, wake chan struct{}) error {
+	select {
+	case <-wake:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// check runs the health check on s.
+func (p *Pool) check(ctx context.Context, s *Session) error {
+	if p.HealthCheck != nil {
+		return p.HealthCheck(ctx, s)
+	}
+	return s.Ping(ctx)
+}
+
+// evict removes an idle session from the pool, returning it with its host, or
+// nil if there is none. p.mu must be held.
+func (p *Pool) evict() (*Session, string) {
+	for host, idle := range p.idle {
+		if len(idle) > 0 {
+			p.idle[host] = idle[:len(idle)-1]
+			return idle[len(idle)-1], host
+		}
+	}
+	return nil, ""
+}
+
+// releaser returns the function returning s to the pool, once.
+func (p *Pool) releaser(host string, s *Session) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			p.mu.Lock()
+			if p.closed {
+				p.mu.Unlock()
+				p.discard(host, s)
+				return
+			}
+			p.idle[host] = append(p.idle[host], s)
+			p.signal()
+			p.mu.Unlock()
+		})
+	}
+}
+
+// discard closes s, if any, and frees its place in the pool.
+func (p *Pool) discard(host string, s *Session) {
+	p.mu.Lock()
+	p.open[host]--
+	if p.open[host] == 0 {
+		delete(p.open, host)
+	}
+	p.total--
+	p.signal()
+	p.mu.Unlock()
+
+	if s != nil {
+		s.Close()
+	}
+}
+
+// signal wakes up the Acquire calls waiting for a session. p.mu must be held.
+func (p *Pool) signal() {
+	close(p.wake)
+	p.wake = make(chan struct{})
+}
+
+// Close closes the idle sessions and makes Acquire fail with ErrPoolClosed.
+// The sessions in use are closed once released.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	idle := p.idle
+	p.idle = make(map[string][]*Session)
+	p.signal()
+	p.mu.Unlock()
+
+	for host, sessions := range idle {
+		for _, s := range sessions {
+			p.discard(host, s)
+		}
+	}
+	return nil
+}
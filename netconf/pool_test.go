@@ -0,0 +1,130 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// poolServers dials test servers, keeping those of each host.
+type poolServers struct {
+	mu      sync.Mutex
+	servers map[string][]*TestServer
+}
+
+func (ps *poolServers) dial(host string) (*Session, error) {
+	srv := NewTestServer(func(rpc []byte) []byte {
+		return TestReply(rpc, "<data/>")
+	})
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.servers == nil {
+		ps.servers = make(map[string][]*TestServer)
+	}
+	ps.servers[host] = append(ps.servers[host], srv)
+	return NewSession(srv.Transport()), nil
+}
+
+func (ps *poolServers) dialed(host string) []*TestServer {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return ps.servers[host]
+}
+
+func TestPool(t *testing.T) {
+	var ps poolServers
+	p := NewPool(ps.dial, 1, 0)
+	defer p.Close()
+
+	s, release, err := p.Acquire("r1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The only session to r1 is in use.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, _, err := p.AcquireContext(ctx, "r1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected to wait for the session in use, got %v", err)
+	}
+
+	release()
+	reused, release, err := p.Acquire("r1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reused != s || len(ps.dialed("r1")) != 1 {
+		t.Errorf("expected the released session to be reused, %d dialed", len(ps.dialed("r1")))
+	}
+
+	// A session whose device went away fails the health check and is
+	// replaced.
+	release()
+	ps.dialed("r1")[0].Close()
+	replaced, release, err := p.Acquire("r1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	if replaced == s || len(ps.dialed("r1")) != 2 {
+		t.Errorf("expected a new session, %d dialed", len(ps.dialed("r1")))
+	}
+	if _, err := replaced.Exec(MethodGetConfig("running")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPoolMaxTotal(t *testing.T) {
+	var ps poolServers
+	p := NewPool(ps.dial, 0, 1)
+
+	_, release, err := p.Acquire("r1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan error, 1)
+	go func() {
+		_, release, err := p.Acquire("r2")
+		if err == nil {
+			release()
+		}
+		acquired <- err
+	}()
+
+	select {
+	case err := <-acquired:
+		t.Fatalf("expected to wait for a session to be released, got %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// The idle session to r1 is closed to make room for r2.
+	release()
+	if err := <-acquired; err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ps.dialed("r1")[0].Done():
+	case <-time.After(time.Second):
+		t.Error("expected the session to r1 to be closed")
+	}
+
+	p.Close()
+	if _, _, err := p.Acquire("r1"); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("expected ErrPoolClosed, got %v", err)
+	}
+	select {
+	case <-ps.dialed("r2")[0].Done():
+	case <-time.After(time.Second):
+		t.Error("expected the idle session to r2 to be closed with the pool")
+	}
+}
@@ -0,0 +1,181 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrNotReplayed is returned by ReconnectingSession when the connection was
+// lost during an RPC that is not idempotent: the session has reconnected but
+// the RPC, which the server may have run, is not sent again.
+var ErrNotReplayed = errors.New("netconf: reconnected but the RPC was not replayed")
+
+// ReconnectingSession runs RPCs on a session established again, hellos and
+// capabilities included, when its connection is lost.
+type ReconnectingSession struct {
+	// Backoff, when set, is called before each attempt to reconnect, attempt
+	// starting at 1, and returns how long to wait before it or a negative
+	// duration to give up. Without Backoff a single attempt is made at once.
+	Backoff func(attempt int) time.Duration
+
+	dial func() (*Session, error)
+
+	mu         sync.Mutex
+	session    *Session
+	reconnects int
+}
+
+// NewReconnectingSession establishes a session with dial, which is called
+// again each time the connection is lost, e.g.
+//
+//	NewReconnectingSession(func() (*Session, error) {
+//		return DialSSH(target, config)
+//	})
+func NewReconnectingSession(dial func() (*Session, error)) (*ReconnectingSession, error) {
+	s, err := dial()
+	if err != nil {
+		return nil, err
+	}
+	return &ReconnectingSession{dial: dial, session: s}, nil
+}
+
+// Session returns the current session, for its capabilities or operations
+// other than Exec. It changes when the connection is reestablished.
+func (r *ReconnectingSession) Session() *Session {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.session
+}
+
+// Reconnects returns the number of times the session has been established
+// again.
+func (r *ReconnectingSession) Reconnects() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reconnects
+}
+
+// Exec is like ExecContext without a context.
+func (r *ReconnectingSession) Exec(methods ...RPCMethod) (*RPCReply, error) {
+	return r.ExecContext(context.Background(), methods...)
+}
+
+// ExecContext runs the RPC on the current session. If the connection is lost
+// meanwhile the session is established again and the RPC sent again when all
+// methods are marked with Idempotent, otherwise the error wraps
+// ErrNotReplayed. ctx also bounds waiting to reconnect.
+func (r *ReconnectingSession) ExecContext(ctx context.Context, methods ...RPCMethod) (*RPCReply, error) {
+	s := r.Session()
+	reply, err := s.ExecContext(ctx, methods...)
+	if !connectionLost(err) {
+		return reply, err
+	}
+
+	if rerr := r.reconnect(ctx, s); rerr != nil {
+		return nil, fmt.Errorf("netconf: reconnecting after %v: %w", err, rerr)
+	}
+	if !idempotent(methods) {
+		return nil, fmt.Errorf("%w: %v", ErrNotReplayed, err)
+	}
+	return r.Session().ExecContext(ctx, methods...)
+}
+
+// Close closes the current session.
+func (r *ReconnectingSession) Close() error {
+	return r.Session().Close()
+}
+
+// reconnect establishes the session again in place of lost, unless that was
+// already done.
+func (r *ReconnectingSession) reconnect(ctx context.Context, lost *Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.session != lost {
+		return nil
+	}
+	lost.ForceClose()
+
+	for attempt := 1; ; attempt++ {
+		if r.Backoff != nil {
+			wait := r.Backoff(attempt)
+			if wait < 0 {
+				return fmt.Errorf("netconf: gave up reconnecting after %d attempts", attempt-1)
+			}
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			}
+		}
+
+		s, err := r.dial()
+		if err == nil {
+			r.session = s
+			r.reconnects++
+			return nil
+		}
+		if r.Backoff == nil {
+			return err
+		}
+	}
+}
+
+// connectionLost reports whether err is the session losing its connection,
+// in the middle of a message or between messages.
+func connectionLost(err error) bool {
+	return errors.Is(err, ErrTransportClosed) || errors.Is(err, io.EOF)
+}
+
+// idempotentMethod marks an RPCMethod as safe to send again.
+type idempotentMethod struct {
+	RPCMethod
+}
+
+// Idempotent marks method as safe to send again when the connection is lost
+// before its reply is received, such as get or get-config, for
+// ReconnectingSession to replay it.
+func Idempotent(method RPCMethod) RPCMethod {
+	return idempotentMethod{method}
+}
+
+func (m idempotentMethod) validate(caps []string) error {
+	if v, ok := m.RPCMethod.(capabilityValidator); ok {
+		return v.validate(caps)
+	}
+	return nil
+}
+
+// unwrapMethod returns the method marked with Idempotent, method itself when
+// it isn't, for checking the interfaces and types of methods.
+func unwrapMethod(method RPCMethod) RPCMethod {
+	for {
+		m, ok := method.(idempotentMethod)
+		if !ok {
+			return method
+		}
+		method = m.RPCMethod
+	}
+}
+
+// idempotent reports whether all methods are marked with Idempotent.
+func idempotent(methods []RPCMethod) bool {
+	for _, method := range methods {
+		if _, ok := method.(idempotentMethod); !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,122 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newDroppingServers returns a dial function whose first server drops the
+// connection on the first RPC, later ones replying with data.
+func newDroppingServers() func() (*Session, error) {
+	dials := 0
+	return func() (*Session, error) {
+		dials++
+		var srv *TestServer
+		if dials == 1 {
+			srv = NewTestServer(func(rpc []byte) []byte {
+				srv.Close()
+				return nil
+			})
+		} else {
+			srv = NewTestServer(func(rpc []byte) []byte {
+				return TestReply(rpc, "<data/>")
+			})
+		}
+		return NewSession(srv.Transport()), nil
+	}
+}
+
+func TestReconnectingSession(t *testing.T) {
+	r, err := NewReconnectingSession(newDroppingServers())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	reply, err := r.Exec(Idempotent(MethodGetConfig("running")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Data != "<data/>" || r.Reconnects() != 1 {
+		t.Errorf("unexpected reply %q after %d reconnects", reply.Data, r.Reconnects())
+	}
+
+	r, err = NewReconnectingSession(newDroppingServers())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if _, err := r.Exec(MethodEditConfig("candidate", "<config/>")); !errors.Is(err, ErrNotReplayed) {
+		t.Errorf("expected ErrNotReplayed, got %v", err)
+	}
+	if r.Reconnects() != 1 {
+		t.Errorf("expected 1 reconnect, got %d", r.Reconnects())
+	}
+	if _, err := r.Exec(MethodEditConfig("candidate", "<config/>")); err != nil {
+		t.Errorf("expected the new session to be usable, got %v", err)
+	}
+}
+
+func TestReconnectingSessionBackoff(t *testing.T) {
+	dial := newDroppingServers()
+	dialErr := errors.New("unreachable")
+	first := true
+	r, err := NewReconnectingSession(func() (*Session, error) {
+		if first {
+			first = false
+			return dial()
+		}
+		return nil, dialErr
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var attempts []int
+	r.Backoff = func(attempt int) time.Duration {
+		if attempt > 3 {
+			return -1
+		}
+		attempts = append(attempts, attempt)
+		return time.Millisecond
+	}
+
+	if _, err := r.Exec(Idempotent(MethodGetConfig("running"))); err == nil {
+		t.Error("expected giving up reconnecting to fail the RPC")
+	}
+	if len(attempts) != 3 || r.Reconnects() != 0 {
+		t.Errorf("unexpected attempts %v and %d reconnects", attempts, r.Reconnects())
+	}
+}
+
+func TestIdempotentMethodInterfaces(t *testing.T) {
+	rpc := NewRPCMessage([]RPCMethod{Idempotent(RawMethodReader(strings.NewReader("<get/>")))})
+	if !rpc.streamed() {
+		t.Error("expected an idempotent RawMethodReader to be streamed")
+	}
+	var buf bytes.Buffer
+	if err := rpc.writeStream(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "<get/></rpc>") {
+		t.Errorf("unexpected request %s", buf.String())
+	}
+
+	s := &Session{subscribed: true, ServerCapabilities: DefaultCapabilities}
+	if err := s.checkInterleave([]RPCMethod{Idempotent(RawMethod("<kill-session><session-id>4</session-id></kill-session>"))}); err != nil {
+		t.Errorf("expected an idempotent kill-session to be allowed, got %v", err)
+	}
+	if err := s.checkInterleave([]RPCMethod{Idempotent(MethodGetConfig("running"))}); !errors.Is(err, ErrSubscriptionActive) {
+		t.Errorf("expected ErrSubscriptionActive, got %v", err)
+	}
+}
@@ -10,8 +10,10 @@ import (
 	"bytes"
 	"crypto/rand"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
+	"strings"
 )
 
 const (
@@ -27,6 +29,11 @@ const (
 type RPCMessage struct {
 	MessageID string
 	Methods   []RPCMethod
+	// Namespaces holds the xmlns:prefix declarations added to the rpc element
+	// by AddNamespace.
+	Namespaces []xml.Attr
+	// Attrs holds the other attributes added to the rpc element by SetAttr.
+	Attrs []xml.Attr
 }
 
 // NewRPCMessage generates a new RPC Message structure with the provided methods
@@ -37,6 +44,47 @@ func NewRPCMessage(methods []RPCMethod) *RPCMessage {
 	}
 }
 
+// AddNamespace declares the namespace uri with prefix on the rpc element, so
+// that methods such as XPath filters and vendor RPCs can refer to it. prefix
+// must not be empty, the default namespace being the NETCONF one. Adding a
+// prefix again replaces its namespace.
+func (m *RPCMessage) AddNamespace(prefix, uri string) {
+	name := xml.Name{Local: "xmlns:" + prefix}
+	for i := range m.Namespaces {
+		if m.Namespaces[i].Name == name {
+			m.Namespaces[i].Value = uri
+			return
+		}
+	}
+	m.Namespaces = append(m.Namespaces, xml.Attr{Name: name, Value: uri})
+}
+
+// SetAttr sets the attribute name of the rpc element to value, e.g. a trace
+// identifier for the audit log of the device. name is written as is: a
+// prefixed name refers to a namespace declared with AddNamespace, or with
+// SetAttr itself, an "xmlns:" prefixed name being passed on to AddNamespace.
+// message-id and the default namespace declaration are set by the session and
+// can't be set. Setting an attribute again replaces its value.
+func (m *RPCMessage) SetAttr(name, value string) error {
+	switch {
+	case name == "" || name == "message-id" || name == "xmlns":
+		return fmt.Errorf("netconf: rpc attribute %q can't be set", name)
+	case strings.HasPrefix(name, "xmlns:"):
+		m.AddNamespace(strings.TrimPrefix(name, "xmlns:"), value)
+		return nil
+	}
+
+	attrName := xml.Name{Local: name}
+	for i := range m.Attrs {
+		if m.Attrs[i].Name == attrName {
+			m.Attrs[i].Value = value
+			return nil
+		}
+	}
+	m.Attrs = append(m.Attrs, xml.Attr{Name: attrName, Value: value})
+	return nil
+}
+
 // MarshalXML marshals the NETCONF XML data
 func (m *RPCMessage) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 	var buf bytes.Buffer
@@ -45,60 +93,387 @@ func (m *RPCMessage) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 	}
 
 	data := struct {
-		MessageID string `xml:"message-id,attr"`
-		Xmlns     string `xml:"xmlns,attr"`
-		Methods   []byte `xml:",innerxml"`
+		Methods []byte `xml:",innerxml"`
 	}{
-		m.MessageID,
-		"urn:ietf:params:xml:ns:netconf:base:1.0",
 		buf.Bytes(),
 	}
 
 	// Wrap the raw XML (data) into <rpc>...</rpc> tags
 	start.Name.Local = "rpc"
+	start.Attr = append([]xml.Attr{
+		{Name: xml.Name{Local: "message-id"}, Value: m.MessageID},
+		{Name: xml.Name{Local: "xmlns"}, Value: "urn:ietf:params:xml:ns:netconf:base:1.0"},
+	}, m.attrs()...)
 	return e.EncodeElement(data, start)
 }
 
-// RPCReply defines a reply to a RPC request
+// attrs returns the attributes of the rpc element set by AddNamespace and
+// SetAttr, the namespace declarations first.
+func (m *RPCMessage) attrs() []xml.Attr {
+	return append(append([]xml.Attr(nil), m.Namespaces...), m.Attrs...)
+}
+
+// RPCReply defines a reply to a RPC request. RawReply holds the reply exactly
+// as received, for parsing what RPCReply doesn't model; a reply that can't be
+// parsed at all is returned in a ReplyParseError instead.
 type RPCReply struct {
-	XMLName   xml.Name   `xml:"rpc-reply"`
-	Errors    []RPCError `xml:"rpc-error,omitempty"`
-	Data      string     `xml:",innerxml"`
-	Ok        bool       `xml:",omitempty"`
-	RawReply  string     `xml:"-"`
-	MessageID string     `xml:"-"`
+	XMLName xml.Name   `xml:"rpc-reply"`
+	Errors  []RPCError `xml:"rpc-error,omitempty"`
+	Data    string     `xml:",innerxml"`
+	// Ok reports whether the reply holds an ok element, see OK.
+	Ok        bool   `xml:"-"`
+	RawReply  string `xml:"-"`
+	MessageID string `xml:"-"`
+}
+
+// ReplyParseError is returned when a reply isn't a valid rpc-reply.
+type ReplyParseError struct {
+	// Raw is the reply as received.
+	Raw []byte
+	Err error
+}
+
+func (e *ReplyParseError) Error() string {
+	return fmt.Sprintf("netconf: invalid rpc-reply: %v", e.Err)
+}
+
+func (e *ReplyParseError) Unwrap() error {
+	return e.Err
 }
 
 func newRPCReply(rawXML []byte, ErrOnWarning bool, messageID string) (*RPCReply, error) {
 	reply := &RPCReply{}
 	reply.RawReply = string(rawXML)
 
-	if err := xml.Unmarshal(rawXML, reply); err != nil {
-		return nil, err
+	parsed := struct {
+		*RPCReply
+		OkElement *struct{} `xml:"ok"`
+	}{RPCReply: reply}
+	if err := xml.Unmarshal(rawXML, &parsed); err != nil {
+		return nil, &ReplyParseError{Raw: rawXML, Err: err}
 	}
+	reply.Ok = parsed.OkElement != nil
 
 	// will return a valid reply so setting Requests message id
 	reply.MessageID = messageID
 
-	if reply.Errors != nil {
-		for _, rpcErr := range reply.Errors {
-			if rpcErr.Severity == "error" || ErrOnWarning {
-				return reply, &rpcErr
-			}
+	var errs []RPCError
+	for _, rpcErr := range reply.Errors {
+		if !rpcErr.IsWarning() || ErrOnWarning {
+			errs = append(errs, rpcErr)
 		}
 	}
+	if len(errs) > 0 {
+		return reply, &RPCErrors{errs: errs}
+	}
 
 	return reply, nil
 }
 
+// Body returns the content of the rpc-reply element as received, whatever its
+// elements: ok, data, rpc-errors or vendor specific ones, to be unmarshaled
+// into vendor structures. It is Data as bytes.
+func (r *RPCReply) Body() []byte {
+	return []byte(r.Data)
+}
+
+// Payload returns the elements the reply carries without the rpc-reply
+// envelope, for processing by other XML tools: the content of its data
+// element, or the vendor specific elements of replies without one. The
+// namespaces declared on the envelope are declared on each element instead,
+// the default one and the prefixes it uses, so that the elements stand on
+// their own. Payload returns
+// nil for replies without any, such as ok or rpc-error only replies.
+func (r *RPCReply) Payload() []byte {
+	var data, vendor bytes.Buffer
+	var replyScope, dataScope []xml.Attr
+	hasData, inData := false, false
+
+	// element is the payload element being read, if any, starting at start
+	// and written to out once read.
+	var element *xml.StartElement
+	var start int64
+	var elementDepth int
+	var out *bytes.Buffer
+	var scope []xml.Attr
+
+	d := xml.NewDecoder(strings.NewReader(r.RawReply))
+	depth := 0
+	for {
+		offset := d.InputOffset()
+		tok, err := d.RawToken()
+		if err != nil {
+			break
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			switch {
+			case depth == 1:
+				replyScope = namespaceDecls(t.Attr)
+			case depth == 2 && t.Name.Local == "data" && !hasData:
+				hasData, inData = true, true
+				dataScope = append(append([]xml.Attr(nil), replyScope...), namespaceDecls(t.Attr)...)
+			case depth == 2 && t.Name.Local != "ok" && t.Name.Local != "rpc-error":
+				element, start, out, scope = &t, offset, &vendor, replyScope
+				elementDepth = depth
+			case depth == 3 && inData:
+				element, start, out, scope = &t, offset, &data, dataScope
+				elementDepth = depth
+			}
+		case xml.EndElement:
+			switch {
+			case element != nil && depth == elementDepth:
+				writeStandalone(out, r.RawReply[start:d.InputOffset()], *element, scope)
+				element = nil
+			case depth == 2 && inData:
+				inData = false
+			}
+			depth--
+		}
+	}
+
+	payload := &data
+	if !hasData {
+		payload = &vendor
+	}
+	if payload.Len() == 0 {
+		return nil
+	}
+	return payload.Bytes()
+}
+
+// namespaceDecls returns the namespace declarations among the attributes of
+// an element read with RawToken.
+func namespaceDecls(attrs []xml.Attr) []xml.Attr {
+	var decls []xml.Attr
+	for _, attr := range attrs {
+		if attr.Name.Space == "xmlns" || attr.Name.Space == "" && attr.Name.Local == "xmlns" {
+			decls = append(decls, attr)
+		}
+	}
+	return decls
+}
+
+// writeStandalone writes the element raw, read with RawToken as start,
+// adding the declarations of scope it doesn't declare itself: the default
+// namespace and the prefixes it uses.
+func writeStandalone(w *bytes.Buffer, raw string, start xml.StartElement, scope []xml.Attr) {
+	declared := make(map[string]bool)
+	for _, attr := range namespaceDecls(start.Attr) {
+		declared[declPrefix(attr)] = true
+	}
+
+	var decls bytes.Buffer
+	// The last declaration of a prefix is the one in scope.
+	for i := len(scope) - 1; i >= 0; i-- {
+		prefix := declPrefix(scope[i])
+		if declared[prefix] {
+			continue
+		}
+		declared[prefix] = true
+
+		// The default namespace is always carried over, unprefixed
+		// descendants of a prefixed element being in it too.
+		if prefix != "" && !strings.Contains(raw, prefix+":") {
+			continue
+		}
+		decls.WriteString(" xmlns")
+		if prefix != "" {
+			decls.WriteString(":" + prefix)
+		}
+		decls.WriteString(`="`)
+		xml.EscapeText(&decls, []byte(scope[i].Value))
+		decls.WriteString(`"`)
+	}
+
+	name := start.Name.Local
+	if start.Name.Space != "" {
+		name = start.Name.Space + ":" + name
+	}
+	end := 1 + len(name)
+	w.WriteString(raw[:end])
+	w.Write(decls.Bytes())
+	w.WriteString(raw[end:])
+}
+
+// declPrefix returns the prefix a namespace declaration read with RawToken
+// is for, empty for the default namespace.
+func declPrefix(attr xml.Attr) string {
+	if attr.Name.Space == "xmlns" {
+		return attr.Name.Local
+	}
+	return ""
+}
+
+// OK reports whether the reply holds an ok element and no rpc-error of
+// severity error, as replies to operations such as edit-config or commit do
+// on success. It is false for replies holding data instead, whatever their
+// errors, for which HasError tells whether the operation failed.
+func (r *RPCReply) OK() bool {
+	return r.Ok && !r.HasError()
+}
+
+// HasError reports whether the reply holds an rpc-error of severity error.
+func (r *RPCReply) HasError() bool {
+	for i := range r.Errors {
+		if !r.Errors[i].IsWarning() {
+			return true
+		}
+	}
+	return false
+}
+
+// Warnings returns the rpc-errors of severity warning of the reply, which do
+// not make Exec fail unless the session has ErrOnWarning set.
+func (r *RPCReply) Warnings() []RPCError {
+	var warnings []RPCError
+	for _, rpcErr := range r.Errors {
+		if rpcErr.IsWarning() {
+			warnings = append(warnings, rpcErr)
+		}
+	}
+	return warnings
+}
+
 // RPCError defines an error reply to a RPC request
 type RPCError struct {
 	Type     string `xml:"error-type"`
 	Tag      string `xml:"error-tag"`
 	Severity string `xml:"error-severity"`
+	AppTag   string `xml:"error-app-tag"`
 	Path     string `xml:"error-path"`
 	Message  string `xml:"error-message"`
-	Info     string `xml:",innerxml"`
+	// Info is the content of the error-info element as received, raw XML.
+	Info string `xml:"-"`
+	// ErrorInfo is the error-info element, parsed.
+	ErrorInfo ErrorInfo `xml:"error-info"`
+}
+
+// UnmarshalXML decodes the rpc-error, keeping the content of its error-info
+// element in Info.
+func (re *RPCError) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type rpcError RPCError
+	var decoded struct {
+		rpcError
+		Inner string `xml:",innerxml"`
+	}
+	if err := d.DecodeElement(&decoded, &start); err != nil {
+		return err
+	}
+	*re = RPCError(decoded.rpcError)
+	re.Info = childInnerXML(decoded.Inner, "error-info")
+	return nil
+}
+
+// childInnerXML returns the content of the first child element of raw named
+// local, as raw XML.
+func childInnerXML(raw, local string) string {
+	d := xml.NewDecoder(strings.NewReader(raw))
+	depth := 0
+	var from int64 = -1
+	for {
+		tok, err := d.RawToken()
+		if err != nil {
+			return ""
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if depth == 0 && t.Name.Local == local {
+				from = d.InputOffset()
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+			if depth == 0 && from > -1 {
+				// The end tag is unknown when the element is empty.
+				end := d.InputOffset()
+				if i := strings.LastIndex(raw[:end], "</"); i >= int(from) {
+					return raw[from:i]
+				}
+				return ""
+			}
+		}
+	}
+}
+
+// ErrorInfo is the content of the error-info element of an rpc-error, whose
+// children depend on the error-tag (RFC6241 appendix A). For a lock-denied
+// error, SessionID is the session holding the lock, which KillSession can
+// terminate:
+//
+//	var rpcErr *netconf.RPCError
+//	if errors.As(err, &rpcErr) && rpcErr.Tag == "lock-denied" && rpcErr.ErrorInfo.SessionID != 0 {
+//		err = s.KillSession(rpcErr.ErrorInfo.SessionID)
+//	}
+type ErrorInfo struct {
+	BadAttribute string `xml:"bad-attribute"`
+	BadElement   string `xml:"bad-element"`
+	BadNamespace string `xml:"bad-namespace"`
+	// SessionID is the session holding the lock or resource of a
+	// lock-denied or in-use error, zero when it isn't held by a NETCONF
+	// session.
+	SessionID   int    `xml:"session-id"`
+	OkElement   string `xml:"ok-element"`
+	ErrElement  string `xml:"err-element"`
+	NoopElement string `xml:"noop-element"`
+	// Other holds the other children, such as vendor specific ones, as raw
+	// XML.
+	Other string `xml:"-"`
+}
+
+// UnmarshalXML decodes the children defined by RFC6241 into their fields and
+// keeps the others in Other.
+func (i *ErrorInfo) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type errorInfo ErrorInfo
+	var info struct {
+		errorInfo
+		Inner string `xml:",innerxml"`
+	}
+	if err := d.DecodeElement(&info, &start); err != nil {
+		return err
+	}
+	*i = ErrorInfo(info.errorInfo)
+
+	var other bytes.Buffer
+	raw := xml.NewDecoder(strings.NewReader(info.Inner))
+	depth := 0
+	var from int64
+	for {
+		offset := raw.InputOffset()
+		tok, err := raw.RawToken()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if depth == 0 {
+				from = offset
+				if isErrorInfoField(t.Name.Local) {
+					from = -1
+				}
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+			if depth == 0 && from > -1 {
+				other.WriteString(info.Inner[from:raw.InputOffset()])
+			}
+		}
+	}
+	i.Other = other.String()
+	return nil
+}
+
+// isErrorInfoField reports whether name is a child of error-info defined by
+// RFC6241.
+func isErrorInfoField(name string) bool {
+	switch name {
+	case "bad-attribute", "bad-element", "bad-namespace", "session-id", "ok-element", "err-element", "noop-element":
+		return true
+	}
+	return false
 }
 
 // Error generates a string representation of the provided RPC error
@@ -106,6 +481,64 @@ func (re *RPCError) Error() string {
 	return fmt.Sprintf("netconf rpc [%s] '%s'", re.Severity, re.Message)
 }
 
+// IsWarning reports whether the error has severity warning.
+func (re *RPCError) IsWarning() bool {
+	return re.Severity == "warning"
+}
+
+// Is reports whether target is an *RPCError whose non-empty Type, Tag,
+// Severity and AppTag equal those of re, so that errors.Is(err,
+// &RPCError{Tag: "lock-denied"}) matches any lock-denied error.
+func (re *RPCError) Is(target error) bool {
+	t, ok := target.(*RPCError)
+	if !ok {
+		return false
+	}
+	return (t.Type == "" || t.Type == re.Type) &&
+		(t.Tag == "" || t.Tag == re.Tag) &&
+		(t.Severity == "" || t.Severity == re.Severity) &&
+		(t.AppTag == "" || t.AppTag == re.AppTag)
+}
+
+// RPCErrors is the error returned by Exec when a reply holds rpc-errors of
+// severity error, or of severity warning with ErrOnWarning set. errors.Is
+// matches any of them and errors.As to an *RPCError yields the first one.
+type RPCErrors struct {
+	errs []RPCError
+}
+
+// Errors returns the rpc-errors making up e.
+func (e *RPCErrors) Errors() []RPCError {
+	return e.errs
+}
+
+func (e *RPCErrors) Error() string {
+	msgs := make([]string, len(e.errs))
+	for i := range e.errs {
+		msgs[i] = e.errs[i].Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Is reports whether any of the rpc-errors matches target.
+func (e *RPCErrors) Is(target error) bool {
+	for i := range e.errs {
+		if errors.Is(&e.errs[i], target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As sets target to the first rpc-error when it is an **RPCError.
+func (e *RPCErrors) As(target interface{}) bool {
+	if t, ok := target.(**RPCError); ok && len(e.errs) > 0 {
+		*t = &e.errs[0]
+		return true
+	}
+	return false
+}
+
 // RPCMethod defines the interface for creating an RPC method.
 type RPCMethod interface {
 	MarshalMethod() string
@@ -119,6 +552,81 @@ func (r RawMethod) MarshalMethod() string {
 	return string(r)
 }
 
+// streamMethod is implemented by RPC methods able to write themselves to the
+// transport as they are produced instead of being marshaled whole first.
+type streamMethod interface {
+	writeMethod(w io.Writer) error
+}
+
+type readerMethod struct {
+	r io.Reader
+}
+
+// RawMethodReader returns a raw method whose XML is read from r, for requests
+// too large to be held in memory such as the edit-config of a whole
+// configuration. The XML is streamed to the transport as it is read, in chunks
+// with 1.1 framing. The reader is consumed by the first Exec of the method.
+// If reading it fails part way, the request can't be completed and the
+// transport is closed.
+func RawMethodReader(r io.Reader) RPCMethod {
+	return &readerMethod{r: r}
+}
+
+// MarshalMethod reads the whole XML of the method.
+func (m *readerMethod) MarshalMethod() string {
+	var buf strings.Builder
+	io.Copy(&buf, m.r)
+	return buf.String()
+}
+
+func (m *readerMethod) writeMethod(w io.Writer) error {
+	_, err := io.Copy(w, m.r)
+	return err
+}
+
+// streamed reports whether some of the methods of m are to be streamed.
+func (m *RPCMessage) streamed() bool {
+	for _, method := range m.Methods {
+		if _, ok := unwrapMethod(method).(streamMethod); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// writeStream writes the rpc element to w as MarshalXML would, streaming the
+// methods which support it.
+func (m *RPCMessage) writeStream(w io.Writer) error {
+	var buf bytes.Buffer
+	buf.WriteString(`<rpc message-id="`)
+	xml.EscapeText(&buf, []byte(m.MessageID))
+	buf.WriteString(`" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"`)
+	for _, attr := range m.attrs() {
+		buf.WriteString(" " + attr.Name.Local + `="`)
+		xml.EscapeText(&buf, []byte(attr.Value))
+		buf.WriteString(`"`)
+	}
+	buf.WriteString(">")
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+
+	for _, method := range m.Methods {
+		if sm, ok := unwrapMethod(method).(streamMethod); ok {
+			if err := sm.writeMethod(w); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := io.WriteString(w, method.MarshalMethod()); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, "</rpc>")
+	return err
+}
+
 // MethodLock files a NETCONF lock target request with the remote host
 func MethodLock(target string) RawMethod {
 	return RawMethod(fmt.Sprintf("<lock><target><%s/></target></lock>", target))
@@ -144,6 +652,140 @@ func MethodEditConfig(database string, dataXml string) RawMethod {
 	return RawMethod(fmt.Sprintf(editConfigXml, database, dataXml))
 }
 
+// MethodWithNamespace returns a method calling the operation name defined in
+// namespace, such as a vendor specific RPC, with inner as its content:
+//
+//	MethodWithNamespace("get-interface-information", "http://xml.juniper.net/junos/*/junos-interface", "<terse/>")
+//
+// The content of the rpc-reply is returned verbatim in RPCReply.Data, whatever
+// its namespace, to be unmarshaled as the vendor structure.
+func MethodWithNamespace(name, namespace, inner string) RPCMethod {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<%s xmlns="`, name)
+	xml.EscapeText(&buf, []byte(namespace))
+	if inner == "" {
+		buf.WriteString(`"/>`)
+	} else {
+		fmt.Fprintf(&buf, `">%s</%s>`, inner, name)
+	}
+	return RawMethod(buf.String())
+}
+
+// DefaultOperation is the default operation of an edit-config request
+type DefaultOperation string
+
+// Default operations defined by RFC6241
+const (
+	DefaultOperationMerge   DefaultOperation = "merge"
+	DefaultOperationReplace DefaultOperation = "replace"
+	DefaultOperationNone    DefaultOperation = "none"
+)
+
+// TestOption is the test option of an edit-config request
+type TestOption string
+
+// Test options defined by RFC6241
+const (
+	TestOptionTestThenSet TestOption = "test-then-set"
+	TestOptionSet         TestOption = "set"
+	TestOptionTestOnly    TestOption = "test-only"
+)
+
+// ErrorOption is the error option of an edit-config request
+type ErrorOption string
+
+// Error options defined by RFC6241
+const (
+	ErrorOptionStopOnError     ErrorOption = "stop-on-error"
+	ErrorOptionContinueOnError ErrorOption = "continue-on-error"
+	ErrorOptionRollbackOnError ErrorOption = "rollback-on-error"
+)
+
+// EditConfigOptions holds the optional parameters of an edit-config request.
+// Parameters left empty are omitted, leaving the server default in effect.
+type EditConfigOptions struct {
+	DefaultOperation DefaultOperation
+	TestOption       TestOption
+	ErrorOption      ErrorOption
+}
+
+type editConfig struct {
+	target Datastore
+	config string
+	// source is the URL the config is loaded from instead, when set.
+	source Datastore
+	opts   EditConfigOptions
+}
+
+// EditConfig returns an edit-config request loading config into target.
+// Options requiring a capability the server did not advertise, such as the
+// rollback-on-error error option, make Exec fail without sending the request.
+func EditConfig(target Datastore, config string, opts EditConfigOptions) RPCMethod {
+	return &editConfig{target: target, config: config, opts: opts}
+}
+
+// EditConfigURL is like EditConfig but loads the config held in the file at
+// source, a URL, on servers supporting the :url capability with its scheme.
+func EditConfigURL(target, source Datastore, opts EditConfigOptions) RPCMethod {
+	return &editConfig{target: target, source: source, opts: opts}
+}
+
+// MarshalMethod converts the method's output into a string
+func (m *editConfig) MarshalMethod() string {
+	var buf bytes.Buffer
+
+	// The order of the parameters is mandated by the RFC6241 schema.
+	fmt.Fprintf(&buf, "<edit-config><target>%s</target>", m.target.element())
+	if m.opts.DefaultOperation != "" {
+		fmt.Fprintf(&buf, "<default-operation>%s</default-operation>", m.opts.DefaultOperation)
+	}
+	if m.opts.TestOption != "" {
+		fmt.Fprintf(&buf, "<test-option>%s</test-option>", m.opts.TestOption)
+	}
+	if m.opts.ErrorOption != "" {
+		fmt.Fprintf(&buf, "<error-option>%s</error-option>", m.opts.ErrorOption)
+	}
+	if m.source != "" {
+		buf.WriteString(m.source.element())
+	} else {
+		fmt.Fprintf(&buf, "<config>%s</config>", m.config)
+	}
+	buf.WriteString("</edit-config>")
+
+	return buf.String()
+}
+
+func (m *editConfig) validate(caps []string) error {
+	if m.source != "" && !m.source.IsURL() {
+		return errors.New("netconf: edit-config source must be a URL")
+	}
+	if err := validateDatastores(caps, m.target, m.source); err != nil {
+		return err
+	}
+	if m.opts.ErrorOption == ErrorOptionRollbackOnError {
+		if err := requireCapability(caps, CapabilityRollbackOnError, "rollback-on-error"); err != nil {
+			return err
+		}
+	}
+	if m.opts.TestOption != "" {
+		if err := requireCapability(caps, CapabilityValidate11, "test-option"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeElement writes an element named name holding the escaped text value
+// to buf, unless value is empty.
+func writeElement(buf *bytes.Buffer, name, value string) {
+	if value == "" {
+		return
+	}
+	fmt.Fprintf(buf, "<%s>", name)
+	xml.EscapeText(buf, []byte(value))
+	fmt.Fprintf(buf, "</%s>", name)
+}
+
 var msgID = uuid
 
 // uuid generates a "good enough" uuid without adding external dependencies
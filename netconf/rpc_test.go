@@ -8,7 +8,11 @@ package netconf
 
 import (
 	"bytes"
+	"context"
 	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -63,6 +67,84 @@ func TestRPCMessage(t *testing.T) {
 	}
 }
 
+func TestRPCMessageNamespaces(t *testing.T) {
+	msg := &RPCMessage{
+		MessageID: "101",
+		Methods:   []RPCMethod{RawMethod(`<get><filter type="xpath" select="/if:interfaces"/></get>`)},
+	}
+	msg.AddNamespace("if", "urn:ietf:params:xml:ns:yang:ietf-interfaces")
+	msg.AddNamespace("ex", "urn:old")
+	msg.AddNamespace("ex", "urn:example")
+
+	want := `<rpc message-id="101" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" xmlns:if="urn:ietf:params:xml:ns:yang:ietf-interfaces" xmlns:ex="urn:example"><get><filter type="xpath" select="/if:interfaces"/></get></rpc>`
+
+	xmlOut, err := xml.Marshal(msg)
+	if err != nil {
+		t.Fatalf("failed to marshal xml: %v", err)
+	}
+	if string(xmlOut) != want {
+		t.Errorf("unexpected xml output (want %q, got %q)", want, xmlOut)
+	}
+
+	var buf bytes.Buffer
+	if err := msg.writeStream(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != want {
+		t.Errorf("unexpected streamed output (want %q, got %q)", want, buf.String())
+	}
+
+	var sent []byte
+	srv := NewTestServer(func(rpc []byte) []byte {
+		sent = rpc
+		return TestReply(rpc, "<data/>")
+	})
+	defer srv.Close()
+	s := NewSession(srv.Transport())
+
+	if _, err := s.ExecRPC(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(sent, []byte(`xmlns:ex="urn:example">`)) || msg.MessageID == "101" {
+		t.Errorf("unexpected rpc sent %q", sent)
+	}
+}
+
+func TestExecWithAttrs(t *testing.T) {
+	var sent [][]byte
+	srv := NewTestServer(func(rpc []byte) []byte {
+		sent = append(sent, rpc)
+		return TestReply(rpc, "<ok/>")
+	})
+	defer srv.Close()
+	s := NewSession(srv.Transport())
+	defer s.Close()
+
+	attrs := map[string]string{
+		"xmlns:t":    "urn:example:trace",
+		"t:trace-id": `a&"b"`,
+		"audit":      "yes",
+	}
+	for _, method := range []RPCMethod{RawMethod("<get/>"), RawMethodReader(strings.NewReader("<get/>"))} {
+		if _, err := s.ExecWithAttrs(attrs, method); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, rpc := range sent {
+		_, id := parseMessageHeader(rpc)
+		want := `<rpc message-id="` + id + `" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" xmlns:t="urn:example:trace" audit="yes" t:trace-id="a&amp;&#34;b&#34;"><get/></rpc>`
+		if string(rpc) != want {
+			t.Errorf("unexpected rpc (want %q, got %q)", want, rpc)
+		}
+	}
+
+	for _, name := range []string{"message-id", "xmlns", ""} {
+		if _, err := s.ExecWithAttrs(map[string]string{name: "x"}, RawMethod("<get/>")); err == nil {
+			t.Errorf("expected an error setting %q", name)
+		}
+	}
+}
+
 func TestRPCErrorError(t *testing.T) {
 	rpcErr := RPCError{
 		Severity: "lol",
@@ -76,6 +158,94 @@ func TestRPCErrorError(t *testing.T) {
 	}
 }
 
+func TestRPCErrorInfo(t *testing.T) {
+	rawXML := []byte(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" xmlns:junos="http://xml.juniper.net/junos/*/junos">
+<rpc-error><error-type>protocol</error-type><error-tag>lock-denied</error-tag><error-severity>error</error-severity><error-info><session-id>454</session-id></error-info></rpc-error>
+<rpc-error><error-type>application</error-type><error-tag>unknown-element</error-tag><error-severity>error</error-severity><error-info><bad-element>mtu</bad-element><junos:re-name>re0</junos:re-name><detail><a/></detail></error-info></rpc-error>
+</rpc-reply>`)
+
+	_, err := newRPCReply(rawXML, false, "1")
+	var rpcErrs *RPCErrors
+	if !errors.As(err, &rpcErrs) || len(rpcErrs.Errors()) != 2 {
+		t.Fatalf("expected 2 rpc-errors, got %v", err)
+	}
+
+	expected := []ErrorInfo{
+		{SessionID: 454},
+		{BadElement: "mtu", Other: "<junos:re-name>re0</junos:re-name><detail><a/></detail>"},
+	}
+	for i, rpcErr := range rpcErrs.Errors() {
+		if rpcErr.ErrorInfo != expected[i] {
+			t.Errorf("unexpected error-info %+v, expected %+v", rpcErr.ErrorInfo, expected[i])
+		}
+	}
+
+	raw := []string{
+		"<session-id>454</session-id>",
+		"<bad-element>mtu</bad-element><junos:re-name>re0</junos:re-name><detail><a/></detail>",
+	}
+	for i, rpcErr := range rpcErrs.Errors() {
+		if rpcErr.Info != raw[i] {
+			t.Errorf("unexpected raw error-info %q, expected %q", rpcErr.Info, raw[i])
+		}
+	}
+
+	var rpcErr RPCError
+	if err := xml.Unmarshal([]byte(`<rpc-error><error-tag>in-use</error-tag><error-info/></rpc-error>`), &rpcErr); err != nil {
+		t.Fatal(err)
+	}
+	if rpcErr.Tag != "in-use" || rpcErr.Info != "" {
+		t.Errorf("unexpected rpc-error %+v", rpcErr)
+	}
+}
+
+func TestRPCReplyErrors(t *testing.T) {
+	rawXML := []byte(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">
+<rpc-error><error-type>application</error-type><error-tag>operation-failed</error-tag><error-severity>warning</error-severity><error-message>deprecated</error-message></rpc-error>
+<rpc-error><error-type>protocol</error-type><error-tag>lock-denied</error-tag><error-severity>error</error-severity><error-app-tag>locked-by-other</error-app-tag><error-message>locked</error-message></rpc-error>
+<rpc-error><error-type>application</error-type><error-tag>invalid-value</error-tag><error-severity>error</error-severity><error-path>/a/b</error-path><error-message>bad</error-message></rpc-error>
+</rpc-reply>`)
+
+	reply, err := newRPCReply(rawXML, false, "1")
+	if !reply.HasError() {
+		t.Error("expected HasError")
+	}
+	if w := reply.Warnings(); len(w) != 1 || w[0].Message != "deprecated" {
+		t.Errorf("unexpected warnings %v", w)
+	}
+
+	var rpcErrs *RPCErrors
+	if !errors.As(err, &rpcErrs) {
+		t.Fatalf("expected RPCErrors, got %v", err)
+	}
+	if n := len(rpcErrs.Errors()); n != 2 {
+		t.Errorf("expected 2 errors, got %d", n)
+	}
+	if got, want := err.Error(), "netconf rpc [error] 'locked'; netconf rpc [error] 'bad'"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.AppTag != "locked-by-other" {
+		t.Errorf("expected the lock-denied error, got %v", rpcErr)
+	}
+	if !errors.Is(err, &RPCError{Tag: "invalid-value"}) {
+		t.Error("expected errors.Is to match invalid-value")
+	}
+	if errors.Is(err, &RPCError{Tag: "operation-failed"}) {
+		t.Error("expected warnings not to be part of the error")
+	}
+
+	if _, err := newRPCReply(rawXML, true, "1"); !errors.Is(err, &RPCError{Severity: "warning"}) {
+		t.Errorf("expected the warning with ErrOnWarning, got %v", err)
+	}
+
+	reply, err = newRPCReply([]byte(`<rpc-reply><rpc-error><error-severity>warning</error-severity></rpc-error><ok/></rpc-reply>`), false, "1")
+	if err != nil || reply.HasError() {
+		t.Errorf("expected warnings only not to fail, got %v", err)
+	}
+}
+
 func TestMethodLock(t *testing.T) {
 	expected := "<lock><target><what.target/></target></lock>"
 
@@ -164,7 +334,7 @@ var RPCReplytests = []struct {
 </commit-results>
 <ok/>
 </rpc-reply>`,
-		false,
+		true,
 	},
 	{
 		`
@@ -219,7 +389,7 @@ configuration check-out failed: (missing mandatory statements)
 </commit-results>
 <ok/>
 </rpc-reply>`,
-		false,
+		true,
 	},
 }
 
@@ -235,5 +405,265 @@ func TestNewRPCReply(t *testing.T) {
 		if reply.MessageID != "101" {
 			t.Errorf("newRPCReply(%q) did not set message-id to input, got %q", "101", reply.MessageID)
 		}
+		if reply.OK() != tc.replyOk {
+			t.Errorf("newRPCReply(%q).OK() = %v, want %v", tc.rawXML, reply.OK(), tc.replyOk)
+		}
+	}
+}
+
+func TestRPCReplyOK(t *testing.T) {
+	tt := []struct {
+		name   string
+		rawXML string
+		ok     bool
+		okElem bool
+	}{
+		{"ok", `<rpc-reply><ok/></rpc-reply>`, true, true},
+		{"prefixed", `<nc:rpc-reply xmlns:nc="urn:ietf:params:xml:ns:netconf:base:1.0"><nc:ok/></nc:rpc-reply>`, true, true},
+		{"data", `<rpc-reply><data><top/></data></rpc-reply>`, false, false},
+		{"warning", `<rpc-reply><rpc-error><error-severity>warning</error-severity></rpc-error><ok/></rpc-reply>`, true, true},
+		{"error", `<rpc-reply><rpc-error><error-severity>error</error-severity></rpc-error><ok/></rpc-reply>`, false, true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			reply, _ := newRPCReply([]byte(tc.rawXML), false, "101")
+			if reply.Ok != tc.okElem {
+				t.Errorf("expected Ok to be %v", tc.okElem)
+			}
+			if reply.OK() != tc.ok {
+				t.Errorf("expected OK() to be %v", tc.ok)
+			}
+		})
+	}
+}
+
+func TestRPCReplyBody(t *testing.T) {
+	rawXML := `<rpc-reply message-id="101" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><software-information xmlns="urn:example:vendor"><host-name>r1</host-name></software-information></rpc-reply>`
+	reply, err := newRPCReply([]byte(rawXML), false, "101")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var info struct {
+		HostName string `xml:"host-name"`
+	}
+	if err := xml.Unmarshal(reply.Body(), &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.HostName != "r1" {
+		t.Errorf("unexpected host name %q in body %q", info.HostName, reply.Body())
+	}
+}
+
+func TestRPCReplyPayload(t *testing.T) {
+	tt := []struct {
+		name     string
+		rawXML   string
+		expected string
+	}{
+		{
+			name:     "data",
+			rawXML:   `<?xml version="1.0"?><rpc-reply message-id="1" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><data><top xmlns="urn:example"><a/></top><sys:system xmlns:sys="urn:example:sys"/></data></rpc-reply>`,
+			expected: `<top xmlns="urn:example"><a/></top><sys:system xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" xmlns:sys="urn:example:sys"/>`,
+		},
+		{
+			name:     "inherited namespaces",
+			rawXML:   `<nc:rpc-reply xmlns:nc="urn:ietf:params:xml:ns:netconf:base:1.0" xmlns:if="urn:example:if" xmlns:unused="urn:example:unused"><nc:data xmlns="urn:example"><if:interfaces><if:name>ge-0/0/0</if:name></if:interfaces><top/></nc:data></nc:rpc-reply>`,
+			expected: `<if:interfaces xmlns="urn:example" xmlns:if="urn:example:if"><if:name>ge-0/0/0</if:name></if:interfaces><top xmlns="urn:example"/>`,
+		},
+		{
+			name:     "unprefixed descendants",
+			rawXML:   `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" xmlns:if="urn:example:if"><data xmlns="urn:example"><if:interfaces><mtu>1500</mtu></if:interfaces></data></rpc-reply>`,
+			expected: `<if:interfaces xmlns="urn:example" xmlns:if="urn:example:if"><mtu>1500</mtu></if:interfaces>`,
+		},
+		{
+			name:     "vendor",
+			rawXML:   `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" xmlns:junos="http://xml.juniper.net/junos/15.1F4/junos"><software-information><host-name junos:style="brief">r1</host-name></software-information><ok/></rpc-reply>`,
+			expected: `<software-information xmlns:junos="http://xml.juniper.net/junos/15.1F4/junos" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><host-name junos:style="brief">r1</host-name></software-information>`,
+		},
+		{
+			name:   "ok",
+			rawXML: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><ok/></rpc-reply>`,
+		},
+		{
+			name:   "empty data",
+			rawXML: `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><data/></rpc-reply>`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			reply := &RPCReply{RawReply: tc.rawXML}
+			payload := reply.Payload()
+			if tc.expected == "" && payload != nil {
+				t.Errorf("expected no payload, got %q", payload)
+			}
+			if string(payload) != tc.expected {
+				t.Errorf("unexpected payload (want %q, got %q)", tc.expected, payload)
+			}
+		})
+	}
+}
+
+func TestNewRPCReplyInvalid(t *testing.T) {
+	rawXML := `<rpc-reply message-id="101"><data><vendor-field>1</data></rpc-reply>`
+	_, err := newRPCReply([]byte(rawXML), false, "101")
+
+	var parseErr *ReplyParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("expected a ReplyParseError, got %v", err)
+	}
+	if string(parseErr.Raw) != rawXML {
+		t.Errorf("expected the raw reply, got %q", parseErr.Raw)
+	}
+	var syntaxErr *xml.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Errorf("expected the XML syntax error to be wrapped, got %v", parseErr.Err)
+	}
+}
+
+func TestEditConfig(t *testing.T) {
+	tt := []struct {
+		name     string
+		opts     EditConfigOptions
+		expected string
+	}{
+		{
+			name:     "defaults",
+			expected: "<edit-config><target><candidate/></target><config><top/></config></edit-config>",
+		},
+		{
+			name: "all",
+			opts: EditConfigOptions{
+				DefaultOperation: DefaultOperationNone,
+				TestOption:       TestOptionTestThenSet,
+				ErrorOption:      ErrorOptionRollbackOnError,
+			},
+			expected: "<edit-config><target><candidate/></target><default-operation>none</default-operation><test-option>test-then-set</test-option><error-option>rollback-on-error</error-option><config><top/></config></edit-config>",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			m := EditConfig(Candidate, "<top/>", tc.opts)
+			if got := m.MarshalMethod(); got != tc.expected {
+				t.Errorf("got %s, expected %s", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestEditConfigURL(t *testing.T) {
+	m := EditConfigURL(Candidate, URL("ftp://example.com/a&b.xml"), EditConfigOptions{DefaultOperation: DefaultOperationReplace})
+	expected := "<edit-config><target><candidate/></target><default-operation>replace</default-operation><url>ftp://example.com/a&amp;b.xml</url></edit-config>"
+	if got := m.MarshalMethod(); got != expected {
+		t.Errorf("got %s, expected %s", got, expected)
+	}
+
+	v := m.(capabilityValidator)
+	if err := v.validate([]string{CapabilityBase10, CapabilityURL + "?scheme=http"}); !errors.Is(err, ErrCapabilityNotSupported) {
+		t.Errorf("expected ErrCapabilityNotSupported, got %v", err)
+	}
+	if err := v.validate([]string{CapabilityBase10, CapabilityURL + "?scheme=ftp"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := EditConfigURL(Candidate, Running, EditConfigOptions{}).(capabilityValidator).validate(nil); err == nil {
+		t.Error("expected a datastore as source to be rejected")
+	}
+}
+
+func TestEditConfigCapabilities(t *testing.T) {
+	m := EditConfig(Running, "<top/>", EditConfigOptions{ErrorOption: ErrorOptionRollbackOnError})
+
+	s := &Session{ServerCapabilities: []string{"urn:ietf:params:netconf:base:1.0"}}
+	if _, err := s.Exec(m); !errors.Is(err, ErrCapabilityNotSupported) {
+		t.Errorf("expected ErrCapabilityNotSupported, got %v", err)
+	}
+
+	caps := []string{"urn:ietf:params:netconf:base:1.0", CapabilityRollbackOnError}
+	if err := m.(capabilityValidator).validate(caps); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRawMethodReader(t *testing.T) {
+	config := "<edit-config><target><candidate/></target><config><interfaces>" +
+		strings.Repeat("<interface><name>ge-0/0/0</name><mtu>9000</mtu></interface>", 10000) +
+		"</interfaces></config></edit-config>"
+
+	tt := []struct {
+		name string
+		caps []string
+	}{
+		{"netconf10", []string{"urn:ietf:params:netconf:base:1.0"}},
+		{"netconf11", DefaultCapabilities},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			requests := make(chan string, 1)
+			s := newSessionTest(t, tc.caps, serveRequests(requests, "<ok/>"))
+			defer s.Close()
+
+			if _, err := s.Exec(RawMethodReader(strings.NewReader(config)), MethodGetConfig("running")); err != nil {
+				t.Fatal(err)
+			}
+			if got := requestBody(<-requests); got != config+"<get-config><source><running/></source></get-config>" {
+				t.Errorf("unexpected request of %d bytes", len(got))
+			}
+		})
+	}
+}
+
+func TestRawMethodReaderError(t *testing.T) {
+	s := newSessionTest(t, DefaultCapabilities, serveRequests(make(chan string), "<ok/>"))
+	defer s.Close()
+
+	readErr := errors.New("read failed")
+	r := io.MultiReader(strings.NewReader("<edit-config>"), &errReader{readErr})
+	if _, err := s.Exec(RawMethodReader(r)); err != readErr {
+		t.Fatalf("expected %v, got %v", readErr, err)
+	}
+	if _, err := s.Exec(MethodGetConfig("running")); err == nil {
+		t.Error("expected the transport to be closed")
+	}
+}
+
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
+
+func TestMethodWithNamespace(t *testing.T) {
+	const ns = "http://xml.juniper.net/junos/*/junos-interface"
+
+	if got, want := MethodWithNamespace("get-interface-information", ns, "<terse/>").MarshalMethod(),
+		`<get-interface-information xmlns="`+ns+`"><terse/></get-interface-information>`; got != want {
+		t.Errorf("got %s, expected %s", got, want)
+	}
+	if got, want := MethodWithNamespace("get-software-information", "urn:a&b", "").MarshalMethod(),
+		`<get-software-information xmlns="urn:a&amp;b"/>`; got != want {
+		t.Errorf("got %s, expected %s", got, want)
+	}
+
+	// A reply whose content is in the vendor namespace.
+	data := `<interface-information xmlns="` + ns + `"><physical-interface><name>ge-0/0/0</name></physical-interface></interface-information>`
+	reply, err := newRPCReply([]byte(`<rpc-reply xmlns:junos="http://xml.juniper.net/junos/18.4R1/junos" message-id="1">`+data+`</rpc-reply>`), false, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Data != data {
+		t.Errorf("got data %s, expected %s", reply.Data, data)
+	}
+
+	var info struct {
+		Interfaces []string `xml:"physical-interface>name"`
+	}
+	if err := xml.Unmarshal([]byte(reply.Data), &info); err != nil || len(info.Interfaces) != 1 || info.Interfaces[0] != "ge-0/0/0" {
+		t.Errorf("unexpected interfaces %v: %v", info.Interfaces, err)
 	}
 }
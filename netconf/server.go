@@ -0,0 +1,67 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidClientHello is returned by AcceptHello when the hello of the
+// client lacks its capabilities or holds a session-id, which only servers
+// send (RFC6241 section 8.1).
+var ErrInvalidClientHello = errors.New("netconf: invalid client hello")
+
+// NewServerHello returns the hello a server sends to start the session with
+// the given session-id, advertising caps, or DefaultCapabilities when caps is
+// empty, for building NETCONF servers and proxies. See AcceptHello.
+func NewServerHello(sessionID int, caps []string) *HelloMessage {
+	if len(caps) == 0 {
+		caps = DefaultCapabilities
+	}
+	return &HelloMessage{Capabilities: caps, SessionID: sessionID}
+}
+
+// AcceptHello exchanges the hellos on t as the server side of a session: it
+// sends NewServerHello(sessionID, caps), receives the hello of the client and
+// returns it once checked. Chunked framing is then used if both sides
+// advertise base:1.1, as NewSession does on the client side. The requests of
+// the client are then read with t.Receive and answered with t.Send.
+//
+// A client hello lacking capabilities fails with ErrInvalidClientHello, one
+// holding a session-id with ErrClientSessionID, which wraps it, and one
+// without a base version in common with caps with ErrNoCommonBase; the hello
+// is returned along with the error.
+func AcceptHello(t Transport, sessionID int, caps []string) (*HelloMessage, error) {
+	if sessionID <= 0 {
+		return nil, fmt.Errorf("netconf: invalid session-id %d", sessionID)
+	}
+
+	hello := NewServerHello(sessionID, caps)
+	if err := t.SendHello(hello); err != nil {
+		return nil, err
+	}
+	clientHello, err := t.ReceiveHello()
+	if err != nil {
+		return clientHello, err
+	}
+
+	if err := validateClientHello(clientHello); err != nil {
+		return clientHello, err
+	}
+
+	common := commonCapabilities(clientHello.Capabilities, hello.Capabilities)
+	switch {
+	case common.Has(CapabilityBase11):
+		t.SetVersion("v1.1")
+	case common.Has(CapabilityBase10):
+	default:
+		return clientHello, fmt.Errorf("%w: server advertised %s, client advertised %s",
+			ErrNoCommonBase, baseVersions(hello.Capabilities), baseVersions(clientHello.Capabilities))
+	}
+	return clientHello, nil
+}
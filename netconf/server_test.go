@@ -0,0 +1,118 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestNewServerHello(t *testing.T) {
+	hello := NewServerHello(7, nil)
+	if hello.SessionID != 7 || !reflect.DeepEqual([]string(hello.Capabilities), DefaultCapabilities) {
+		t.Errorf("unexpected hello %+v", hello)
+	}
+}
+
+func TestForwardHello(t *testing.T) {
+	raw := []string{CapabilityBase11, " urn:example:b?module=b&revision=2020-01-01 ", CapabilityBase10}
+
+	client, server := NewMemoryTransport()
+	defer client.Close()
+	go server.SendHello(NewServerHello(3, raw))
+
+	hello, err := client.ReceiveHello()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(hello.RawCapabilities, raw) {
+		t.Errorf("expected the capabilities verbatim, got %q", hello.RawCapabilities)
+	}
+	if hello.Capabilities[1] != "urn:example:b?module=b&revision=2020-01-01" {
+		t.Errorf("expected the capability trimmed, got %q", hello.Capabilities[1])
+	}
+}
+
+func TestNewClientHello(t *testing.T) {
+	hello := NewClientHello(nil)
+	if hello.SessionID != 0 || !reflect.DeepEqual([]string(hello.Capabilities), DefaultCapabilities) {
+		t.Errorf("unexpected hello %+v", hello)
+	}
+	if !errors.Is(ErrClientSessionID, ErrInvalidClientHello) || !errors.Is(ErrNoBaseCapability, ErrInvalidHello) {
+		t.Error("expected the hello errors to wrap the invalid hello errors")
+	}
+}
+
+func TestAcceptHello(t *testing.T) {
+	client, server := NewMemoryTransport()
+	defer server.Close()
+
+	sessions := make(chan *Session, 1)
+	go func() {
+		sessions <- NewSession(client)
+	}()
+
+	hello, err := AcceptHello(server, 42, []string{CapabilityBase10, CapabilityBase11, CapabilityCandidate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual([]string(hello.Capabilities), DefaultCapabilities) {
+		t.Errorf("unexpected client hello %+v", hello)
+	}
+
+	s := <-sessions
+	if s.SessionID != 42 || s.ProtocolVersion() != "1.1" || !hasCapability(s.ServerCapabilities, CapabilityCandidate) {
+		t.Errorf("unexpected session %d, version %s, capabilities %q", s.SessionID, s.ProtocolVersion(), s.ServerCapabilities)
+	}
+
+	go func() {
+		req, err := server.Receive()
+		if err == nil {
+			server.Send(TestReply(req, "<ok/>"))
+		}
+	}()
+	if reply, err := s.Exec(MethodGetConfig("running")); err != nil || !reply.OK() {
+		t.Errorf("unexpected reply %v, %v", reply, err)
+	}
+}
+
+func TestAcceptHelloInvalid(t *testing.T) {
+	tt := []struct {
+		name   string
+		caps   []string
+		client *HelloMessage
+		err    error
+	}{
+		{"session-id", nil, &HelloMessage{Capabilities: DefaultCapabilities, SessionID: 1}, ErrClientSessionID},
+		{"no capabilities", nil, &HelloMessage{}, ErrInvalidClientHello},
+		{"no common base", []string{CapabilityBase11}, &HelloMessage{Capabilities: []string{CapabilityBase10}}, ErrNoCommonBase},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			client, server := NewMemoryTransport()
+			defer client.Close()
+
+			go func() {
+				if _, err := client.ReceiveHello(); err == nil {
+					client.SendHello(tc.client)
+				}
+			}()
+
+			if _, err := AcceptHello(server, 1, tc.caps); !errors.Is(err, tc.err) {
+				t.Errorf("expected %v, got %v", tc.err, err)
+			}
+		})
+	}
+
+	client, server := NewMemoryTransport()
+	defer client.Close()
+	if _, err := AcceptHello(server, 0, nil); err == nil {
+		t.Error("expected an error for session-id 0")
+	}
+}
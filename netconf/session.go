@@ -11,43 +11,352 @@ Package netconf provides support for a simple NETCONF client based on RFC6241 an
 package netconf
 
 import (
+	"bytes"
+	"context"
 	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
-// Session defines the necessary components for a NETCONF session
+// ErrMessageIDMismatch is returned by Exec when the reply carries another
+// message-id than the request. Replies with a message-id no RPC awaits are
+// delivered to UnexpectedReplies instead of the pending RPCs.
+var ErrMessageIDMismatch = errors.New("netconf: reply message-id mismatch")
+
+// ErrNoCommonBase is returned when the client and the server advertise no
+// common version of the base protocol in their hellos.
+var ErrNoCommonBase = errors.New("netconf: no common base protocol version")
+
+// ErrInvalidHello is returned when the hello of the server lacks its
+// capabilities or session-id.
+var ErrInvalidHello = errors.New("netconf: invalid server hello")
+
+// ErrNoBaseCapability is returned when the hello of the server advertises no
+// 1.x version of the base protocol, which every server must (RFC6241 section
+// 8.1). It wraps ErrInvalidHello.
+var ErrNoBaseCapability = fmt.Errorf("%w: no base:1.x capability", ErrInvalidHello)
+
+// ErrClientSessionID is returned by AcceptHello when the hello of the client
+// holds a session-id, which only servers send; clients build their hello with
+// NewClientHello to leave it out. It wraps ErrInvalidClientHello.
+var ErrClientSessionID = fmt.Errorf("%w: session-id set by the client", ErrInvalidClientHello)
+
+// ErrSessionClosed is returned by Exec once the session has been closed, by
+// Close or after being idle, see SetIdleTimeout.
+var ErrSessionClosed = errors.New("netconf: session closed")
+
+// ErrWriteTimeout is returned by Exec when the request couldn't be sent
+// within the WriteTimeout of the session.
+var ErrWriteTimeout = errors.New("netconf: timed out sending request")
+
+// ErrReadTimeout is returned by Exec when the reply stops arriving for longer
+// than the ReadTimeout of the session.
+var ErrReadTimeout = errors.New("netconf: timed out waiting for reply")
+
+// ErrHelloTimeout is returned by the Dial functions when the server doesn't
+// send its hello within the hello timeout, see WithHelloTimeout.
+var ErrHelloTimeout = errors.New("netconf: timed out waiting for server hello")
+
+// DefaultHelloTimeout is how long the Dial functions wait for the hello of the
+// server by default.
+const DefaultHelloTimeout = 30 * time.Second
+
+// Session defines the necessary components for a NETCONF session.
+//
+// A Session is safe for concurrent use: each RPC gets its own message-id,
+// which replies are matched against.
 type Session struct {
 	Transport          Transport
 	SessionID          int
-	ServerCapabilities []string
+	ServerCapabilities Capabilities
 	ErrOnWarning       bool
+	// ReadTimeout, when non-zero, fails an RPC with ErrReadTimeout once no
+	// data has been received for that long, counting from when the request
+	// was sent. It only applies while a reply is awaited, so a slow device
+	// still sending its reply or an idle session isn't affected. The
+	// transport is closed when it expires.
+	ReadTimeout time.Duration
+	// WriteTimeout, when non-zero, fails an RPC with ErrWriteTimeout when
+	// its request hasn't been sent within that time, e.g. as the device
+	// stopped reading. The session is then unusable, as when the context of
+	// an RPC is done while the request is being sent.
+	WriteTimeout time.Duration
+
+	protocolVersion string
+	serverHello     *HelloMessage
+	capabilities    Capabilities
+	// helloErr is why the hello exchange failed, returned by every RPC.
+	helloErr error
+	logger   Logger
+	// spillOver, when non-zero, is the size over which ExecStream writes
+	// replies to a temporary file, see SpillToDiskOver.
+	spillOver int
+
+	// sendMu keeps the requests of concurrent RPCs from interleaving.
+	sendMu sync.Mutex
+
+	mu            sync.Mutex
+	timeout       time.Duration
+	messageIDs    func() string
+	lastMessageID uint64
+	// waiters holds the channels replies are delivered on by message-id,
+	// and streams the ones of replies awaited as streams.
+	waiters map[string]chan []byte
+	streams map[string]chan *messageReader
+	// abandoned holds the message-ids of RPCs given up on before their reply
+	// was received, which is dropped when it arrives.
+	abandoned     map[string]struct{}
+	notifications chan Notification
+	// subscribed is set while a subscription created by CreateSubscription
+	// is active.
+	subscribed bool
+	// unexpected, once created by UnexpectedReplies, receives the replies
+	// no RPC awaits, and is closed when the session stops.
+	unexpected chan *RPCReply
+	// done is created when the goroutine reading incoming messages starts,
+	// and closed with err set when it stops.
+	done chan struct{}
+	err  error
+	// active is the number of RPCs in progress, lastActive when the last one
+	// ended and idleTimer closes the session once idle for idleTimeout.
+	active      int
+	lastActive  time.Time
+	idleTimeout time.Duration
+	idleTimer   *time.Timer
+	closed      bool
+
+	stats sessionStats
 }
 
-// Close is used to close and end a transport session
+// closeSessionTimeout bounds the wait for the reply to close-session in Close.
+const closeSessionTimeout = 5 * time.Second
+
+// Close ends the session with a close-session RPC, waiting up to 5 seconds for
+// its reply, and then closes the transport. See CloseContext.
 func (s *Session) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), closeSessionTimeout)
+	defer cancel()
+	return s.CloseContext(ctx)
+}
+
+// CloseContext ends the session with a close-session RPC, giving up on its
+// reply when ctx is done, and then closes the transport. The transport is
+// closed even if the RPC fails, its error being returned wrapped. Closing a
+// session already closed returns ErrSessionClosed.
+func (s *Session) CloseContext(ctx context.Context) error {
+	if !s.markClosed() {
+		return ErrSessionClosed
+	}
+	return s.closeSession(ctx)
+}
+
+// closeSession sends close-session, the session being marked closed already,
+// and closes the transport.
+func (s *Session) closeSession(ctx context.Context) error {
+	_, err := s.execRPC(ctx, NewRPCMessage([]RPCMethod{RawMethod("<close-session/>")}))
+	closeErr := s.Transport.Close()
+	if err != nil {
+		return fmt.Errorf("netconf: close-session failed: %w", err)
+	}
+
+	// The server may close the transport first once it has replied.
+	if closeErr == io.EOF {
+		return nil
+	}
+	return closeErr
+}
+
+// ForceClose closes the transport without ending the session first, for when
+// it is known to be unusable.
+func (s *Session) ForceClose() error {
+	s.markClosed()
 	return s.Transport.Close()
 }
 
+// markClosed marks the session closed, making RPCs fail with
+// ErrSessionClosed, and reports whether it wasn't already.
+func (s *Session) markClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.idleTimer != nil {
+		s.idleTimer.Stop()
+	}
+	closed := s.closed
+	s.closed = true
+	return !closed
+}
+
+// SetMaxMessageSize limits the size of the messages received to n bytes, not
+// counting their framing, protecting against a device streaming an endless
+// reply. A larger message fails the pending RPCs with an error wrapping
+// ErrMessageTooLarge and closes the transport, the later RPCs failing with it
+// too. Zero, the default, means no limit. Only transports supporting it, such
+// as TransportBasicIO, limit the size. It must be called before the session
+// is used.
+func (s *Session) SetMaxMessageSize(n int) {
+	if t, ok := s.Transport.(interface{ setMaxMessageSize(int) }); ok {
+		t.setMaxMessageSize(n)
+	}
+}
+
+// SetXMLHeader makes every message sent by the session start with header, an
+// empty header omitting the XML declaration, for transports supporting it
+// such as TransportBasicIO. It must be called before the session is used.
+func (s *Session) SetXMLHeader(header string) {
+	if t, ok := s.Transport.(interface{ SetXMLHeader(string) }); ok {
+		t.SetXMLHeader(header)
+	}
+}
+
+// SetLogger sets the Logger receiving the messages of the session and, for
+// transports supporting it such as TransportBasicIO, of its transport. It must
+// be called before the session is used.
+func (s *Session) SetLogger(l Logger) {
+	s.logger = l
+	if t, ok := s.Transport.(interface{ setLogger(Logger) }); ok {
+		t.setLogger(l)
+	}
+}
+
+// KillSession forces the termination of another session, releasing its locks
+// and aborting its operations.
+func (s *Session) KillSession(sessionID int) error {
+	if sessionID == s.SessionID {
+		return fmt.Errorf("netconf: session %d can't kill itself, use Close", sessionID)
+	}
+
+	_, err := s.Exec(RawMethod(fmt.Sprintf("<kill-session><session-id>%d</session-id></kill-session>", sessionID)))
+	return err
+}
+
 // Exec is used to execute an RPC method or methods
 func (s *Session) Exec(methods ...RPCMethod) (*RPCReply, error) {
+	return s.ExecContext(context.Background(), methods...)
+}
+
+// ExecContext is used to execute an RPC method or methods, giving up when ctx
+// is done before the reply has been received. In that case ctx.Err() is
+// returned and the reply is dropped when it arrives. If ctx is done while the
+// request is still being sent, the session is left without a usable
+// transport as the request can't be completed; the only meaningful operation
+// left is then Close.
+func (s *Session) ExecContext(ctx context.Context, methods ...RPCMethod) (*RPCReply, error) {
+	return s.ExecRPC(ctx, NewRPCMessage(methods))
+}
+
+// Ping checks that the session and the device are responsive by running the
+// cheapest RPC there is, a get-config of the running datastore with an empty
+// filter, selecting nothing. It returns nil once a well-formed reply has been
+// received, even one holding rpc-errors, e.g. when access control denies the
+// get-config, as the device did reply. It gives up when ctx is done, to be
+// given a deadline by health checks.
+func (s *Session) Ping(ctx context.Context) error {
+	_, err := s.ExecContext(ctx, RawMethod(`<get-config><source><running/></source><filter type="subtree"/></get-config>`))
+	if _, ok := err.(*RPCErrors); ok {
+		return nil
+	}
+	return err
+}
+
+// ExecRPC is like ExecContext but sends rpc as built by the caller, e.g. with
+// namespaces declared by AddNamespace. Its MessageID is replaced by the next
+// one of the session.
+func (s *Session) ExecRPC(ctx context.Context, rpc *RPCMessage) (*RPCReply, error) {
+	if err := s.begin(); err != nil {
+		return nil, err
+	}
+	defer s.end()
+
+	return s.execRPC(ctx, rpc)
+}
+
+// ExecWithAttrs is like Exec but sets attrs on the rpc element, by name, as
+// RPCMessage.SetAttr does, e.g. a correlation identifier:
+//
+//	s.ExecWithAttrs(map[string]string{
+//		"xmlns:t":    "urn:example:trace",
+//		"t:trace-id": id,
+//	}, methods...)
+//
+// The attributes are written in the order of their names.
+func (s *Session) ExecWithAttrs(attrs map[string]string, methods ...RPCMethod) (*RPCReply, error) {
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
 	rpc := NewRPCMessage(methods)
+	for _, name := range names {
+		if err := rpc.SetAttr(name, attrs[name]); err != nil {
+			return nil, err
+		}
+	}
+	return s.ExecRPC(context.Background(), rpc)
+}
 
-	request, err := xml.Marshal(rpc)
-	if err != nil {
+func (s *Session) execRPC(ctx context.Context, rpc *RPCMessage) (_ *RPCReply, err error) {
+	if err := s.validate(rpc.Methods); err != nil {
 		return nil, err
 	}
 
-	err = s.Transport.Send(request)
-	if err != nil {
+	rpc.MessageID = s.nextMessageID()
+
+	s.mu.Lock()
+	timeout := s.timeout
+	s.mu.Unlock()
+	if timeout > 0 {
+		parent := ctx
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		defer func() {
+			if err == context.DeadlineExceeded && parent.Err() == nil {
+				err = fmt.Errorf("netconf: no reply to message-id %q within %v: %w", rpc.MessageID, timeout, err)
+			}
+		}()
+	}
+
+	replies := s.expect(rpc.MessageID)
+	defer s.forget(rpc.MessageID)
+
+	if err := s.sendRPC(ctx, rpc); err != nil {
 		return nil, err
 	}
+	sent := time.Now()
+
+	timedOut := func() bool { return false }
+	if s.ReadTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel, timedOut = s.watchReply(ctx)
+		defer cancel()
+	}
 
-	rawXML, err := s.Transport.Receive()
+	rawXML, err := s.receive(ctx, replies)
 	if err != nil {
+		if timedOut() {
+			s.abort()
+			return nil, ErrReadTimeout
+		}
 		return nil, err
 	}
 
+	if _, messageID := parseMessageHeader(rawXML); messageID != "" && messageID != rpc.MessageID {
+		return nil, fmt.Errorf("%w: sent %q, received %q", ErrMessageIDMismatch, rpc.MessageID, messageID)
+	}
+
 	reply, err := newRPCReply(rawXML, s.ErrOnWarning, rpc.MessageID)
+	_, failed := err.(*RPCErrors)
+	s.countReply(sent, failed)
 	if err != nil {
 		return nil, err
 	}
@@ -55,27 +364,697 @@ func (s *Session) Exec(methods ...RPCMethod) (*RPCReply, error) {
 	return reply, nil
 }
 
+// SetTimeout sets the time each RPC is given to complete, after which Exec
+// returns an error wrapping context.DeadlineExceeded. Zero, the default, means
+// no timeout. A late reply is dropped, the session remaining usable.
+func (s *Session) SetTimeout(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.timeout = d
+}
+
+// SetIdleTimeout makes the session close itself, as Close does, once no RPC
+// has been in progress for d, e.g. to free the session slot of a device when
+// the session sits unused in a pool. Receiving notifications doesn't count as
+// activity. Later RPCs fail with ErrSessionClosed. Zero, the default,
+// disables it.
+func (s *Session) SetIdleTimeout(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.idleTimeout = d
+	s.lastActive = time.Now()
+	if s.idleTimer != nil {
+		s.idleTimer.Stop()
+		s.idleTimer = nil
+	}
+	if d > 0 && !s.closed {
+		s.idleTimer = time.AfterFunc(d, s.closeIdle)
+		if s.active > 0 {
+			s.idleTimer.Stop()
+		}
+	}
+}
+
+// begin records the start of an RPC, failing if the session is closed or no
+// longer receives messages.
+func (s *Session) begin() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrSessionClosed
+	}
+	if s.done != nil {
+		select {
+		case <-s.done:
+			return s.err
+		default:
+		}
+	}
+	s.active++
+	if s.idleTimer != nil {
+		s.idleTimer.Stop()
+	}
+	return nil
+}
+
+// end records the end of an RPC, from when the session may become idle.
+func (s *Session) end() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.active--
+	s.lastActive = time.Now()
+	if s.active == 0 && s.idleTimer != nil && !s.closed {
+		s.idleTimer.Reset(s.idleTimeout)
+	}
+}
+
+// closeIdle closes the session if it is still idle when its idle timer fires.
+func (s *Session) closeIdle() {
+	s.mu.Lock()
+	idle := !s.closed && s.active == 0 && s.idleTimeout > 0 && time.Since(s.lastActive) >= s.idleTimeout
+	if idle {
+		s.closed = true
+	}
+	s.mu.Unlock()
+	if !idle {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), closeSessionTimeout)
+	defer cancel()
+	if err := s.closeSession(ctx); err != nil {
+		logger(s.logger).Debugf("session %d: closing idle session: %v", s.SessionID, err)
+	}
+}
+
+// SetMessageIDGenerator sets the function returning the message-id of each
+// RPC, which must be unique among the RPCs pending at any time. By default
+// message-ids are increasing integers starting at 1; UUIDMessageID can be used
+// for random ones. The function is not called concurrently.
+func (s *Session) SetMessageIDGenerator(f func() string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messageIDs = f
+}
+
+// UUIDMessageID returns a random UUID, to be used as message-id generator.
+func UUIDMessageID() string {
+	return uuid()
+}
+
+// validate checks that the session was established and that the server
+// supports what methods depend on.
+func (s *Session) validate(methods []RPCMethod) error {
+	if s.helloErr != nil {
+		return s.helloErr
+	}
+	if err := s.checkInterleave(methods); err != nil {
+		return err
+	}
+	for _, method := range methods {
+		if v, ok := method.(capabilityValidator); ok {
+			if err := v.validate(s.ServerCapabilities); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// nextMessageID returns the message-id of a new RPC.
+func (s *Session) nextMessageID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.messageIDs != nil {
+		return s.messageIDs()
+	}
+	s.lastMessageID++
+	return strconv.FormatUint(s.lastMessageID, 10)
+}
+
+// activityTransport is implemented by transports telling when data was last
+// received.
+type activityTransport interface {
+	lastActivity() time.Time
+}
+
+// watchReply returns a context canceled once no data has been received for
+// s.ReadTimeout, and a function reporting whether that happened.
+func (s *Session) watchReply(ctx context.Context) (context.Context, context.CancelFunc, func() bool) {
+	ctx, cancel := context.WithCancel(ctx)
+	var expired int32
+
+	start := time.Now()
+	go func() {
+		timer := time.NewTimer(s.ReadTimeout)
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+
+			last := start
+			if t, ok := s.Transport.(activityTransport); ok && t.lastActivity().After(last) {
+				last = t.lastActivity()
+			}
+			idle := time.Since(last)
+			if idle >= s.ReadTimeout {
+				atomic.StoreInt32(&expired, 1)
+				cancel()
+				return
+			}
+			timer.Reset(s.ReadTimeout - idle)
+		}
+	}()
+
+	return ctx, cancel, func() bool { return atomic.LoadInt32(&expired) == 1 }
+}
+
+// expect registers the reply to messageID as awaited, returning the channel it
+// is delivered on.
+func (s *Session) expect(messageID string) chan []byte {
+	s.listen()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.waiters == nil {
+		s.waiters = make(map[string]chan []byte)
+	}
+	replies := make(chan []byte, 1)
+	s.waiters[messageID] = replies
+	return replies
+}
+
+// forget stops awaiting the reply to messageID, which is dropped if late.
+func (s *Session) forget(messageID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, waiting := s.waiters[messageID]
+	_, streaming := s.streams[messageID]
+	if !waiting && !streaming {
+		return
+	}
+	delete(s.waiters, messageID)
+	delete(s.streams, messageID)
+	if s.abandoned == nil {
+		s.abandoned = make(map[string]struct{})
+	}
+	s.abandoned[messageID] = struct{}{}
+}
+
+// send writes a request, one at a time.
+func (s *Session) send(ctx context.Context, request []byte) error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	if t, ok := s.Transport.(contextTransport); ok {
+		return t.SendContext(ctx, request)
+	}
+	_, err := doContext(ctx, func() ([]byte, error) {
+		return nil, s.Transport.Send(request)
+	}, s.abort)
+	return err
+}
+
+// sendRPC sends rpc, streaming the methods which support it when the transport
+// does.
+func (s *Session) sendRPC(ctx context.Context, rpc *RPCMessage) error {
+	if s.WriteTimeout <= 0 {
+		return s.writeRPC(ctx, rpc)
+	}
+
+	wctx, cancel := context.WithTimeout(ctx, s.WriteTimeout)
+	defer cancel()
+	err := s.writeRPC(wctx, rpc)
+	if err != nil && wctx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		return ErrWriteTimeout
+	}
+	return err
+}
+
+// writeRPC sends rpc, streaming the methods supporting it when the transport
+// does.
+func (s *Session) writeRPC(ctx context.Context, rpc *RPCMessage) error {
+	if !rpc.streamed() {
+		request, err := xml.Marshal(rpc)
+		if err != nil {
+			return err
+		}
+		return s.sendCounted(ctx, request)
+	}
+
+	t, ok := s.Transport.(streamSender)
+	if !ok {
+		var buf bytes.Buffer
+		if err := rpc.writeStream(&buf); err != nil {
+			return err
+		}
+		return s.sendCounted(ctx, buf.Bytes())
+	}
+
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	w := &countingWriter{}
+	_, err := doContext(ctx, func() ([]byte, error) {
+		return nil, t.sendStream(func(out io.Writer) error {
+			w.w = out
+			return rpc.writeStream(w)
+		})
+	}, s.abort)
+	if err != nil {
+		if ctx.Err() == nil {
+			// The message was cut short.
+			s.abort()
+		}
+		return err
+	}
+	s.countSent(w.n)
+	return nil
+}
+
+// sendCounted sends request, counting it in the stats of the session.
+func (s *Session) sendCounted(ctx context.Context, request []byte) error {
+	if err := s.send(ctx, request); err != nil {
+		return err
+	}
+	s.countSent(len(request))
+	return nil
+}
+
+// receive returns the reply delivered on replies.
+func (s *Session) receive(ctx context.Context, replies chan []byte) ([]byte, error) {
+	select {
+	case rawXML := <-replies:
+		return rawXML, nil
+	case <-s.done:
+		// The reply may have been delivered before the transport was
+		// closed, as servers do after replying to close-session.
+		select {
+		case rawXML := <-replies:
+			return rawXML, nil
+		default:
+		}
+		return nil, s.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// listen starts the goroutine reading all incoming messages, dispatching
+// replies to the waiting RPCs and notifications to the subscription, unless
+// it already runs.
+func (s *Session) listen() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.done != nil {
+		return
+	}
+	s.done = make(chan struct{})
+
+	go func() {
+		for {
+			if t, ok := s.Transport.(streamTransport); ok {
+				handedOver, err := s.handOver(t)
+				if err != nil {
+					logger(s.logger).Debugf("session %d: stopped receiving: %v", s.SessionID, err)
+					s.stop(err)
+					return
+				}
+				if handedOver {
+					continue
+				}
+			}
+
+			rawXML, err := s.Transport.Receive()
+			if err != nil {
+				logger(s.logger).Debugf("session %d: stopped receiving: %v", s.SessionID, err)
+				s.stop(err)
+				return
+			}
+			s.countReceived(len(rawXML))
+			s.dispatch(rawXML)
+		}
+	}()
+}
+
+// stop records why the listening goroutine stopped and ends the subscription.
+func (s *Session) stop(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.err = err
+	close(s.done)
+	s.endSubscription()
+	if s.unexpected != nil {
+		close(s.unexpected)
+	}
+
+	// Keep the device from sending the rest of the message.
+	if errors.Is(err, ErrMessageTooLarge) {
+		s.abort()
+	}
+}
+
+// dispatch routes an incoming message read by the listening goroutine.
+func (s *Session) dispatch(rawXML []byte) {
+	name, messageID := parseMessageHeader(rawXML)
+	if name.Local == "notification" {
+		s.notify(rawXML)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.abandoned[messageID]; ok {
+		logger(s.logger).Debugf("session %d: dropping late reply to message-id %q", s.SessionID, messageID)
+		delete(s.abandoned, messageID)
+		return
+	}
+
+	// Servers omit the message-id when the request was missing one or could
+	// not be parsed. Such a reply can only be matched when a single RPC is
+	// pending. A reply with an unknown message-id, or one already answered,
+	// is never given to another RPC, which would then miss its own reply.
+	replies, ok := s.waiters[messageID]
+	if !ok && messageID == "" && len(s.waiters) == 1 {
+		for id := range s.waiters {
+			messageID, replies, ok = id, s.waiters[id], true
+		}
+	}
+	if !ok {
+		s.unexpectedReply(rawXML, messageID)
+		return
+	}
+	replies <- rawXML
+	delete(s.waiters, messageID)
+}
+
+// unexpectedReplyBufferSize is the number of unexpected replies buffered
+// before the next ones are dropped.
+const unexpectedReplyBufferSize = 16
+
+// UnexpectedReplies returns the channel replies no RPC awaits are delivered
+// on: those with an unknown message-id, or one whose reply was already
+// received, as a misbehaving server reusing or echoing message-ids sends.
+// These protocol violations are otherwise dropped and only logged. Late
+// replies to RPCs given up on, e.g. on timeout, are expected and not
+// delivered. Replies are dropped while the channel is full. The channel is
+// closed when the session stops.
+func (s *Session) UnexpectedReplies() <-chan *RPCReply {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.unexpected == nil {
+		s.unexpected = make(chan *RPCReply, unexpectedReplyBufferSize)
+		if s.done != nil {
+			select {
+			case <-s.done:
+				close(s.unexpected)
+			default:
+			}
+		}
+	}
+	return s.unexpected
+}
+
+// unexpectedReply delivers a reply no RPC awaits on the channel returned by
+// UnexpectedReplies, if any. s.mu must be held.
+func (s *Session) unexpectedReply(rawXML []byte, messageID string) {
+	logger(s.logger).Debugf("session %d: unexpected reply to message-id %q", s.SessionID, messageID)
+	if s.unexpected == nil {
+		return
+	}
+
+	reply, _ := newRPCReply(rawXML, false, messageID)
+	if reply == nil {
+		// Keep what can't be parsed for inspection.
+		reply = &RPCReply{RawReply: string(rawXML), MessageID: messageID}
+	}
+	select {
+	case s.unexpected <- reply:
+	default:
+		logger(s.logger).Debugf("session %d: dropping unexpected reply to message-id %q", s.SessionID, messageID)
+	}
+}
+
+// parseMessageHeader returns the name and message-id of the root element of
+// an incoming message, or zero values if it can't be parsed.
+func parseMessageHeader(rawXML []byte) (xml.Name, string) {
+	d := xml.NewDecoder(bytes.NewReader(rawXML))
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return xml.Name{}, ""
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			for _, attr := range start.Attr {
+				if attr.Name.Local == "message-id" {
+					return start.Name, attr.Value
+				}
+			}
+			return start.Name, ""
+		}
+	}
+}
+
+// abort closes the transport to unblock any pending I/O on transports that do
+// not support contexts.
+func (s *Session) abort() {
+	s.Transport.Close()
+}
+
 // NewSession creates a new NETCONF session using the provided transport layer.
+//
+// The hellos are exchanged and the framing of the highest base protocol
+// version advertised by both sides is used: chunked framing for 1.1, end of
+// message markers for 1.0. If that fails, every RPC of the session returns the
+// error; the Dial functions return it instead.
 func NewSession(t Transport) *Session {
+	return NewSessionWithCapabilities(t, nil)
+}
+
+// NewSessionWithCapabilities is like NewSession but advertises caps in the
+// hello of the client instead of DefaultCapabilities, which is used when caps
+// is empty. caps must include the base protocol versions to use, so that
+// leaving out base:1.1 forces 1.0 framing.
+func NewSessionWithCapabilities(t Transport, caps []string) *Session {
+	s, err := newSession(t, caps, 0)
+	if err != nil {
+		s.helloErr = err
+	}
+	return s
+}
+
+// startSession creates a new NETCONF session using t, which is closed if the
+// hello exchange fails.
+func startSession(t Transport, opts options) (*Session, error) {
+	if opts.frameEnd != nil || opts.sanitize != nil {
+		if q, ok := t.(interface {
+			setQuirks(func([]byte) (int, int, error), func([]byte) []byte)
+		}); ok {
+			q.setQuirks(opts.frameEnd, opts.sanitize)
+		}
+	}
+	if opts.xmlHeader != nil {
+		if h, ok := t.(interface{ SetXMLHeader(string) }); ok {
+			h.SetXMLHeader(*opts.xmlHeader)
+		}
+	}
+	if opts.maxMessageSize > 0 {
+		if m, ok := t.(interface{ setMaxMessageSize(int) }); ok {
+			m.setMaxMessageSize(opts.maxMessageSize)
+		}
+	}
+	if opts.minChunkSize > 0 || opts.maxChunkSize > 0 {
+		if c, ok := t.(interface{ setChunkSize(int, int) }); ok {
+			c.setChunkSize(opts.minChunkSize, opts.maxChunkSize)
+		}
+	}
+	if opts.logger != nil {
+		if l, ok := t.(interface{ setLogger(Logger) }); ok {
+			l.setLogger(opts.logger)
+		}
+	}
+
+	s, err := newSession(t, opts.capabilities(), opts.helloTimeout)
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+	s.ReadTimeout = opts.readTimeout
+	s.WriteTimeout = opts.writeTimeout
+	s.spillOver = opts.spillOver
+	s.logger = opts.logger
+	s.timeout = opts.timeout
+	return s, nil
+}
+
+func newSession(t Transport, caps []string, helloTimeout time.Duration) (*Session, error) {
 	s := new(Session)
 	s.Transport = t
 
+	if len(caps) == 0 {
+		caps = DefaultCapabilities
+	}
+
 	// Receive Servers Hello message
-	serverHello, _ := t.ReceiveHello()
+	serverHello, err := receiveHello(t, helloTimeout)
+	if err != nil {
+		return s, err
+	}
+	s.serverHello = serverHello
+	if err := validateHello(serverHello); err != nil {
+		return s, err
+	}
 	s.SessionID = serverHello.SessionID
 	s.ServerCapabilities = serverHello.Capabilities
+	if !hasBase1(s.ServerCapabilities) {
+		return s, fmt.Errorf("%w: server advertised %s", ErrNoBaseCapability, baseVersions(s.ServerCapabilities))
+	}
+	s.capabilities = commonCapabilities(caps, s.ServerCapabilities)
 
-	// Send our hello using default capabilities.
-	t.SendHello(&HelloMessage{Capabilities: DefaultCapabilities})
+	// Use chunked framing whenever both sides support it, as the end of
+	// message marker used by 1.0 framing may legally appear in a message.
+	switch {
+	case s.capabilities.Has(CapabilityBase11):
+		s.protocolVersion = "1.1"
+	case s.capabilities.Has(CapabilityBase10):
+		s.protocolVersion = "1.0"
+	default:
+		return s, fmt.Errorf("%w: client advertised %s, server advertised %s",
+			ErrNoCommonBase, baseVersions(caps), baseVersions(s.ServerCapabilities))
+	}
 
-	// Set Transport version
-	t.SetVersion("v1.0")
-	for _, capability := range s.ServerCapabilities {
-		if strings.Contains(capability, "urn:ietf:params:netconf:base:1.1") {
-			t.SetVersion("v1.1")
-			break
+	// Send our hello.
+	if err := t.SendHello(NewClientHello(caps)); err != nil {
+		return s, err
+	}
+	t.SetVersion("v" + s.protocolVersion)
+
+	return s, nil
+}
+
+// receiveHello receives the hello of the server, failing with ErrHelloTimeout
+// and closing t when it doesn't arrive within timeout, if non-zero.
+func receiveHello(t Transport, timeout time.Duration) (*HelloMessage, error) {
+	if timeout <= 0 {
+		return t.ReceiveHello()
+	}
+
+	type result struct {
+		hello *HelloMessage
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		hello, err := t.ReceiveHello()
+		done <- result{hello, err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.hello, r.err
+	case <-timer.C:
+		// Closing the transport unblocks the pending read.
+		t.Close()
+		return nil, fmt.Errorf("%w after %v", ErrHelloTimeout, timeout)
+	}
+}
+
+// validateHello checks that the hello of the server has the content required
+// by RFC6241 section 8.1.
+func validateHello(hello *HelloMessage) error {
+	switch {
+	case len(hello.Capabilities) == 0:
+		return fmt.Errorf("%w: no capabilities: %s", ErrInvalidHello, hello.RawHello)
+	case hello.SessionID == 0:
+		return fmt.Errorf("%w: no session-id: %s", ErrInvalidHello, hello.RawHello)
+	}
+	return nil
+}
+
+// NewClientHello returns the hello a client sends to start a session,
+// advertising caps, or DefaultCapabilities when caps is empty. It never holds
+// a session-id, which only servers send.
+func NewClientHello(caps []string) *HelloMessage {
+	if len(caps) == 0 {
+		caps = DefaultCapabilities
+	}
+	return &HelloMessage{Capabilities: caps}
+}
+
+// validateClientHello checks that the hello of a client has the content
+// required by RFC6241 section 8.1, the counterpart of validateHello.
+func validateClientHello(hello *HelloMessage) error {
+	switch {
+	case len(hello.Capabilities) == 0:
+		return fmt.Errorf("%w: no capabilities: %s", ErrInvalidClientHello, hello.RawHello)
+	case hello.SessionID != 0:
+		return fmt.Errorf("%w: %d", ErrClientSessionID, hello.SessionID)
+	}
+	return nil
+}
+
+// hasBase1 reports whether caps hold a 1.x version of the base protocol.
+func hasBase1(caps []string) bool {
+	for _, capability := range caps {
+		if strings.HasPrefix(capabilityURN(capability), "urn:ietf:params:netconf:base:1.") {
+			return true
 		}
 	}
+	return false
+}
 
-	return s
+// ServerHello returns the hello received from the server, nil if none was. It
+// is kept when it is invalid, for debugging.
+func (s *Session) ServerHello() *HelloMessage {
+	return s.serverHello
+}
+
+// baseVersions lists the base protocol capabilities in caps for errors.
+func baseVersions(caps []string) string {
+	var bases []string
+	for _, capability := range caps {
+		if strings.HasPrefix(capabilityURN(capability), "urn:ietf:params:netconf:base:") {
+			bases = append(bases, capabilityURN(capability))
+		}
+	}
+	if len(bases) == 0 {
+		return "none"
+	}
+	return strings.Join(bases, " ")
+}
+
+// Capabilities returns the capabilities advertised by both the client and the
+// server in their hellos, as listed by the server.
+func (s *Session) Capabilities() Capabilities {
+	return s.capabilities
+}
+
+// ProtocolVersion returns the version of the base protocol negotiated during
+// the hello exchange, "1.0" or "1.1".
+func (s *Session) ProtocolVersion() string {
+	return s.protocolVersion
+}
+
+// ChunkedFraming reports whether messages are framed in chunks, which is the
+// case with version 1.1 of the base protocol. Otherwise they are delimited by
+// an end of message marker.
+func (s *Session) ChunkedFraming() bool {
+	return s.protocolVersion == "1.1"
 }
@@ -0,0 +1,699 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newSessionTest returns a Session connected over an in-memory pipe to a fake
+// server advertising caps. The server side performs the hello exchange and
+// then hands its transport to serve.
+func newSessionTest(t *testing.T, caps []string, serve func(*TransportBasicIO)) *Session {
+	t.Helper()
+
+	client, server := net.Pipe()
+	st := &TransportBasicIO{ReadWriteCloser: server}
+
+	go func() {
+		defer server.Close()
+		if err := st.SendHello(&HelloMessage{Capabilities: caps, SessionID: 42}); err != nil {
+			return
+		}
+		if _, err := st.ReceiveHello(); err != nil {
+			return
+		}
+		st.SetVersion("v1.0")
+		for _, c := range caps {
+			if c == "urn:ietf:params:netconf:base:1.1" {
+				st.SetVersion("v1.1")
+			}
+		}
+		if serve != nil {
+			serve(st)
+		}
+	}()
+
+	return NewSession(&TransportBasicIO{ReadWriteCloser: client})
+}
+
+func TestExecContextCancel(t *testing.T) {
+	s := newSessionTest(t, DefaultCapabilities, func(st *TransportBasicIO) {
+		// Read the request but never reply; the second Receive returns
+		// once the client closes the pipe.
+		st.Receive()
+		st.Receive()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := s.ExecContext(ctx, MethodGetConfig("running"))
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	s.Close()
+}
+
+func TestReceiveContextClosesStream(t *testing.T) {
+	// An io.Pipe does not support deadlines, so the stream must be closed.
+	r, w := io.Pipe()
+	defer w.Close()
+
+	var trans TransportBasicIO
+	trans.ReadWriteCloser = NewReadWriteCloser(r, w)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		w.Write([]byte("<partial"))
+		cancel()
+	}()
+
+	_, err := trans.ReceiveContext(ctx)
+	if err != context.Canceled {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+
+	if _, err := w.Write([]byte("more")); err != io.ErrClosedPipe {
+		t.Errorf("expected stream to be closed, got %v", err)
+	}
+}
+
+func TestExecContextDone(t *testing.T) {
+	s := newSessionTest(t, DefaultCapabilities, nil)
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := s.ExecContext(ctx, MethodGetConfig("running")); err != context.Canceled {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestExecConcurrent(t *testing.T) {
+	const n = 10
+
+	s := newSessionTest(t, DefaultCapabilities, func(st *TransportBasicIO) {
+		// Reply to all requests in reverse order, echoing their message-id
+		// in the reply data.
+		var requests [][]byte
+		for i := 0; i < n; i++ {
+			req, err := st.Receive()
+			if err != nil {
+				return
+			}
+			requests = append(requests, req)
+		}
+		for i := len(requests) - 1; i >= 0; i-- {
+			_, messageID := parseMessageHeader(requests[i])
+			replyTo(st, requests[i], "<id>"+messageID+"</id>")
+		}
+		st.Receive()
+	})
+	defer s.Close()
+
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			reply, err := s.Exec(MethodGetConfig("running"))
+			if err == nil && reply.Data != "<id>"+reply.MessageID+"</id>" {
+				err = fmt.Errorf("reply %s for message-id %s", reply.Data, reply.MessageID)
+			}
+			errs <- err
+		}()
+	}
+	for i := 0; i < n; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestExecContextCancelKeepsSession(t *testing.T) {
+	requests := make(chan string, 2)
+	s := newSessionTest(t, DefaultCapabilities, func(st *TransportBasicIO) {
+		// Reply to the first request only after the second one.
+		first, err := st.Receive()
+		if err != nil {
+			return
+		}
+		requests <- string(first)
+		second, err := st.Receive()
+		if err != nil {
+			return
+		}
+		replyTo(st, first, "<late/>")
+		replyTo(st, second, "<ok/>")
+		st.Receive()
+	})
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-requests
+		// Give the client time to return from writing the request, as
+		// canceling while it is being sent leaves the transport unusable.
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := s.ExecContext(ctx, MethodGetConfig("running")); err != context.Canceled {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+
+	reply, err := s.Exec(MethodGetConfig("running"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Data != "<ok/>" {
+		t.Errorf("got the reply %s of the canceled RPC", reply.Data)
+	}
+}
+
+func TestMessageIDs(t *testing.T) {
+	tt := []struct {
+		name      string
+		generator func() string
+		want      []string
+	}{
+		{"default", nil, []string{"1", "2", "3"}},
+		{"custom", func() func() string {
+			n := 100
+			return func() string {
+				n += 10
+				return fmt.Sprintf("req-%d", n)
+			}
+		}(), []string{"req-110", "req-120", "req-130"}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			requests := make(chan string, len(tc.want))
+			s := newSessionTest(t, DefaultCapabilities, serveRequests(requests, "<ok/>"))
+			defer s.Close()
+			if tc.generator != nil {
+				s.SetMessageIDGenerator(tc.generator)
+			}
+
+			for _, want := range tc.want {
+				reply, err := s.Exec(MethodGetConfig("running"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if reply.MessageID != want {
+					t.Errorf("expected reply message-id %s, got %s", want, reply.MessageID)
+				}
+				if _, got := parseMessageHeader([]byte(<-requests)); got != want {
+					t.Errorf("expected request message-id %s, got %s", want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestMessageIDMismatch(t *testing.T) {
+	s := newSessionTest(t, DefaultCapabilities, func(st *TransportBasicIO) {
+		req, err := st.Receive()
+		if err != nil {
+			return
+		}
+		// Reply to another RPC first: the pending one must wait for its own.
+		st.Send([]byte(`<rpc-reply message-id="other" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><ok/></rpc-reply>`))
+		replyTo(st, req, "<data/>")
+		serveRequests(make(chan string, 1), "<ok/>")(st)
+	})
+	defer s.Close()
+	unexpected := s.UnexpectedReplies()
+
+	reply, err := s.Exec(MethodGetConfig("running"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.MessageID != "1" || reply.Data != "<data/>" {
+		t.Errorf("unexpected reply %+v", reply)
+	}
+	if r := <-unexpected; r.MessageID != "other" {
+		t.Errorf("expected the reply to message-id other to be unexpected, got %s", r.MessageID)
+	}
+}
+
+func TestDuplicateReplyWhilePending(t *testing.T) {
+	s := newSessionTest(t, DefaultCapabilities, func(st *TransportBasicIO) {
+		first, err := st.Receive()
+		if err != nil {
+			return
+		}
+		replyTo(st, first, "<ok/>")
+		second, err := st.Receive()
+		if err != nil {
+			return
+		}
+		// Answer the first RPC again while the second one is pending.
+		replyTo(st, first, "<ok/>")
+		replyTo(st, second, "<data>second</data>")
+		serveRequests(make(chan string, 1), "<ok/>")(st)
+	})
+	defer s.Close()
+	unexpected := s.UnexpectedReplies()
+
+	if _, err := s.Exec(MethodGetConfig("running")); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := s.Exec(MethodGetConfig("running"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.MessageID != "2" || !strings.Contains(reply.Data, "second") {
+		t.Errorf("expected the reply to the second RPC, got %+v", reply)
+	}
+	if r := <-unexpected; r.MessageID != "1" {
+		t.Errorf("expected the duplicate reply to be unexpected, got message-id %s", r.MessageID)
+	}
+}
+
+func TestUnexpectedReplies(t *testing.T) {
+	s := newSessionTest(t, DefaultCapabilities, func(st *TransportBasicIO) {
+		req, err := st.Receive()
+		if err != nil {
+			return
+		}
+		// Reply twice, then to an RPC never sent.
+		replyTo(st, req, "<ok/>")
+		replyTo(st, req, "<ok/>")
+		st.Send([]byte(`<rpc-reply message-id="999" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><data/></rpc-reply>`))
+	})
+	unexpected := s.UnexpectedReplies()
+
+	if _, err := s.Exec(MethodGetConfig("running")); err != nil {
+		t.Fatal(err)
+	}
+
+	var messageIDs []string
+	for reply := range unexpected {
+		messageIDs = append(messageIDs, reply.MessageID)
+	}
+	if strings.Join(messageIDs, ",") != "1,999" {
+		t.Errorf("unexpected replies to message-ids %v", messageIDs)
+	}
+
+	// The channel is closed once the session stopped.
+	if _, ok := <-s.UnexpectedReplies(); ok {
+		t.Error("expected the channel to be closed")
+	}
+}
+
+func TestClose(t *testing.T) {
+	requests := make(chan string, 1)
+	s := newSessionTest(t, DefaultCapabilities, serveRequests(requests, "<ok/>"))
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := requestBody(<-requests); got != "<close-session/>" {
+		t.Errorf("unexpected request %s", got)
+	}
+}
+
+func TestCloseContextUnresponsive(t *testing.T) {
+	closed := make(chan struct{})
+	s := newSessionTest(t, DefaultCapabilities, func(st *TransportBasicIO) {
+		// Read close-session but never reply.
+		st.Receive()
+		st.Receive()
+		close(closed)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := s.CloseContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Error("transport not closed")
+	}
+}
+
+func TestKillSession(t *testing.T) {
+	requests := make(chan string, 1)
+	s := newSessionTest(t, DefaultCapabilities, serveRequests(requests, "<ok/>"))
+	defer s.Close()
+
+	if err := s.KillSession(s.SessionID); err == nil {
+		t.Error("expected an error killing the own session")
+	}
+
+	if err := s.KillSession(17); err != nil {
+		t.Fatal(err)
+	}
+	if got := requestBody(<-requests); got != "<kill-session><session-id>17</session-id></kill-session>" {
+		t.Errorf("unexpected request %s", got)
+	}
+}
+
+func TestPing(t *testing.T) {
+	tt := []struct {
+		name    string
+		content string
+		err     error
+	}{
+		{"data", "<data/>", nil},
+		{"rpc-error", `<rpc-error><error-type>application</error-type><error-tag>access-denied</error-tag><error-severity>error</error-severity></rpc-error>`, nil},
+		{"unresponsive", "", context.DeadlineExceeded},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			requests := make(chan string, 1)
+			s := newSessionTest(t, DefaultCapabilities, func(st *TransportBasicIO) {
+				req, err := st.Receive()
+				if err != nil {
+					return
+				}
+				requests <- requestBody(string(req))
+				if tc.content != "" {
+					replyTo(st, req, tc.content)
+				}
+				st.Receive()
+			})
+			defer s.ForceClose()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			if err := s.Ping(ctx); !errors.Is(err, tc.err) {
+				t.Errorf("expected %v, got %v", tc.err, err)
+			}
+			if got := <-requests; got != `<get-config><source><running/></source><filter type="subtree"/></get-config>` {
+				t.Errorf("unexpected request %s", got)
+			}
+		})
+	}
+}
+
+func TestProtocolVersion(t *testing.T) {
+	tt := []struct {
+		name         string
+		caps         []string
+		version      string
+		capabilities Capabilities
+		err          error
+	}{
+		{"1.0", []string{"urn:ietf:params:netconf:base:1.0", CapabilityCandidate}, "1.0", Capabilities{CapabilityBase10}, nil},
+		{"1.1", DefaultCapabilities, "1.1", DefaultCapabilities, nil},
+		{"1.1 only", []string{"urn:ietf:params:netconf:base:1.1"}, "1.1", Capabilities{CapabilityBase11}, nil},
+		{"no base 1.x", []string{"urn:ietf:params:netconf:base:2.0"}, "", nil, ErrNoBaseCapability},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newSessionTest(t, tc.caps, serveRequests(make(chan string), "<ok/>"))
+			defer s.Close()
+
+			if _, err := s.Exec(MethodGetConfig("running")); !errors.Is(err, tc.err) {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+			if s.SessionID != 42 {
+				t.Errorf("expected session-id 42, got %d", s.SessionID)
+			}
+			if v := s.ProtocolVersion(); v != tc.version {
+				t.Errorf("expected version %s, got %s", tc.version, v)
+			}
+			if chunked := s.ChunkedFraming(); chunked != (tc.version == "1.1") {
+				t.Errorf("unexpected chunked framing %t", chunked)
+			}
+			if caps := s.Capabilities(); !reflect.DeepEqual(caps, tc.capabilities) {
+				t.Errorf("expected capabilities %q, got %q", tc.capabilities, caps)
+			}
+		})
+	}
+}
+
+func TestInvalidHello(t *testing.T) {
+	tt := []struct {
+		name  string
+		hello string
+	}{
+		{"no session-id", `<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities><capability>urn:ietf:params:netconf:base:1.0</capability></capabilities></hello>`},
+		{"no capabilities", `<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><session-id>4</session-id></hello>`},
+		{"no base capability", `<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities><capability>urn:ietf:params:netconf:capability:candidate:1.0</capability></capabilities><session-id>4</session-id></hello>`},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer server.Close()
+			go (&TransportBasicIO{ReadWriteCloser: server}).Send([]byte(tc.hello))
+
+			s := NewSession(&TransportBasicIO{ReadWriteCloser: client})
+			defer s.ForceClose()
+
+			if _, err := s.Exec(MethodGetConfig("running")); !errors.Is(err, ErrInvalidHello) {
+				t.Errorf("expected ErrInvalidHello, got %v", err)
+			}
+			if hello := s.ServerHello(); hello == nil || hello.RawHello != tc.hello {
+				t.Errorf("expected the raw hello to be kept, got %+v", hello)
+			}
+		})
+	}
+}
+
+func TestNewSessionWithCapabilities(t *testing.T) {
+	caps := []string{CapabilityBase10, "urn:example:interfaces?module=interfaces&features=mtu"}
+
+	client, server := net.Pipe()
+	hellos := make(chan *HelloMessage, 1)
+	go func() {
+		defer server.Close()
+		st := &TransportBasicIO{ReadWriteCloser: server}
+		if err := st.SendHello(&HelloMessage{Capabilities: DefaultCapabilities, SessionID: 42}); err != nil {
+			return
+		}
+		hello, err := st.ReceiveHello()
+		if err != nil {
+			return
+		}
+		hellos <- hello
+		serveRequests(make(chan string), "<ok/>")(st)
+	}()
+
+	s := NewSessionWithCapabilities(&TransportBasicIO{ReadWriteCloser: client}, caps)
+	defer s.Close()
+
+	if hello := <-hellos; !reflect.DeepEqual([]string(hello.Capabilities), caps) {
+		t.Errorf("expected the client to advertise %q, got %q", caps, hello.Capabilities)
+	}
+	if v := s.ProtocolVersion(); v != "1.0" {
+		t.Errorf("expected version 1.0, got %s", v)
+	}
+	if _, err := s.Exec(MethodGetConfig("running")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestForceBaseVersion(t *testing.T) {
+	srv := NewTestServer(func(rpc []byte) []byte {
+		return TestReply(rpc, "<ok/>")
+	})
+	defer srv.Close()
+
+	s, err := startSession(srv.Transport(), newOptions([]Option{ForceBaseVersion("1.0")}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if v := s.ProtocolVersion(); v != "1.0" {
+		t.Errorf("expected version 1.0, got %s", v)
+	}
+	if s.Capabilities().Has(CapabilityBase11) {
+		t.Errorf("expected base:1.1 not to be advertised, got %q", s.Capabilities())
+	}
+	if _, err := s.Exec(MethodGetConfig("running")); err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(DefaultCapabilities, []string{CapabilityBase10, CapabilityBase11}) {
+		t.Errorf("expected DefaultCapabilities to be left as is, got %q", DefaultCapabilities)
+	}
+}
+
+func TestSessionOptions(t *testing.T) {
+	srv := NewTestServer(func(rpc []byte) []byte {
+		return TestReply(rpc, "<data>"+strings.Repeat("x", 2000)+"</data>")
+	})
+	defer srv.Close()
+
+	var l testLogger
+	tr := srv.Transport()
+	s, err := startSession(tr, newOptions([]Option{
+		WithCapabilities(CapabilityBase10, "urn:example:interfaces"),
+		WithTimeout(time.Second),
+		WithMaxMessageSize(1000),
+		WithChunkSize(1024, 1024),
+		WithLogger(&l),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if v := s.ProtocolVersion(); v != "1.0" {
+		t.Errorf("expected version 1.0, got %s", v)
+	}
+	if s.timeout != time.Second {
+		t.Errorf("expected a timeout of 1s, got %v", s.timeout)
+	}
+	if tr.MaxMessageSize != 1000 || tr.Logger != &l || s.logger != &l {
+		t.Error("expected the maximum message size and logger to be set")
+	}
+	if tr.MinChunkSize != 1024 || tr.MaxChunkSize != 1024 {
+		t.Errorf("expected a fixed chunk size of 1024, got %d to %d", tr.MinChunkSize, tr.MaxChunkSize)
+	}
+	if _, err := s.Exec(MethodGetConfig("running")); !errors.Is(err, ErrMessageTooLarge) {
+		t.Errorf("expected ErrMessageTooLarge, got %v", err)
+	}
+}
+
+func TestSetIdleTimeout(t *testing.T) {
+	srv := NewTestServer(func(rpc []byte) []byte {
+		// Take longer than the idle timeout, which must not close the
+		// session while an RPC is in progress.
+		time.Sleep(100 * time.Millisecond)
+		return TestReply(rpc, "<ok/>")
+	})
+	defer srv.Close()
+	s := NewSession(srv.Transport())
+	s.SetIdleTimeout(50 * time.Millisecond)
+
+	if _, err := s.Exec(MethodGetConfig("running")); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-srv.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the idle session to be closed")
+	}
+	if _, err := s.Exec(MethodGetConfig("running")); !errors.Is(err, ErrSessionClosed) {
+		t.Errorf("expected ErrSessionClosed, got %v", err)
+	}
+	if err := s.Close(); !errors.Is(err, ErrSessionClosed) {
+		t.Errorf("expected ErrSessionClosed closing again, got %v", err)
+	}
+}
+
+func TestWriteTimeout(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		st := &TransportBasicIO{ReadWriteCloser: server}
+		if err := st.SendHello(&HelloMessage{Capabilities: DefaultCapabilities, SessionID: 1}); err != nil {
+			return
+		}
+		// Stop reading once the hello of the client is received.
+		st.ReceiveHello()
+	}()
+
+	opts := newOptions([]Option{WithWriteTimeout(50 * time.Millisecond), WithReadTimeout(time.Minute)})
+	s, err := startSession(&TransportBasicIO{ReadWriteCloser: client}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.ForceClose()
+	if s.ReadTimeout != time.Minute {
+		t.Errorf("expected a read timeout of 1m, got %v", s.ReadTimeout)
+	}
+
+	if _, err := s.Exec(MethodGetConfig("running")); err != ErrWriteTimeout {
+		t.Errorf("expected ErrWriteTimeout, got %v", err)
+	}
+}
+
+func TestSetMaxMessageSize(t *testing.T) {
+	srv := NewTestServer(func(rpc []byte) []byte {
+		return TestReply(rpc, "<data>"+strings.Repeat("x", 4096)+"</data>")
+	})
+	defer srv.Close()
+	s := NewSession(srv.Transport())
+	s.SetMaxMessageSize(1024)
+
+	if _, err := s.Exec(MethodGetConfig("running")); !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("expected ErrMessageTooLarge, got %v", err)
+	}
+	select {
+	case <-srv.Done():
+	case <-time.After(time.Second):
+		t.Error("expected the transport to be closed")
+	}
+	if _, err := s.Exec(MethodGetConfig("running")); !errors.Is(err, ErrMessageTooLarge) {
+		t.Errorf("expected later RPCs to fail with ErrMessageTooLarge, got %v", err)
+	}
+}
+
+func TestSetTimeout(t *testing.T) {
+	s := newSessionTest(t, DefaultCapabilities, func(st *TransportBasicIO) {
+		// Never reply to the first request.
+		if _, err := st.Receive(); err != nil {
+			return
+		}
+		serveRequests(make(chan string), "<ok/>")(st)
+	})
+	defer s.Close()
+	s.SetTimeout(50 * time.Millisecond)
+
+	if _, err := s.Exec(MethodGetConfig("running")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected an error wrapping %v, got %v", context.DeadlineExceeded, err)
+	}
+	if len(s.waiters) != 0 {
+		t.Errorf("%d reply waiters left", len(s.waiters))
+	}
+
+	// The timeout applies to each RPC and the session remains usable.
+	if _, err := s.Exec(MethodGetConfig("running")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// replyTo sends an rpc-reply with the given content for request.
+func replyTo(st *TransportBasicIO, request []byte, content string) error {
+	return st.Send([]byte(fmt.Sprintf(`<rpc-reply message-id="%s" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">%s</rpc-reply>`, replyMessageID(request), content)))
+}
+
+// serveRequests returns a server replying to every request with content and
+// passing the requests on, unless requests is full such as when the test
+// doesn't look at them, e.g. for the final close-session.
+func serveRequests(requests chan<- string, content string) func(*TransportBasicIO) {
+	return func(st *TransportBasicIO) {
+		for {
+			req, err := st.Receive()
+			if err != nil {
+				return
+			}
+			select {
+			case requests <- string(req):
+			default:
+			}
+			replyTo(st, req, content)
+		}
+	}
+}
+
+// requestBody strips the rpc element from a request received by the server.
+func requestBody(req string) string {
+	req = req[strings.Index(req, ">")+1:]
+	return strings.TrimSuffix(req, "</rpc>")
+}
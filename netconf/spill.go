@@ -0,0 +1,79 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// SpillToDiskOver makes ExecStream read each reply whole before returning it,
+// keeping it in memory up to n bytes and writing it to a temporary file once
+// it grows larger, for tools archiving full configurations without holding
+// them in memory. The reply is de-framed as it is received, and the session
+// can be used again as soon as ExecStream returns. The temporary file is
+// deleted once the reader returned is closed.
+func SpillToDiskOver(n int) Option {
+	return func(o *options) {
+		o.spillOver = n
+	}
+}
+
+// spillFile is a temporary file holding a reply, deleted on Close.
+type spillFile struct {
+	*os.File
+}
+
+// Close closes and deletes the file.
+func (f spillFile) Close() error {
+	err := f.File.Close()
+	if rerr := os.Remove(f.Name()); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// spill reads the message of r whole, returning it from memory when it is at
+// most n bytes and from a temporary file otherwise. r is closed.
+func spill(r io.ReadCloser, n int) (io.ReadCloser, error) {
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, r, int64(n)+1); err != nil {
+		if err != io.EOF {
+			r.Close()
+			return nil, err
+		}
+		if err := r.Close(); err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(&buf), nil
+	}
+
+	f, err := ioutil.TempFile("", "netconf-reply-")
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	sf := spillFile{f}
+
+	_, err = buf.WriteTo(f)
+	if err == nil {
+		_, err = io.Copy(f, r)
+	}
+	if cerr := r.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		sf.Close()
+		return nil, err
+	}
+	return sf, nil
+}
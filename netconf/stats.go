@@ -0,0 +1,100 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Stats holds counters of the activity of a session since it was established,
+// see Session.Stats.
+type Stats struct {
+	// RPCsSent is the number of RPCs sent.
+	RPCsSent uint64
+	// RepliesReceived is the number of replies to them received, of which
+	// ErrorsReceived failed the RPC with rpc-errors.
+	RepliesReceived uint64
+	ErrorsReceived  uint64
+	// BytesSent and BytesReceived are the sizes of the messages sent and
+	// received, notifications included, without their framing.
+	BytesSent     uint64
+	BytesReceived uint64
+	// LastLatency is the time between the last RPC replied to being sent and
+	// its reply starting to be received.
+	LastLatency time.Duration
+}
+
+// sessionStats holds the Stats of a session, updated as it runs.
+type sessionStats struct {
+	mu    sync.Mutex
+	stats Stats
+}
+
+// update applies f to the stats.
+func (s *sessionStats) update(f func(*Stats)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f(&s.stats)
+}
+
+// Stats returns a snapshot of the counters of the session, which can be read
+// while RPCs are running, e.g. by a metrics collector.
+func (s *Session) Stats() Stats {
+	s.stats.mu.Lock()
+	defer s.stats.mu.Unlock()
+	return s.stats.stats
+}
+
+// countSent counts an RPC of size bytes sent.
+func (s *Session) countSent(size int) {
+	s.stats.update(func(st *Stats) {
+		st.RPCsSent++
+		st.BytesSent += uint64(size)
+	})
+}
+
+// countReceived counts a message of size bytes received.
+func (s *Session) countReceived(size int) {
+	s.stats.update(func(st *Stats) {
+		st.BytesReceived += uint64(size)
+	})
+}
+
+// countReply counts a reply to an RPC sent at sent, which failed with
+// rpc-errors when failed is set.
+func (s *Session) countReply(sent time.Time, failed bool) {
+	latency := time.Since(sent)
+	s.stats.update(func(st *Stats) {
+		st.RepliesReceived++
+		if failed {
+			st.ErrorsReceived++
+		}
+		st.LastLatency = latency
+	})
+}
+
+// countError counts a reply, already counted, found to fail with rpc-errors
+// once read as a stream.
+func (s *Session) countError() {
+	s.stats.update(func(st *Stats) {
+		st.ErrorsReceived++
+	})
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += n
+	return n, err
+}
@@ -0,0 +1,53 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	var sent, received int
+	srv := NewTestServer(func(rpc []byte) []byte {
+		content := "<data/>"
+		if strings.Contains(string(rpc), "<lock>") {
+			content = `<rpc-error><error-type>protocol</error-type><error-tag>lock-denied</error-tag><error-severity>error</error-severity></rpc-error>`
+		}
+		reply := TestReply(rpc, content)
+		sent += len(rpc)
+		received += len(reply)
+		return reply
+	})
+	s := NewSession(srv.Transport())
+	defer s.Close()
+
+	if _, err := s.Exec(MethodGetConfig("running")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Lock(Candidate); err == nil {
+		t.Fatal("expected lock-denied")
+	}
+	r, err := s.ExecStream(MethodGetConfig("running"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.ReadAll(r)
+	r.Close()
+
+	stats := s.Stats()
+	if stats.RPCsSent != 3 || stats.RepliesReceived != 3 || stats.ErrorsReceived != 1 {
+		t.Errorf("unexpected counts %+v", stats)
+	}
+	if stats.BytesSent != uint64(sent) || stats.BytesReceived != uint64(received) {
+		t.Errorf("got %d bytes sent and %d received, expected %d and %d", stats.BytesSent, stats.BytesReceived, sent, received)
+	}
+	if stats.LastLatency <= 0 {
+		t.Errorf("expected the latency of the last RPC, got %v", stats.LastLatency)
+	}
+}
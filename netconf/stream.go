@@ -0,0 +1,499 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrStreamAborted is returned by the RPCs of a session once a reply stream
+// was given up on with CloseStream, leaving the session unusable.
+var ErrStreamAborted = errors.New("netconf: reply stream aborted")
+
+// streamTransport is implemented by transports able to hand over a message as
+// a stream instead of reading it whole.
+type streamTransport interface {
+	// peekHeader returns the name and message-id of the root element of the
+	// next message without consuming it.
+	peekHeader() (xml.Name, string, error)
+	// receiveStream returns a reader over the next message.
+	receiveStream() *messageReader
+}
+
+// ExecStream is like Exec but returns the rpc-reply as a stream, for replies
+// too large to be held in memory. The reader yields the whole rpc-reply
+// element, which may hold rpc-errors, as the data is received.
+//
+// The reader must be closed, which skips what is left of the reply: no other
+// message is received until then. See CloseStream for giving up on a reply
+// without reading the rest of it. ExecStream is not bound by the timeout of
+// the session. With 1.0 framing the reply ends at the first end of message
+// marker, even if it appears within the XML document. See SpillToDiskOver for
+// reading replies whole without holding them in memory.
+func (s *Session) ExecStream(methods ...RPCMethod) (io.ReadCloser, error) {
+	if _, ok := s.Transport.(streamTransport); !ok {
+		reply, err := s.Exec(methods...)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(strings.NewReader(reply.RawReply)), nil
+	}
+
+	if err := s.begin(); err != nil {
+		return nil, err
+	}
+	// The RPC is in progress until the reader is closed.
+	streaming := false
+	defer func() {
+		if !streaming {
+			s.end()
+		}
+	}()
+
+	if err := s.validate(methods); err != nil {
+		return nil, err
+	}
+
+	rpc := NewRPCMessage(methods)
+	rpc.MessageID = s.nextMessageID()
+
+	streams := s.expectStream(rpc.MessageID)
+	defer s.forget(rpc.MessageID)
+
+	if err := s.sendRPC(context.Background(), rpc); err != nil {
+		return nil, err
+	}
+	sent := time.Now()
+
+	select {
+	case r := <-streams:
+		s.countReply(sent, false)
+		counted := r.onClose
+		r.onClose = func(size int) {
+			counted(size)
+			s.end()
+		}
+		streaming = true
+		if s.spillOver > 0 {
+			return spill(r, s.spillOver)
+		}
+		return r, nil
+	case <-s.done:
+		return nil, s.err
+	}
+}
+
+// CloseStream closes a reader returned by ExecStream, reporting whether the
+// session remains usable. When skip is true, the rest of the reply is read
+// and discarded as Close does, which keeps the session usable unless that
+// fails. Otherwise the transport is closed at once, which is cheaper when
+// gigabytes of the reply are left but leaves the session unusable: its RPCs
+// then fail with ErrStreamAborted and it must be reconnected. CloseStream
+// must not be called while the reader is being read.
+func (s *Session) CloseStream(r io.ReadCloser, skip bool) (usable bool, err error) {
+	mr, ok := r.(*messageReader)
+	if !ok || skip || mr.err != nil {
+		// The reply was read whole or is read to its end.
+		err := r.Close()
+		return err == nil, err
+	}
+
+	mr.err = ErrStreamAborted
+	s.abort()
+	mr.buf.Reset()
+	mr.finish()
+	// Wait for the session to stop receiving, failing later RPCs.
+	<-s.done
+	return false, nil
+}
+
+// ExecInto runs the RPC like ExecStream and decodes the data element of the
+// reply into out as xml.Decoder.DecodeElement would, so that its fields map
+// the children of data. The reply is decoded as it is received instead of
+// being read whole first. rpc-errors make ExecInto fail as they make Exec fail.
+func (s *Session) ExecInto(out interface{}, methods ...RPCMethod) error {
+	r, err := s.ExecStream(methods...)
+	if err != nil {
+		return err
+	}
+
+	return s.decodeStream(r, func(d *xml.Decoder, start *xml.StartElement) error {
+		return d.DecodeElement(out, start)
+	})
+}
+
+// ExecCallback runs method like ExecStream and calls fn with a decoder
+// positioned within the data element of the reply, its start tag having been
+// read, for processing huge replies node by node in constant memory. The
+// decoder stops at the end of the data element, reporting io.EOF past it;
+// what fn leaves unread of the data element, and the rest of the reply, is
+// skipped. fn isn't called when the reply holds no data element. rpc-errors
+// make ExecCallback fail as they make Exec fail, an error returned by fn is
+// returned as is.
+func (s *Session) ExecCallback(method RPCMethod, fn func(d *xml.Decoder) error) error {
+	r, err := s.ExecStream(method)
+	if err != nil {
+		return err
+	}
+
+	return s.decodeStream(r, func(d *xml.Decoder, start *xml.StartElement) error {
+		data := &elementTokenReader{d: d}
+		if err := fn(xml.NewTokenDecoder(data)); err != nil {
+			return err
+		}
+		return data.skip()
+	})
+}
+
+// decodeStream decodes the rpc-reply read from r with decodeReply, closing r.
+func (s *Session) decodeStream(r io.ReadCloser, data func(*xml.Decoder, *xml.StartElement) error) error {
+	err := decodeReply(xml.NewDecoder(r), data, s.ErrOnWarning)
+	if _, failed := err.(*RPCErrors); failed {
+		s.countError()
+	}
+	if cerr := r.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// elementTokenReader reads the tokens of d up to the end of the element
+// whose start was last read, reporting io.EOF there.
+type elementTokenReader struct {
+	d     *xml.Decoder
+	depth int
+	done  bool
+}
+
+func (r *elementTokenReader) Token() (xml.Token, error) {
+	if r.done {
+		return nil, io.EOF
+	}
+	tok, err := r.d.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok.(type) {
+	case xml.StartElement:
+		r.depth++
+	case xml.EndElement:
+		if r.depth == 0 {
+			r.done = true
+			return nil, io.EOF
+		}
+		r.depth--
+	}
+	return tok, nil
+}
+
+// skip reads the tokens left up to the end of the element.
+func (r *elementTokenReader) skip() error {
+	for {
+		if _, err := r.Token(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// decodeReply decodes the rpc-reply read by d, passing its data element to
+// data, which must read it whole.
+func decodeReply(d *xml.Decoder, data func(*xml.Decoder, *xml.StartElement) error, errOnWarning bool) error {
+	var root xml.StartElement
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			root = start
+			break
+		}
+	}
+	if root.Name.Local != "rpc-reply" {
+		return fmt.Errorf("netconf: unexpected element %s, expected rpc-reply", root.Name.Local)
+	}
+
+	var errs []RPCError
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+		if _, ok := tok.(xml.EndElement); ok {
+			break
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "rpc-error":
+			var rpcErr RPCError
+			if err := d.DecodeElement(&rpcErr, &start); err != nil {
+				return err
+			}
+			if !rpcErr.IsWarning() || errOnWarning {
+				errs = append(errs, rpcErr)
+			}
+		case "data":
+			if err := data(d, &start); err != nil {
+				return err
+			}
+		default:
+			if err := d.Skip(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return &RPCErrors{errs: errs}
+	}
+	return nil
+}
+
+// expectStream registers the reply to messageID as awaited as a stream,
+// returning the channel it is delivered on.
+func (s *Session) expectStream(messageID string) chan *messageReader {
+	s.listen()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.streams == nil {
+		s.streams = make(map[string]chan *messageReader)
+	}
+	streams := make(chan *messageReader, 1)
+	s.streams[messageID] = streams
+	return streams
+}
+
+// handOver delivers the next message as a stream if it is a reply awaited as
+// such, returning once it has been read. It reports whether it did.
+func (s *Session) handOver(t streamTransport) (bool, error) {
+	_, messageID, err := t.peekHeader()
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	streams, ok := s.streams[messageID]
+	delete(s.streams, messageID)
+	s.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+
+	r := t.receiveStream()
+	r.onClose = s.countReceived
+	streams <- r
+	<-r.closed
+	if r.err != io.EOF {
+		return true, r.err
+	}
+	return true, nil
+}
+
+// messageReader reads a message off a transport, removing its framing.
+type messageReader struct {
+	t       *TransportBasicIO
+	decoder chunkDecoder
+	// tail holds the bytes read that may be the start of the 1.0 end of
+	// message marker.
+	tail []byte
+	buf  bytes.Buffer
+	// recorded holds the message read so far for the transcript.
+	recorded bytes.Buffer
+	// size is the number of bytes of the message read so far.
+	size int
+	// onClose, when set, is called with size once the reader is closed.
+	onClose func(size int)
+	// err is io.EOF once the whole message has been read.
+	err     error
+	scratch []byte
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func (t *TransportBasicIO) receiveStream() *messageReader {
+	return &messageReader{
+		t:       t,
+		scratch: make([]byte, t.bufferSize()),
+		closed:  make(chan struct{}),
+	}
+}
+
+// Read reads the next bytes of the message.
+func (r *messageReader) Read(p []byte) (int, error) {
+	for r.buf.Len() == 0 && r.err == nil {
+		r.fill()
+	}
+	if r.buf.Len() > 0 {
+		return r.buf.Read(p)
+	}
+	return 0, r.err
+}
+
+// Close reads what is left of the message, so that the next one can be
+// received.
+func (r *messageReader) Close() error {
+	for r.err == nil {
+		r.buf.Reset()
+		r.fill()
+	}
+	r.buf.Reset()
+	r.finish()
+
+	if r.err != io.EOF {
+		return r.err
+	}
+	return nil
+}
+
+// finish hands the transport back once the reader is closed, with r.err set.
+func (r *messageReader) finish() {
+	r.closeOnce.Do(func() {
+		if r.err == io.EOF {
+			r.t.transcript.record(transcriptReceived, r.recorded.Bytes())
+		}
+		if r.onClose != nil {
+			r.onClose(r.size)
+		}
+		close(r.closed)
+	})
+}
+
+// fill decodes the data pending on the transport or the next read into buf,
+// which is empty.
+func (r *messageReader) fill() {
+	t := r.t
+	defer func() {
+		r.size += r.buf.Len()
+		if t.transcript != nil {
+			r.recorded.Write(r.buf.Bytes())
+		}
+	}()
+	in := t.pending
+	t.pending = nil
+	if len(in) == 0 {
+		n, err := t.Read(r.scratch)
+		if n == 0 && err != nil {
+			if err == io.EOF {
+				err = t.closedError(nil)
+			}
+			r.err = err
+			return
+		}
+		t.lastRead.Store(time.Now())
+		in = r.scratch[:n]
+	}
+
+	if t.version == "v1.1" {
+		n, done, err := r.decoder.decode(&r.buf, in)
+		switch {
+		case err != nil:
+			r.err = err
+		case done:
+			if n < len(in) {
+				t.pending = append([]byte(nil), in[n:]...)
+			}
+			r.err = io.EOF
+		}
+		return
+	}
+
+	data := append(r.tail, in...)
+	if i := bytes.Index(data, []byte(msgSeperator)); i > -1 {
+		r.buf.Write(data[:i])
+		if next := i + len(msgSeperator); next < len(data) {
+			t.pending = append([]byte(nil), data[next:]...)
+		}
+		r.tail = nil
+		r.err = io.EOF
+		return
+	}
+
+	// Hold back what may be the start of the marker.
+	keep := len(msgSeperator) - 1
+	if keep > len(data) {
+		keep = len(data)
+	}
+	r.buf.Write(data[:len(data)-keep])
+	r.tail = append([]byte(nil), data[len(data)-keep:]...)
+}
+
+func (t *TransportBasicIO) peekHeader() (xml.Name, string, error) {
+	buf := make([]byte, t.bufferSize())
+	for {
+		if name, messageID, ok := t.header(); ok {
+			return name, messageID, nil
+		}
+		if err := t.checkSize(len(t.pending)); err != nil {
+			return xml.Name{}, "", err
+		}
+
+		n, err := t.Read(buf)
+		if n > 0 {
+			t.lastRead.Store(time.Now())
+			t.pending = append(t.pending, buf[:n]...)
+			continue
+		}
+		if err != nil {
+			if err == io.EOF && len(bytes.TrimSpace(t.pending)) > 0 {
+				err = t.closedError(t.pending)
+			}
+			return xml.Name{}, "", err
+		}
+	}
+}
+
+// header returns the name and message-id of the root element of the message
+// starting in t.pending, reporting whether that is known yet. Malformed
+// messages are reported as known, for Receive to fail on.
+func (t *TransportBasicIO) header() (xml.Name, string, bool) {
+	data := t.pending
+	if t.version == "v1.1" {
+		var d chunkDecoder
+		var out bytes.Buffer
+		if _, _, err := d.decode(&out, data); err != nil {
+			return xml.Name{}, "", true
+		}
+		data = out.Bytes()
+	}
+
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			if serr, ok := err.(*xml.SyntaxError); ok && strings.HasPrefix(serr.Msg, "unexpected EOF") || err == io.EOF {
+				return xml.Name{}, "", false
+			}
+			return xml.Name{}, "", true
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			for _, attr := range start.Attr {
+				if attr.Name.Local == "message-id" {
+					return start.Name, attr.Value, true
+				}
+			}
+			return start.Name, "", true
+		}
+	}
+}
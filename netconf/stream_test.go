@@ -0,0 +1,287 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExecStream(t *testing.T) {
+	data := "<data>" + strings.Repeat("<interface><name>ge-0/0/0</name></interface>", 20000) + "</data>"
+
+	tt := []struct {
+		name string
+		caps []string
+	}{
+		{"netconf10", []string{"urn:ietf:params:netconf:base:1.0"}},
+		{"netconf11", DefaultCapabilities},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newSessionTest(t, tc.caps, serveRequests(make(chan string), data))
+			defer s.Close()
+
+			// Read a whole reply.
+			r, err := s.ExecStream(MethodGetConfig("running"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			reply, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := r.Close(); err != nil {
+				t.Fatal(err)
+			}
+			expected := `<rpc-reply message-id="1" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">` + data + `</rpc-reply>`
+			if string(reply) != expected {
+				t.Errorf("unexpected reply of %d bytes", len(reply))
+			}
+
+			// Close a reply without reading all of it.
+			r, err = s.ExecStream(MethodGetConfig("running"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			start := make([]byte, 100)
+			if _, err := r.Read(start); err != nil {
+				t.Fatal(err)
+			}
+			if err := r.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// The session remains usable.
+			rpcReply, err := s.Exec(MethodGetConfig("running"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rpcReply.MessageID != "3" || rpcReply.Data != data {
+				t.Errorf("unexpected reply to message-id %s", rpcReply.MessageID)
+			}
+		})
+	}
+}
+
+func TestSpillToDiskOver(t *testing.T) {
+	data := "<data>" + strings.Repeat("<interface><name>ge-0/0/0</name></interface>", 1000) + "</data>"
+	expected := `<rpc-reply message-id="1" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">` + data + `</rpc-reply>`
+
+	tt := []struct {
+		name    string
+		over    int
+		spilled bool
+	}{
+		{"memory", len(expected), false},
+		{"disk", 1000, true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newSessionTest(t, DefaultCapabilities, serveRequests(make(chan string), data))
+			defer s.Close()
+			s.spillOver = tc.over
+
+			r, err := s.ExecStream(MethodGetConfig("running"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, spilled := r.(spillFile)
+			if spilled != tc.spilled {
+				t.Fatalf("expected spilled to be %v", tc.spilled)
+			}
+
+			// The reply was read whole, so the session can be used while
+			// it is read.
+			if _, err := s.Exec(MethodGetConfig("running")); err != nil {
+				t.Fatal(err)
+			}
+
+			reply, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := r.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if string(reply) != expected {
+				t.Errorf("unexpected reply of %d bytes", len(reply))
+			}
+			if spilled {
+				if _, err := os.Stat(f.Name()); !os.IsNotExist(err) {
+					t.Errorf("expected %s to be deleted, got %v", f.Name(), err)
+				}
+			}
+		})
+	}
+}
+
+func TestCloseStream(t *testing.T) {
+	data := "<data>" + strings.Repeat("<interface><name>ge-0/0/0</name></interface>", 20000) + "</data>"
+
+	tt := []struct {
+		name string
+		skip bool
+	}{
+		{"skip", true},
+		{"abort", false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newSessionTest(t, DefaultCapabilities, serveRequests(make(chan string), data))
+			defer s.Close()
+
+			r, err := s.ExecStream(MethodGetConfig("running"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := r.Read(make([]byte, 100)); err != nil {
+				t.Fatal(err)
+			}
+			usable, err := s.CloseStream(r, tc.skip)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if usable != tc.skip {
+				t.Errorf("expected usable to be %v", tc.skip)
+			}
+
+			_, err = s.Exec(MethodGetConfig("running"))
+			if usable && err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+			if !usable && !errors.Is(err, ErrStreamAborted) {
+				t.Errorf("expected ErrStreamAborted, got %v", err)
+			}
+		})
+	}
+}
+
+func TestExecCallback(t *testing.T) {
+	type iface struct {
+		Name string `xml:"name"`
+	}
+
+	s := newSessionTest(t, DefaultCapabilities, serveRequests(make(chan string),
+		`<data><interfaces xmlns="urn:if"><interface><name>eth0</name></interface><interface><name>eth1</name></interface><interface><name>eth2</name></interface></interfaces></data>`))
+	defer s.Close()
+
+	var names []string
+	err := s.ExecCallback(MethodGetConfig("running"), func(d *xml.Decoder) error {
+		for {
+			tok, err := d.Token()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			start, ok := tok.(xml.StartElement)
+			if !ok || start.Name.Local != "interface" {
+				continue
+			}
+			if start.Name.Space != "urn:if" {
+				t.Errorf("expected the urn:if namespace, got %s", start.Name.Space)
+			}
+			var i iface
+			if err := d.DecodeElement(&i, &start); err != nil {
+				return err
+			}
+			names = append(names, i.Name)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"eth0", "eth1", "eth2"}) {
+		t.Errorf("unexpected interfaces %q", names)
+	}
+
+	// Stopping early skips the rest of the reply.
+	names = nil
+	err = s.ExecCallback(MethodGetConfig("running"), func(d *xml.Decoder) error {
+		for len(names) < 1 {
+			tok, err := d.Token()
+			if err != nil {
+				return err
+			}
+			if cd, ok := tok.(xml.CharData); ok {
+				names = append(names, string(cd))
+			}
+		}
+		return nil
+	})
+	if err != nil || !reflect.DeepEqual(names, []string{"eth0"}) {
+		t.Errorf("unexpected interfaces %q, %v", names, err)
+	}
+
+	errStop := errors.New("stop")
+	if err := s.ExecCallback(MethodGetConfig("running"), func(d *xml.Decoder) error { return errStop }); err != errStop {
+		t.Errorf("expected the error of the callback, got %v", err)
+	}
+	if _, err := s.Exec(MethodGetConfig("running")); err != nil {
+		t.Errorf("expected the session to remain usable, got %v", err)
+	}
+
+	s = newSessionTest(t, DefaultCapabilities, serveRequests(make(chan string),
+		`<rpc-error><error-type>protocol</error-type><error-tag>access-denied</error-tag><error-severity>error</error-severity></rpc-error>`))
+	defer s.Close()
+
+	called := false
+	err = s.ExecCallback(MethodGetConfig("running"), func(d *xml.Decoder) error {
+		called = true
+		return nil
+	})
+	var rpcErrs *RPCErrors
+	if !errors.As(err, &rpcErrs) || called {
+		t.Errorf("expected access-denied without the callback being called, got %v", err)
+	}
+}
+
+func TestExecInto(t *testing.T) {
+	type config struct {
+		Interfaces []struct {
+			Name string `xml:"name"`
+			MTU  int    `xml:"mtu"`
+		} `xml:"interfaces>interface"`
+	}
+
+	s := newSessionTest(t, DefaultCapabilities, serveRequests(make(chan string),
+		`<data><interfaces><interface><name>eth0</name><mtu>1500</mtu></interface><interface><name>eth1</name><mtu>9000</mtu></interface></interfaces></data>`))
+	defer s.Close()
+
+	var c config
+	if err := s.ExecInto(&c, MethodGetConfig("running")); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Interfaces) != 2 || c.Interfaces[0].Name != "eth0" || c.Interfaces[1].MTU != 9000 {
+		t.Errorf("unexpected config %+v", c)
+	}
+
+	s = newSessionTest(t, DefaultCapabilities, serveRequests(make(chan string),
+		`<rpc-error><error-type>application</error-type><error-tag>operation-failed</error-tag><error-severity>warning</error-severity></rpc-error>`+
+			`<rpc-error><error-type>protocol</error-type><error-tag>access-denied</error-tag><error-severity>error</error-severity></rpc-error>`))
+	defer s.Close()
+
+	err := s.ExecInto(&c, MethodGetConfig("running"))
+	var rpcErrs *RPCErrors
+	if !errors.As(err, &rpcErrs) || len(rpcErrs.Errors()) != 1 || rpcErrs.Errors()[0].Tag != "access-denied" {
+		t.Errorf("expected access-denied, got %v", err)
+	}
+	if _, err := s.Exec(MethodGetConfig("running")); !errors.As(err, &rpcErrs) {
+		t.Errorf("expected the session to remain usable, got %v", err)
+	}
+}
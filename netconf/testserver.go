@@ -0,0 +1,129 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+)
+
+// TestServer is a NETCONF server answering the RPCs of a session over a
+// MemoryTransport, for testing code using this package without a device.
+type TestServer struct {
+	client  *MemoryTransport
+	server  *MemoryTransport
+	handler func(rpc []byte) []byte
+	done    chan struct{}
+}
+
+// NewTestServer starts a server advertising DefaultCapabilities. Once hellos
+// have been exchanged it calls handler with each RPC received, in order, and
+// sends the message returned, framed, as the reply; see TestReply. Nothing is
+// sent when handler returns nil. close-session is answered with ok and stops
+// the server without calling handler.
+//
+// handler may sleep to simulate slow replies, or call WriteRaw or Close to
+// simulate malformed messages or a connection lost. The server is connected
+// to the transport returned by Transport.
+func NewTestServer(handler func(rpc []byte) []byte) *TestServer {
+	return NewTestServerWithCapabilities(nil, handler)
+}
+
+// NewTestServerWithCapabilities is like NewTestServer but advertises caps
+// instead of DefaultCapabilities, which is used when caps is empty. Leaving
+// out base:1.1 forces 1.0 framing.
+func NewTestServerWithCapabilities(caps []string, handler func(rpc []byte) []byte) *TestServer {
+	if len(caps) == 0 {
+		caps = DefaultCapabilities
+	}
+
+	s := &TestServer{handler: handler, done: make(chan struct{})}
+	s.client, s.server = NewMemoryTransport()
+	go s.serve(caps)
+	return s
+}
+
+// Transport returns the client end of the connection, for NewSession.
+func (s *TestServer) Transport() *MemoryTransport {
+	return s.client
+}
+
+// Send sends msg framed to the client, outside of any reply, such as a
+// notification.
+func (s *TestServer) Send(msg []byte) error {
+	return s.server.Send(msg)
+}
+
+// WriteRaw writes b to the client as is, without framing, such as malformed
+// chunks.
+func (s *TestServer) WriteRaw(b []byte) error {
+	_, err := s.server.Write(b)
+	return err
+}
+
+// Close abruptly closes the connection: pending and further reads and writes
+// of the client fail.
+func (s *TestServer) Close() error {
+	return s.server.Close()
+}
+
+// Done returns a channel closed once the server has stopped, after
+// close-session or once the connection is closed.
+func (s *TestServer) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *TestServer) serve(caps []string) {
+	defer close(s.done)
+	defer s.server.Close()
+
+	if _, err := AcceptHello(s.server, 1, caps); err != nil {
+		return
+	}
+
+	for {
+		rpc, err := s.server.Receive()
+		if err != nil {
+			return
+		}
+
+		if isCloseSession(rpc) {
+			s.server.Send(TestReply(rpc, "<ok/>"))
+			return
+		}
+
+		if reply := s.handler(rpc); reply != nil {
+			if err := s.server.Send(reply); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// isCloseSession reports whether rpc is a close-session request.
+func isCloseSession(rpc []byte) bool {
+	var req struct {
+		CloseSession *struct{} `xml:"close-session"`
+	}
+	return xml.Unmarshal(rpc, &req) == nil && req.CloseSession != nil
+}
+
+// TestReply returns an rpc-reply to rpc, with its message-id, holding
+// content, such as "<ok/>", a data element or rpc-errors.
+func TestReply(rpc []byte, content string) []byte {
+	return []byte(fmt.Sprintf(`<rpc-reply message-id="%s" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">%s</rpc-reply>`, replyMessageID(rpc), content))
+}
+
+// replyMessageID returns the message-id of rpc escaped to be written back as
+// the message-id attribute of its reply.
+func replyMessageID(rpc []byte) string {
+	_, messageID := parseMessageHeader(rpc)
+	var buf bytes.Buffer
+	escapeXML(&buf, messageID, true)
+	return buf.String()
+}
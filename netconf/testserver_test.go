@@ -0,0 +1,133 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTestServer(t *testing.T) {
+	var srv *TestServer
+
+	tt := []struct {
+		name    string
+		caps    []string
+		handler func(rpc []byte) []byte
+		ctx     time.Duration
+		check   func(t *testing.T, reply *RPCReply, err error)
+	}{
+		{
+			name: "data",
+			handler: func(rpc []byte) []byte {
+				return TestReply(rpc, "<data><version>1</version></data>")
+			},
+			check: func(t *testing.T, reply *RPCReply, err error) {
+				if err != nil || reply.Data != "<data><version>1</version></data>" {
+					t.Errorf("unexpected reply %v, %v", reply, err)
+				}
+			},
+		},
+		{
+			name: "netconf10",
+			caps: []string{CapabilityBase10},
+			handler: func(rpc []byte) []byte {
+				return TestReply(rpc, "<ok/>")
+			},
+			check: func(t *testing.T, reply *RPCReply, err error) {
+				if err != nil || reply.Data != "<ok/>" {
+					t.Errorf("unexpected reply %v, %v", reply, err)
+				}
+			},
+		},
+		{
+			name: "rpc-error",
+			handler: func(rpc []byte) []byte {
+				return TestReply(rpc, `<rpc-error><error-type>protocol</error-type><error-tag>lock-denied</error-tag><error-severity>error</error-severity></rpc-error>`)
+			},
+			check: func(t *testing.T, reply *RPCReply, err error) {
+				var rpcErrs *RPCErrors
+				if !errors.As(err, &rpcErrs) || rpcErrs.Errors()[0].Tag != "lock-denied" {
+					t.Errorf("expected lock-denied, got %v", err)
+				}
+			},
+		},
+		{
+			name: "slow",
+			handler: func(rpc []byte) []byte {
+				time.Sleep(200 * time.Millisecond)
+				return TestReply(rpc, "<ok/>")
+			},
+			ctx: 20 * time.Millisecond,
+			check: func(t *testing.T, reply *RPCReply, err error) {
+				if err != context.DeadlineExceeded {
+					t.Errorf("expected context.DeadlineExceeded, got %v", err)
+				}
+			},
+		},
+		{
+			name: "malformed chunk",
+			handler: func(rpc []byte) []byte {
+				srv.WriteRaw([]byte("\n#abc\n<ok/>"))
+				return nil
+			},
+			check: func(t *testing.T, reply *RPCReply, err error) {
+				if err == nil {
+					t.Error("expected a malformed chunk to fail the RPC")
+				}
+			},
+		},
+		{
+			name: "close",
+			handler: func(rpc []byte) []byte {
+				srv.Close()
+				return nil
+			},
+			check: func(t *testing.T, reply *RPCReply, err error) {
+				if err == nil {
+					t.Error("expected a connection lost to fail the RPC")
+				}
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			srv = NewTestServerWithCapabilities(tc.caps, tc.handler)
+			s := NewSession(srv.Transport())
+			if s.SessionID != 1 {
+				t.Fatalf("expected session-id 1, got %d", s.SessionID)
+			}
+
+			ctx := context.Background()
+			if tc.ctx > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.ctx)
+				defer cancel()
+			}
+			reply, err := s.ExecContext(ctx, MethodGetConfig("running"))
+			tc.check(t, reply, err)
+
+			s.Close()
+			<-srv.Done()
+		})
+	}
+}
+
+func TestTestReplyMessageID(t *testing.T) {
+	rpc := []byte(`<rpc message-id="a&quot;&amp;&lt;b" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><get/></rpc>`)
+
+	reply := TestReply(rpc, "<ok/>")
+	if _, err := newRPCReply(reply, false, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, messageID := parseMessageHeader(reply); messageID != `a"&<b` {
+		t.Errorf("unexpected message-id %q", messageID)
+	}
+}
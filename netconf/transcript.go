@@ -0,0 +1,175 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Directions of the messages of a transcript.
+const (
+	transcriptSent     = '>'
+	transcriptReceived = '<'
+)
+
+// transcript writes the messages sent and received by a transport. Each one
+// is written as a line holding its direction, the time and its length in
+// bytes, followed by the message and a newline.
+type transcript struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// record writes msg in the given direction.
+func (t *transcript) record(direction byte, msg []byte) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprintf(t.w, "%c %s %d\n%s\n", direction, time.Now().UTC().Format(time.RFC3339Nano), len(msg), msg)
+}
+
+func (t *TransportBasicIO) setTranscript(w io.Writer) {
+	t.transcript = &transcript{w: w}
+}
+
+// SetTranscript writes every message sent and received from now on to w, with
+// its direction and time, for debugging or for replaying the session with
+// ReplayTransport. The hello of the server is written first. Errors writing
+// to w are ignored. Messages read with ExecStream are held
+// in memory to be written once their reader is closed. Only transports
+// supporting it, such as TransportBasicIO, write transcripts. It must be
+// called before the session is used.
+func (s *Session) SetTranscript(w io.Writer) {
+	t, ok := s.Transport.(interface{ setTranscript(io.Writer) })
+	if !ok {
+		return
+	}
+
+	t.setTranscript(w)
+	if s.serverHello != nil {
+		(&transcript{w: w}).record(transcriptReceived, []byte(s.serverHello.RawHello))
+	}
+}
+
+// ReplayTransport is a Transport replaying the messages received in a
+// transcript written by Session.SetTranscript, to reproduce the replies of a
+// device in a test. The messages sent are discarded, each message received
+// being held until as many messages have been sent as were recorded before
+// it, whatever they are.
+type ReplayTransport struct {
+	r *bufio.Reader
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	// sent is the number of messages sent.
+	sent int
+	// recorded is the number of messages sent read from the transcript.
+	recorded int
+	closed   bool
+}
+
+// NewReplayTransport returns a ReplayTransport reading the transcript from r.
+func NewReplayTransport(r io.Reader) *ReplayTransport {
+	t := &ReplayTransport{r: bufio.NewReader(r)}
+	t.cond = sync.NewCond(&t.mu)
+	return t
+}
+
+// Send discards data.
+func (t *ReplayTransport) Send(data []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return io.ErrClosedPipe
+	}
+	t.sent++
+	t.cond.Broadcast()
+	return nil
+}
+
+// Receive returns the next message received in the transcript, io.EOF once
+// there is none left or the transport is closed.
+func (t *ReplayTransport) Receive() ([]byte, error) {
+	for {
+		line, err := t.r.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && line != "" {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+
+		var direction byte
+		var timestamp string
+		var length int
+		if _, err := fmt.Sscanf(line, "%c %s %d\n", &direction, &timestamp, &length); err != nil {
+			return nil, fmt.Errorf("netconf: invalid transcript record %q: %w", line, err)
+		}
+
+		msg := make([]byte, length+1)
+		if _, err := io.ReadFull(t.r, msg); err != nil {
+			return nil, err
+		}
+		t.mu.Lock()
+		if direction != transcriptReceived {
+			t.recorded++
+			t.mu.Unlock()
+			continue
+		}
+		for t.sent < t.recorded && !t.closed {
+			t.cond.Wait()
+		}
+		closed := t.closed
+		t.mu.Unlock()
+		if closed {
+			return nil, io.EOF
+		}
+		return msg[:length], nil
+	}
+}
+
+// Close stops the replay.
+func (t *ReplayTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.closed = true
+	t.cond.Broadcast()
+	return nil
+}
+
+// ReceiveHello returns the first message received in the transcript as the
+// hello of the server.
+func (t *ReplayTransport) ReceiveHello() (*HelloMessage, error) {
+	hello := new(HelloMessage)
+
+	val, err := t.Receive()
+	if err != nil {
+		return hello, err
+	}
+
+	err = xml.Unmarshal(val, hello)
+	hello.RawHello = string(val)
+	return hello, err
+}
+
+// SendHello discards hello.
+func (t *ReplayTransport) SendHello(hello *HelloMessage) error {
+	return nil
+}
+
+// SetVersion does nothing, messages being recorded without their framing.
+func (t *ReplayTransport) SetVersion(version string) {}
@@ -0,0 +1,83 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"bytes"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestTranscript(t *testing.T) {
+	srv := NewTestServer(func(rpc []byte) []byte {
+		return TestReply(rpc, "<data><version>1</version></data>")
+	})
+	s := NewSession(srv.Transport())
+
+	var transcript bytes.Buffer
+	s.SetTranscript(&transcript)
+
+	reply, err := s.Exec(MethodGetConfig("running"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := s.ExecStream(MethodGetConfig("running"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	streamed, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if err := s.Close(); err != nil {
+		t.Fatal("recording", err)
+	}
+
+	records := regexp.MustCompile(`(?m)^([<>]) \S+ (\d+)$`).FindAllStringSubmatch(transcript.String(), -1)
+	var directions []string
+	for _, record := range records {
+		directions = append(directions, record[1])
+	}
+	// The hello, both RPCs and close-session.
+	if expected := "< > < > < > <"; strings.Join(directions, " ") != expected {
+		t.Errorf("got records %v, expected %s", directions, expected)
+	}
+	if !strings.Contains(transcript.String(), "\n"+string(streamed)+"\n") {
+		t.Error("expected the streamed reply to be recorded")
+	}
+
+	// The replies are replayed in order.
+	replay := NewSession(NewReplayTransport(&transcript))
+	if replay.SessionID != s.SessionID {
+		t.Errorf("expected session-id %d, got %d", s.SessionID, replay.SessionID)
+	}
+	for i := 0; i < 2; i++ {
+		replayed, err := replay.Exec(MethodGetConfig("running"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if replayed.RawReply != reply.RawReply && replayed.RawReply != string(streamed) {
+			t.Errorf("unexpected replayed reply %q", replayed.RawReply)
+		}
+	}
+	if err := replay.Close(); err != nil {
+		t.Error(err)
+	}
+	if _, err := replay.Exec(MethodGetConfig("running")); err == nil {
+		t.Error("expected the replay to be over once the session is closed")
+	}
+}
+
+func TestReplayTransportInvalid(t *testing.T) {
+	tr := NewReplayTransport(strings.NewReader("<rpc-reply/>\n"))
+	if _, err := tr.Receive(); err == nil {
+		t.Error("expected an invalid record to fail")
+	}
+}
@@ -7,34 +7,103 @@
 package netconf
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"regexp"
-	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var ErrMalformedChunk = errors.New("netconf: invalid chunk")
 
+// ErrMessageTooLarge is returned when receiving a message larger than the
+// MaxMessageSize of the transport.
+var ErrMessageTooLarge = errors.New("netconf: message too large")
+
+// ErrTransportClosed is returned when the peer closes the transport in the
+// middle of a message, as a TransportClosedError. The session is lost, which
+// calls for reconnecting rather than for handling a malformed reply. Closing
+// between messages is reported as io.EOF instead.
+var ErrTransportClosed = errors.New("netconf: transport closed")
+
+// TransportClosedError is the error returned when the transport is closed in
+// the middle of a message. It matches ErrTransportClosed and
+// io.ErrUnexpectedEOF with errors.Is.
+type TransportClosedError struct {
+	// Partial holds the bytes of the incomplete message, as received, when
+	// KeepPartial is set on the transport.
+	Partial []byte
+}
+
+func (e *TransportClosedError) Error() string {
+	return "netconf: transport closed in the middle of a message"
+}
+
+func (e *TransportClosedError) Is(target error) bool {
+	return target == ErrTransportClosed
+}
+
+func (e *TransportClosedError) Unwrap() error {
+	return io.ErrUnexpectedEOF
+}
+
 const (
 	// msgSeperator is used to separate sent messages via NETCONF
 	msgSeperator     = "]]>]]>"
 	msgSeperator_v11 = "\n##\n"
 )
 
+// DefaultBufferSize is the size of the buffer used for each read from the
+// transport when TransportBasicIO.BufferSize is not set.
+const DefaultBufferSize = 8192
+
 // DefaultCapabilities sets the default capabilities of the client library
 var DefaultCapabilities = []string{
-	"urn:ietf:params:netconf:base:1.0",
-	"urn:ietf:params:netconf:base:1.1",
+	CapabilityBase10,
+	CapabilityBase11,
 }
 
 // HelloMessage is used when bringing up a NETCONF session
 type HelloMessage struct {
-	XMLName      xml.Name `xml:"urn:ietf:params:xml:ns:netconf:base:1.0 hello"`
-	Capabilities []string `xml:"capabilities>capability"`
-	SessionID    int      `xml:"session-id,omitempty"`
+	XMLName      xml.Name     `xml:"urn:ietf:params:xml:ns:netconf:base:1.0 hello"`
+	Capabilities Capabilities `xml:"capabilities>capability"`
+	SessionID    int          `xml:"session-id,omitempty"`
+	// RawCapabilities are the capabilities of a hello received, verbatim and
+	// in the order they were listed, Capabilities holding them with the
+	// whitespace around them removed. A proxy forwards the hello of a peer
+	// faithfully by sending them, e.g. with NewServerHello.
+	RawCapabilities []string `xml:"-"`
+	// RawHello is the hello as received, for debugging.
+	RawHello string `xml:"-"`
+}
+
+// UnmarshalXML decodes the hello, keeping its capabilities as received in
+// RawCapabilities.
+func (h *HelloMessage) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type hello HelloMessage
+	var decoded hello
+	if err := d.DecodeElement(&decoded, &start); err != nil {
+		return err
+	}
+
+	*h = HelloMessage(decoded)
+	if decoded.Capabilities == nil {
+		return nil
+	}
+	h.RawCapabilities = []string(decoded.Capabilities)
+	h.Capabilities = make(Capabilities, len(decoded.Capabilities))
+	for i, capability := range decoded.Capabilities {
+		h.Capabilities[i] = strings.TrimSpace(capability)
+	}
+	return nil
 }
 
 // Transport interface defines what characterisitics make up a NETCONF transport
@@ -48,10 +117,155 @@ type Transport interface {
 	SetVersion(version string)
 }
 
+// contextTransport is implemented by transports whose Send and Receive can be
+// bounded by a context.
+type contextTransport interface {
+	SendContext(ctx context.Context, data []byte) error
+	ReceiveContext(ctx context.Context) ([]byte, error)
+}
+
 type TransportBasicIO struct {
 	io.ReadWriteCloser
+
+	// BufferSize is the size of the scratch buffer each read from the
+	// underlying stream goes into, defaulting to DefaultBufferSize. Messages
+	// are accumulated in a separate buffer that grows as needed, so a larger
+	// size only saves reads on large replies at the cost of memory held while
+	// a message is being received, however small it is.
+	BufferSize int
+
 	//new add
 	version string
+
+	// pending holds bytes read past the end of the previous message.
+	pending []byte
+
+	// lastRead holds the time.Time data was last read from the stream.
+	lastRead atomic.Value
+
+	// MaxMessageSize, when non-zero, is the size in bytes of the largest
+	// message that can be received, protecting against peers exhausting
+	// memory. Receiving a larger message fails with ErrMessageTooLarge,
+	// leaving the transport unusable.
+	MaxMessageSize int
+
+	// MinChunkSize and MaxChunkSize bound the size of the chunks messages
+	// are sent in with 1.1 framing, defaulting to DefaultMinChunkSize and
+	// DefaultMaxChunkSize. The size starts at MinChunkSize and is tuned to
+	// the throughput measured writing each chunk, growing toward
+	// MaxChunkSize on fast links. Setting both to the same value pins the
+	// size, e.g. for tests. They must be set before the transport is used.
+	MinChunkSize int
+	MaxChunkSize int
+
+	// Logger, when set, receives the frames sent and received as trace
+	// messages.
+	Logger Logger
+
+	// KeepPartial, for debugging, keeps what was received of a message
+	// interrupted by the transport being closed in the TransportClosedError
+	// returned.
+	KeepPartial bool
+
+	// FrameEnd, when set, replaces the detection of the end of a message
+	// with 1.0 framing, for devices whose framing doesn't conform. It is
+	// given the data accumulated so far and returns the index the message
+	// ends at and the index the next message starts at, past any framing,
+	// or -1 for both when more data is needed. Chunked framing is not
+	// affected.
+	FrameEnd func(buf []byte) (end, next int, err error)
+
+	// Sanitize, when set, is given each message received, including the
+	// hello, and returns it with what keeps it from being parsed removed,
+	// e.g. junk or prompts some devices emit around it. Messages received
+	// as a stream by ExecStream are not sanitized.
+	Sanitize func(msg []byte) []byte
+
+	// xmlHeader, when set, starts every message sent instead of xml.Header
+	// starting the hello only, see SetXMLHeader.
+	xmlHeader *string
+
+	// transcript, when set, receives the messages sent and received.
+	transcript *transcript
+
+	// sizer tunes the size of the chunks sent.
+	sizer *chunkSizer
+}
+
+func (t *TransportBasicIO) setLogger(l Logger) {
+	t.Logger = l
+}
+
+func (t *TransportBasicIO) setQuirks(frameEnd func([]byte) (int, int, error), sanitize func([]byte) []byte) {
+	t.FrameEnd = frameEnd
+	t.Sanitize = sanitize
+}
+
+func (t *TransportBasicIO) setMaxMessageSize(n int) {
+	t.MaxMessageSize = n
+}
+
+func (t *TransportBasicIO) setChunkSize(min, max int) {
+	t.MinChunkSize = min
+	t.MaxChunkSize = max
+}
+
+// chunkSizer returns the chunkSizer of the transport, created on first use
+// from MinChunkSize and MaxChunkSize.
+func (t *TransportBasicIO) chunkSizer() *chunkSizer {
+	if t.sizer == nil {
+		min, max := t.MinChunkSize, t.MaxChunkSize
+		if min <= 0 {
+			min = DefaultMinChunkSize
+		}
+		if max <= 0 {
+			max = DefaultMaxChunkSize
+		}
+		if min > max {
+			min = max
+		}
+		t.sizer = &chunkSizer{min: min, max: max}
+	}
+	return t.sizer
+}
+
+// lastActivity returns when data was last read from the stream.
+func (t *TransportBasicIO) lastActivity() time.Time {
+	last, _ := t.lastRead.Load().(time.Time)
+	return last
+}
+
+func (t *TransportBasicIO) bufferSize() int {
+	if t.BufferSize > 0 {
+		return t.BufferSize
+	}
+	return DefaultBufferSize
+}
+
+// closedError returns the error for the transport closed after partial was
+// received of a message.
+func (t *TransportBasicIO) closedError(partial []byte) error {
+	err := &TransportClosedError{}
+	if t.KeepPartial {
+		err.Partial = append([]byte(nil), partial...)
+	}
+	return err
+}
+
+// checkSize returns ErrMessageTooLarge when n exceeds t.MaxMessageSize.
+func (t *TransportBasicIO) checkSize(n int) error {
+	if t.MaxMessageSize > 0 && n > t.MaxMessageSize {
+		return fmt.Errorf("%w: more than %d bytes", ErrMessageTooLarge, t.MaxMessageSize)
+	}
+	return nil
+}
+
+// SetXMLHeader makes every message sent, the hello included, start with
+// header, e.g. an XML declaration with a specific encoding, for devices picky
+// about it. An empty header omits the XML declaration from all messages. By
+// default only the hello starts with xml.Header.
+func (t *TransportBasicIO) SetXMLHeader(header string) {
+	t.xmlHeader = &header
 }
 
 func (t *TransportBasicIO) SetVersion(version string) {
@@ -59,38 +273,285 @@ func (t *TransportBasicIO) SetVersion(version string) {
 }
 
 // Sends a well formated NETCONF rpc message as a slice of bytes adding on the
-// nessisary framining messages.
+// nessisary framining messages. With 1.1 framing, data is split in chunks,
+// sized as set by MinChunkSize and MaxChunkSize, written without being copied.
+// A header set with SetXMLHeader is written before data, in its own chunk.
 func (t *TransportBasicIO) Send(data []byte) error {
-	var seperator []byte
-	var dataInfo []byte
-	//headlen := 0
-	if t.version == "v1.1" {
-		seperator = append(seperator, []byte(msgSeperator_v11)...)
-	} else {
-		seperator = append(seperator, []byte(msgSeperator)...)
+	var header []byte
+	if t.xmlHeader != nil && *t.xmlHeader != "" {
+		header = []byte(*t.xmlHeader)
 	}
 
+	t.transcript.record(transcriptSent, data)
 	if t.version == "v1.1" {
-		header := fmt.Sprintf("\n#%d\n", len(string(data)))
-		dataInfo = append(dataInfo, header...)
-		//t.Write([]byte(header))
-		//headlen = len([]byte(header))
+		w := io.Writer(t.ReadWriteCloser)
+		var traced bytes.Buffer
+		if t.Logger != nil {
+			w = io.MultiWriter(w, &traced)
+			defer func() { t.Logger.Tracef("send: %s", traced.Bytes()) }()
+		}
+		if len(header) > 0 {
+			chunk := appendChunks(nil, header, len(header))
+			if _, err := chunk.WriteTo(w); err != nil {
+				return err
+			}
+		}
+		if err := writeChunks(w, data, t.chunkSizer()); err != nil {
+			return err
+		}
+		_, err := io.WriteString(w, msgSeperator_v11)
+		return err
+	}
+
+	frames := net.Buffers{header, data, []byte(msgSeperator)}
+	if t.Logger != nil {
+		t.Logger.Tracef("send: %s", bytes.Join(frames, nil))
 	}
-	dataInfo = append(dataInfo, data...)
-	dataInfo = append(dataInfo, seperator...)
-	_, err := t.Write(dataInfo)
+	_, err := frames.WriteTo(t.ReadWriteCloser)
 
 	return err
 }
 
+// streamSender is implemented by transports able to send a message as it is
+// produced.
+type streamSender interface {
+	// sendStream sends the message written by write, framing it as it is
+	// written.
+	sendStream(write func(io.Writer) error) error
+}
+
+func (t *TransportBasicIO) sendStream(write func(io.Writer) error) error {
+	bw := bufio.NewWriterSize(traceWriter{t}, t.bufferSize())
+
+	var w io.Writer = bw
+	seperator := msgSeperator
+	if t.version == "v1.1" {
+		w = &chunkWriter{w: bw, sizer: t.chunkSizer()}
+		seperator = msgSeperator_v11
+	}
+
+	if t.xmlHeader != nil && *t.xmlHeader != "" {
+		if _, err := io.WriteString(w, *t.xmlHeader); err != nil {
+			return err
+		}
+	}
+
+	var recorded bytes.Buffer
+	if t.transcript != nil {
+		w = io.MultiWriter(w, &recorded)
+	}
+	if err := write(w); err != nil {
+		return err
+	}
+	t.transcript.record(transcriptSent, recorded.Bytes())
+	if _, err := bw.WriteString(seperator); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// traceWriter writes to the transport, tracing what is sent.
+type traceWriter struct {
+	t *TransportBasicIO
+}
+
+func (w traceWriter) Write(p []byte) (int, error) {
+	logger(w.t.Logger).Tracef("send: %s", p)
+	return w.t.Write(p)
+}
+
 func (t *TransportBasicIO) Receive() ([]byte, error) {
-	var seperator []byte
+	var msg []byte
+	var err error
+	switch {
+	case t.version == "v1.1":
+		msg, err = t.receiveChunked()
+	case t.FrameEnd != nil:
+		msg, err = t.waitFor(t.FrameEnd)
+	default:
+		msg, err = t.WaitForDocument([]byte(msgSeperator))
+	}
+
+	if err == nil && t.Sanitize != nil {
+		msg = t.Sanitize(msg)
+	}
+	if err == nil {
+		t.transcript.record(transcriptReceived, msg)
+	}
+	return msg, err
+}
+
+// receiveChunked reads a message framed in chunks, decoding the chunks as they
+// arrive.
+func (t *TransportBasicIO) receiveChunked() ([]byte, error) {
+	var d chunkDecoder
+	var msg, wire bytes.Buffer
+
+	in := t.pending
+	t.pending = nil
+	buf := make([]byte, t.bufferSize())
+	var err error
+	for {
+		n, done, derr := d.decode(&msg, in)
+		if t.Logger != nil || t.KeepPartial {
+			wire.Write(in[:n])
+		}
+		if derr != nil {
+			return nil, derr
+		}
+		if err := t.checkSize(msg.Len()); err != nil {
+			return nil, err
+		}
+		if done {
+			if n < len(in) {
+				t.pending = append([]byte(nil), in[n:]...)
+			}
+			logger(t.Logger).Tracef("receive: %s", wire.Bytes())
+			return msg.Bytes(), nil
+		}
+
+		if err != nil {
+			if err == io.EOF && (d != (chunkDecoder{}) || msg.Len() > 0) {
+				return nil, t.closedError(wire.Bytes())
+			}
+			return nil, err
+		}
+
+		var rn int
+		rn, err = t.Read(buf)
+		if rn > 0 {
+			t.lastRead.Store(time.Now())
+		}
+		in = buf[:rn]
+	}
+}
+
+// SendContext is like Send but gives up when ctx is done before the message
+// has been written. See ReceiveContext for the state the transport is left in.
+func (t *TransportBasicIO) SendContext(ctx context.Context, data []byte) error {
+	_, err := doContext(ctx, func() ([]byte, error) {
+		return nil, t.Send(data)
+	}, func() {
+		t.abort(func(d deadliner) error { return d.SetWriteDeadline(aLongTimeAgo) })
+	})
+	return err
+}
+
+// ReceiveContext is like Receive but gives up when ctx is done before a full
+// message has been read, returning ctx.Err(). The pending read is unblocked
+// by expiring the read deadline when the underlying stream supports it and by
+// closing the stream otherwise. Whatever was read of the partial message is
+// discarded, so the transport is out of sync with the peer and should only be
+// closed afterwards.
+func (t *TransportBasicIO) ReceiveContext(ctx context.Context) ([]byte, error) {
+	return doContext(ctx, t.Receive, func() {
+		t.abort(func(d deadliner) error { return d.SetReadDeadline(aLongTimeAgo) })
+	})
+}
+
+// Drain resynchronizes the transport with the peer after a protocol error
+// left part of a message unread, e.g. ErrMessageTooLarge, by reading and
+// discarding everything up to and including the next end of message marker:
+// "]]>]]>" with 1.0 framing and "\n##\n" with chunked framing. Bytes already
+// read past the previous message count, so a complete message waiting there
+// is discarded too. Drain gives up when ctx is done, leaving the transport as
+// ReceiveContext does, to be closed.
+func (t *TransportBasicIO) Drain(ctx context.Context) error {
+	separator := msgSeperator
 	if t.version == "v1.1" {
-		seperator = append(seperator, []byte(msgSeperator_v11)...)
-	} else {
-		seperator = append(seperator, []byte(msgSeperator)...)
+		separator = msgSeperator_v11
+	}
+
+	_, err := doContext(ctx, func() ([]byte, error) {
+		return nil, t.drain([]byte(separator))
+	}, func() {
+		t.abort(func(d deadliner) error { return d.SetReadDeadline(aLongTimeAgo) })
+	})
+	return err
+}
+
+// drain discards the data read up to and including separator, only keeping
+// what may hold its start, so that MaxMessageSize doesn't apply.
+func (t *TransportBasicIO) drain(separator []byte) error {
+	data := t.pending
+	t.pending = nil
+
+	buf := make([]byte, t.bufferSize())
+	var err error
+	for {
+		if i := bytes.Index(data, separator); i > -1 {
+			if rest := data[i+len(separator):]; len(rest) > 0 {
+				t.pending = append([]byte(nil), rest...)
+			}
+			return nil
+		}
+		if keep := len(separator) - 1; len(data) > keep {
+			data = append([]byte(nil), data[len(data)-keep:]...)
+		}
+
+		if err == io.EOF {
+			return t.closedError(nil)
+		}
+		if err != nil {
+			return err
+		}
+
+		var n int
+		n, err = t.Read(buf)
+		if n > 0 {
+			t.lastRead.Store(time.Now())
+		}
+		data = append(data, buf[:n]...)
+	}
+}
+
+// deadliner is implemented by streams such as net.Conn that support I/O
+// deadlines.
+type deadliner interface {
+	SetReadDeadline(time.Time) error
+	SetWriteDeadline(time.Time) error
+}
+
+// aLongTimeAgo is a deadline in the past, used to unblock pending I/O.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// abort unblocks pending I/O on the underlying stream, using expire if it
+// supports deadlines and closing it otherwise.
+func (t *TransportBasicIO) abort(expire func(deadliner) error) {
+	if d, ok := t.ReadWriteCloser.(deadliner); ok && expire(d) == nil {
+		return
+	}
+	t.ReadWriteCloser.Close()
+}
+
+// doContext runs the blocking operation f until it completes or ctx is done.
+// When ctx is done first, abort is called to unblock f and ctx.Err() is
+// returned; the result of f is then dropped.
+func doContext(ctx context.Context, f func() ([]byte, error), abort func()) ([]byte, error) {
+	if ctx.Done() == nil {
+		return f()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		data []byte
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		data, err := f()
+		done <- result{data, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.data, r.err
+	case <-ctx.Done():
+		abort()
+		return nil, ctx.Err()
 	}
-	return t.WaitForBytes([]byte(seperator))
 }
 
 func (t *TransportBasicIO) SendHello(hello *HelloMessage) error {
@@ -99,10 +560,11 @@ func (t *TransportBasicIO) SendHello(hello *HelloMessage) error {
 		return err
 	}
 
-	header := []byte(xml.Header)
-	val = append(header, val...)
-	err = t.Send(val)
-	return err
+	// A header set with SetXMLHeader is added by Send.
+	if t.xmlHeader == nil {
+		val = append([]byte(xml.Header), val...)
+	}
+	return t.Send(val)
 }
 
 func (t *TransportBasicIO) ReceiveHello() (*HelloMessage, error) {
@@ -114,6 +576,7 @@ func (t *TransportBasicIO) ReceiveHello() (*HelloMessage, error) {
 	}
 
 	err = xml.Unmarshal(val, hello)
+	hello.RawHello = string(val)
 	return hello, err
 }
 
@@ -123,56 +586,198 @@ func (t *TransportBasicIO) Writeln(b []byte) (int, error) {
 	return 0, nil
 }
 
+// WaitForFunc reads from the transport until f finds the end of a message in
+// the data accumulated, returning the index it ends at, or -1 when more data
+// is needed. f is given all the data accumulated after each read, so that it
+// may rescan it from the start each time, which gets slow on large messages;
+// WaitForBytes and WaitForDocument, used by Receive, only scan what was not
+// scanned yet.
 func (t *TransportBasicIO) WaitForFunc(f func([]byte) (int, error)) ([]byte, error) {
+	return t.waitFor(func(buf []byte) (int, int, error) {
+		end, err := f(buf)
+		return end, end, err
+	})
+}
+
+// waitFor accumulates data read from the transport until f finds the end of
+// a message in it. f returns the end of the message and the offset the next
+// message starts at, or -1 when more data is needed. Bytes past that offset
+// are kept for the next call.
+func (t *TransportBasicIO) waitFor(f func([]byte) (int, int, error)) ([]byte, error) {
 	var out bytes.Buffer
-	buf := make([]byte, 8192)
+	out.Write(t.pending)
+	t.pending = nil
 
-	pos := 0
+	buf := make([]byte, t.bufferSize())
+	n := out.Len()
+	var err error
 	for {
-		n, err := t.Read(buf[pos : pos+(len(buf)/2)])
-		if err != nil {
-			if err != io.EOF {
-				return nil, err
-			}
-			break
-		}
-
 		if n > 0 {
-			end, err := f(buf[0 : pos+n])
-			if err != nil {
-				return nil, err
+			end, next, ferr := f(out.Bytes())
+			if ferr != nil {
+				return nil, ferr
 			}
 
 			if end > -1 {
-				if t.version == "v1.1" {
-					// end + len(msgSeperator_v11) is always lt len(buf)
-					end, err = parseChuncks(buf, end+len(msgSeperator_v11))
-					if err != nil {
-						return nil, err
-					}
+				data := out.Bytes()
+				if next < len(data) {
+					t.pending = append([]byte(nil), data[next:]...)
 				}
-				out.Write(buf[0:end])
-				return out.Bytes(), nil
+				logger(t.Logger).Tracef("receive: %s", data[:next])
+				return data[:end], nil
 			}
+		}
 
-			if pos > 0 {
-				out.Write(buf[0:pos])
-				copy(buf, buf[pos:pos+n])
+		if err != nil {
+			if err != io.EOF || len(bytes.TrimSpace(out.Bytes())) == 0 {
+				return nil, err
 			}
+			return nil, t.closedError(out.Bytes())
+		}
 
-			pos = n
+		n, err = t.Read(buf)
+		if n > 0 {
+			t.lastRead.Store(time.Now())
+		}
+		out.Write(buf[:n])
+		if err := t.checkSize(out.Len()); err != nil {
+			return nil, err
 		}
 	}
-
-	return nil, fmt.Errorf("WaitForFunc failed")
 }
 
 func (t *TransportBasicIO) WaitForBytes(b []byte) ([]byte, error) {
-	return t.WaitForFunc(func(buf []byte) (int, error) {
-		return bytes.Index(buf, b), nil
+	from := 0
+	return t.waitFor(func(buf []byte) (int, int, error) {
+		if i := bytes.Index(buf[from:], b); i > -1 {
+			return from + i, from + i + len(b), nil
+		}
+
+		// Only the tail that may hold the start of b needs scanning again.
+		if from = len(buf) - len(b) + 1; from < 0 {
+			from = 0
+		}
+		return -1, -1, nil
 	})
 }
 
+// WaitForDocument is like WaitForBytes but only accepts an occurrence of b
+// that follows a complete XML document. This keeps the NETCONF 1.0 end of
+// message marker from ending a message early when it appears inside the
+// document itself, e.g. in an attribute value, comment or CDATA section.
+func (t *TransportBasicIO) WaitForDocument(b []byte) ([]byte, error) {
+	from := 0
+	var doc documentScanner
+	return t.waitFor(func(buf []byte) (int, int, error) {
+		for {
+			i := bytes.Index(buf[from:], b)
+			if i < 0 {
+				break
+			}
+
+			end := from + i
+			if doc.complete(buf, end) {
+				return end, end + len(b), nil
+			}
+			from = end + 1
+		}
+
+		// Only the tail that may hold the start of b needs scanning again.
+		if tail := len(buf) - len(b) + 1; tail > from {
+			from = tail
+		}
+		return -1, -1, nil
+	})
+}
+
+// Constructs of an XML document tracked by documentScanner.
+const (
+	inText = iota
+	inTag
+	inQuote
+	inComment
+	inCDATA
+	inProcInst
+)
+
+// documentScanner follows an XML document as it is received, to tell whether
+// it is complete at a given offset without parsing it again from the start.
+// Syntax errors are left for the XML parser to report on the message.
+type documentScanner struct {
+	// pos is the offset scanned up to.
+	pos   int
+	state int
+	// quote is the delimiter of the attribute value in the inQuote state.
+	quote byte
+	// closing and directive are set in the inTag state for an end tag and
+	// for a declaration such as DOCTYPE.
+	closing   bool
+	directive bool
+	// depth is the number of elements open.
+	depth int
+}
+
+// complete scans buf up to end and reports whether it holds a complete
+// document there, i.e. outside of any markup and of the root element.
+func (d *documentScanner) complete(buf []byte, end int) bool {
+	for d.pos < end {
+		c := buf[d.pos]
+		d.pos++
+
+		switch d.state {
+		case inText:
+			if c != '<' {
+				continue
+			}
+			rest := buf[d.pos:]
+			switch {
+			case bytes.HasPrefix(rest, []byte("!--")):
+				d.state, d.pos = inComment, d.pos+3
+			case bytes.HasPrefix(rest, []byte("![CDATA[")):
+				d.state, d.pos = inCDATA, d.pos+8
+			case bytes.HasPrefix(rest, []byte("?")):
+				d.state, d.pos = inProcInst, d.pos+1
+			default:
+				d.state = inTag
+				d.closing = bytes.HasPrefix(rest, []byte("/"))
+				d.directive = bytes.HasPrefix(rest, []byte("!"))
+			}
+		case inTag:
+			switch c {
+			case '"', '\'':
+				d.state, d.quote = inQuote, c
+			case '>':
+				d.state = inText
+				switch {
+				case d.directive:
+				case d.closing:
+					d.depth--
+				case buf[d.pos-2] != '/':
+					d.depth++
+				}
+			}
+		case inQuote:
+			if c == d.quote {
+				d.state = inTag
+			}
+		case inComment:
+			if c == '-' && bytes.HasPrefix(buf[d.pos:], []byte("->")) {
+				d.state, d.pos = inText, d.pos+2
+			}
+		case inCDATA:
+			if c == ']' && bytes.HasPrefix(buf[d.pos:], []byte("]>")) {
+				d.state, d.pos = inText, d.pos+2
+			}
+		case inProcInst:
+			if c == '?' && bytes.HasPrefix(buf[d.pos:], []byte(">")) {
+				d.state, d.pos = inText, d.pos+1
+			}
+		}
+	}
+
+	return d.state == inText && d.depth <= 0
+}
+
 func (t *TransportBasicIO) WaitForString(s string) (string, error) {
 	out, err := t.WaitForBytes([]byte(s))
 	if out != nil {
@@ -200,44 +805,42 @@ func (t *TransportBasicIO) WaitForRegexp(re *regexp.Regexp) ([]byte, [][]byte, e
 type ReadWriteCloser struct {
 	io.Reader
 	io.WriteCloser
+
+	// closeFunc, when set, is called by Close once both sides are closed.
+	closeFunc func() error
+	once      sync.Once
+	err       error
 }
 
 // NewReadWriteCloser creates a new combined IO Reader and Write Closer from the
 // provided objects
 func NewReadWriteCloser(r io.Reader, w io.WriteCloser) *ReadWriteCloser {
-	return &ReadWriteCloser{r, w}
+	return &ReadWriteCloser{Reader: r, WriteCloser: w}
 }
 
-func parseChuncks(buf []byte, end int) (int, error) {
-	i := 0
-	length := 0
-	for i < end-1 {
-		if buf[i] != '\n' || buf[i+1] != '#' {
-			// looking for start of chunk delimiter \n#
-			i++
-			continue
-		}
-		j := i + 2
-		for j < end {
-			if buf[j] == '\n' {
-				break
+// NewReadWriteCloserFunc is like NewReadWriteCloser but Close also calls
+// closeFunc, to tear down what r and w are the streams of, such as a SSH
+// session, so that a pending read is unblocked.
+func NewReadWriteCloserFunc(r io.Reader, w io.WriteCloser, closeFunc func() error) *ReadWriteCloser {
+	return &ReadWriteCloser{Reader: r, WriteCloser: w, closeFunc: closeFunc}
+}
+
+// Close closes the writer, then the reader when it is an io.Closer, then calls
+// the close function if any, returning the first error. Only the first call
+// closes anything, later ones return the same error.
+func (rwc *ReadWriteCloser) Close() error {
+	rwc.once.Do(func() {
+		rwc.err = rwc.WriteCloser.Close()
+		if c, ok := rwc.Reader.(io.Closer); ok {
+			if err := c.Close(); rwc.err == nil {
+				rwc.err = err
 			}
-			j++
 		}
-		if buf[j-1] == '#' {
-			return length, nil
-		}
-		chunkSize, err := strconv.Atoi(string(buf[i+2 : j]))
-		if err != nil {
-			return length, err
-		}
-		startChunk := j + 1
-		endChunk := startChunk + chunkSize - 1
-		if endChunk > end {
-			return length, ErrMalformedChunk
+		if rwc.closeFunc != nil {
+			if err := rwc.closeFunc(); rwc.err == nil {
+				rwc.err = err
+			}
 		}
-		length += copy(buf[length:], buf[startChunk:endChunk+1])
-		i = endChunk + 1
-	}
-	return length, nil
+	})
+	return rwc.err
 }
@@ -51,5 +51,5 @@ func DialJunos() (*Session, error) {
 	if err != nil {
 		return nil, err
 	}
-	return NewSession(&t), nil
+	return startSession(&t, newOptions(nil))
 }
@@ -0,0 +1,55 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"io"
+)
+
+// MemoryTransport is a Transport connected in memory to its peer, for testing
+// code using this package without a device. Messages go through the framing
+// of TransportBasicIO, both end of message markers and chunks.
+type MemoryTransport struct {
+	TransportBasicIO
+}
+
+// NewMemoryTransport returns both ends of an in-memory connection: client for
+// the session under test, see NewSession, and server for a fake server, which
+// sends its hello with SendHello, reads requests with Receive and answers them
+// with Send. Each end must call SetVersion once hellos have been exchanged for
+// 1.1 framing to be used. Writes block until the peer reads them.
+func NewMemoryTransport() (client, server *MemoryTransport) {
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+
+	client = &MemoryTransport{}
+	client.ReadWriteCloser = &memoryConn{r: clientReader, w: clientWriter}
+	server = &MemoryTransport{}
+	server.ReadWriteCloser = &memoryConn{r: serverReader, w: serverWriter}
+	return client, server
+}
+
+// memoryConn is one end of an in-memory connection.
+type memoryConn struct {
+	r *io.PipeReader
+	w *io.PipeWriter
+}
+
+func (c *memoryConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+func (c *memoryConn) Write(p []byte) (int, error) {
+	return c.w.Write(p)
+}
+
+// Close closes both directions: the peer reads io.EOF, and pending reads and
+// writes of either end fail.
+func (c *memoryConn) Close() error {
+	c.r.Close()
+	return c.w.Close()
+}
@@ -0,0 +1,68 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestMemoryTransport(t *testing.T) {
+	tt := []struct {
+		name    string
+		caps    []string
+		version string
+	}{
+		{"netconf10", []string{CapabilityBase10}, "v1.0"},
+		{"netconf11", DefaultCapabilities, "v1.1"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			client, server := NewMemoryTransport()
+
+			closed := make(chan error, 1)
+			go func() {
+				if err := server.SendHello(&HelloMessage{Capabilities: tc.caps, SessionID: 7}); err != nil {
+					closed <- err
+					return
+				}
+				if _, err := server.ReceiveHello(); err != nil {
+					closed <- err
+					return
+				}
+				server.SetVersion(tc.version)
+				for {
+					req, err := server.Receive()
+					if err != nil {
+						closed <- err
+						return
+					}
+					server.Send([]byte(fmt.Sprintf(`<rpc-reply message-id="%s"><data/></rpc-reply>`, replyMessageID(req))))
+				}
+			}()
+
+			s := NewSession(client)
+			if s.SessionID != 7 {
+				t.Errorf("expected session-id 7, got %d", s.SessionID)
+			}
+			reply, err := s.Exec(MethodGetConfig("running"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reply.Data != "<data/>" {
+				t.Errorf("unexpected reply data %q", reply.Data)
+			}
+
+			s.ForceClose()
+			if err := <-closed; err != io.EOF {
+				t.Errorf("expected the server to read io.EOF, got %v", err)
+			}
+		})
+	}
+}
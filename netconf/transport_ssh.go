@@ -9,15 +9,20 @@ package netconf
 import (
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
 )
 
 const (
@@ -26,6 +31,21 @@ const (
 	sshDefaultPort = 830
 	// sshNetconfSubsystem sets the SSH subsystem to NETCONF
 	sshNetconfSubsystem = "netconf"
+	// sshJumpDefaultPort is the default SSH port of jump hosts
+	sshJumpDefaultPort = 22
+)
+
+var (
+	// ErrHostKeyMismatch is returned by host key callbacks from
+	// KnownHostsCallback when the server presents a different key than the
+	// one known for it, which may indicate a man-in-the-middle attack.
+	ErrHostKeyMismatch = errors.New("netconf: ssh host key mismatch")
+	// ErrUnknownHostKey is returned by host key callbacks from
+	// KnownHostsCallback when no key is known for the server.
+	ErrUnknownHostKey = errors.New("netconf: ssh host key unknown")
+	// ErrSSHAgentUnavailable is returned by SSHConfigAgent when no ssh-agent
+	// can be reached.
+	ErrSSHAgentUnavailable = errors.New("netconf: ssh agent unavailable")
 )
 
 // TransportSSH maintains the information necessary to communicate with the
@@ -34,6 +54,9 @@ type TransportSSH struct {
 	TransportBasicIO
 	sshClient  *ssh.Client
 	sshSession *ssh.Session
+	// jumps are the connections to the jump hosts target is reached through.
+	jumps []*ssh.Client
+	opts  options
 }
 
 // Close closes an existing SSH session and socket if they exist.
@@ -42,10 +65,13 @@ func (t *TransportSSH) Close() error {
 	if t == nil {
 		return nil
 	}
+	defer t.closeJumps()
 
 	// Close the SSH Session if we have one
 	if t.sshSession != nil {
-		if err := t.sshSession.Close(); err != nil {
+		// io.EOF means the session was closed already, along with its
+		// streams.
+		if err := t.sshSession.Close(); err != nil && err != io.EOF {
 			// If we receive an error when trying to close the session, then
 			// lets try to close the socket, otherwise it will be left open
 			t.sshClient.Close()
@@ -60,31 +86,112 @@ func (t *TransportSSH) Close() error {
 	return fmt.Errorf("No connection to close")
 }
 
+// closeJumps closes the connections to the jump hosts, the last one first.
+func (t *TransportSSH) closeJumps() {
+	for i := len(t.jumps) - 1; i >= 0; i-- {
+		t.jumps[i].Close()
+	}
+}
+
 // Dial connects and establishes SSH sessions
 //
 // target can be an IP address (e.g.) 172.16.1.1 which utlizes the default
 // NETCONF over SSH port of 830.  Target can also specify a port with the
-// following format <host>:<port (e.g 172.16.1.1:22)
+// following format <host>:<port (e.g 172.16.1.1:22), IPv6 addresses being
+// enclosed in brackets when a port is given (e.g. [2001:db8::1]:22)
 //
 // config takes a ssh.ClientConfig connection. See documentation for
 // go.crypto/ssh for documenation.  There is a helper function SSHConfigPassword
-// that returns a ssh.ClientConfig for simple username/password authentication
-func (t *TransportSSH) Dial(target string, config *ssh.ClientConfig) error {
-	if !strings.Contains(target, ":") {
-		target = fmt.Sprintf("%s:%d", target, sshDefaultPort)
-	}
-
+// that returns a ssh.ClientConfig for simple username/password authentication,
+// and SSHConfigAuth for any other combination of auth methods.
+//
+// The connection attempt is bounded by config.Timeout when set. opts set how
+// NETCONF is started in the SSH session, see WithSubsystem, and how the
+// device is connected to, see WithDialer.
+func (t *TransportSSH) Dial(target string, config *ssh.ClientConfig, opts ...Option) error {
 	var err error
+	t.opts = newOptions(opts)
 
-	t.sshClient, err = ssh.Dial("tcp", target, config)
+	addr := sshTarget(target)
+	conn, err := t.opts.dial(addr, config.Timeout)
 	if err != nil {
 		return err
 	}
 
+	config, hostKeyErr := recordHostKeyErr(t.opts.sshClientConfig(config))
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return hostKeyErr(err)
+	}
+	t.sshClient = ssh.NewClient(c, chans, reqs)
+
 	err = t.setupSession()
 	return err
 }
 
+// sshTarget adds the default NETCONF over SSH port to target if it has none.
+func sshTarget(target string) string {
+	return withDefaultPort(target, sshDefaultPort)
+}
+
+// withDefaultPort adds port to target if it has none, target being a host
+// name or an IP address, IPv6 ones possibly enclosed in brackets.
+func withDefaultPort(target string, port int) string {
+	if _, _, err := net.SplitHostPort(target); err == nil {
+		return target
+	}
+	host := strings.TrimSuffix(strings.TrimPrefix(target, "["), "]")
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// dialJumps connects to target through the chain of jump hosts and
+// establishes the SSH session over the last connection.
+func (t *TransportSSH) dialJumps(target string, config *ssh.ClientConfig, jumps []SSHJump) error {
+	if len(jumps) == 0 {
+		return t.Dial(target, config)
+	}
+	t.opts = newOptions(nil)
+
+	jumpConfig, hostKeyErr := recordHostKeyErr(jumps[0].Config)
+	client, err := ssh.Dial("tcp", withDefaultPort(jumps[0].Target, sshJumpDefaultPort), jumpConfig)
+	if err != nil {
+		return hostKeyErr(err)
+	}
+	t.jumps = append(t.jumps, client)
+
+	for _, jump := range jumps[1:] {
+		client, err = dialThrough(client, withDefaultPort(jump.Target, sshJumpDefaultPort), jump.Config)
+		if err != nil {
+			return err
+		}
+		t.jumps = append(t.jumps, client)
+	}
+
+	t.sshClient, err = dialThrough(client, sshTarget(target), config)
+	if err != nil {
+		return err
+	}
+	return t.setupSession()
+}
+
+// dialThrough connects to addr with a direct-tcpip channel of client and
+// establishes a SSH connection over it.
+func dialThrough(client *ssh.Client, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := client.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	config, hostKeyErr := recordHostKeyErr(config)
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, hostKeyErr(err)
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
 func (t *TransportSSH) setupSession() error {
 	var err error
 
@@ -103,49 +210,186 @@ func (t *TransportSSH) setupSession() error {
 		return err
 	}
 
-	t.ReadWriteCloser = NewReadWriteCloser(reader, writer)
-	return t.sshSession.RequestSubsystem(sshNetconfSubsystem)
+	t.ReadWriteCloser = NewReadWriteCloserFunc(reader, writer, t.sshSession.Close)
+
+	if t.opts.pty {
+		modes := ssh.TerminalModes{ssh.ECHO: 0, ssh.ONLCR: 0}
+		if err := t.sshSession.RequestPty("vt100", 24, 80, modes); err != nil {
+			return err
+		}
+	}
+	if t.opts.command != "" {
+		err = t.sshSession.Start(t.opts.command)
+	} else {
+		err = t.sshSession.RequestSubsystem(t.opts.subsystem)
+	}
+	if err != nil {
+		return err
+	}
+
+	if t.opts.keepaliveInterval > 0 {
+		conn := &keepaliveConn{ReadWriteCloser: t.ReadWriteCloser}
+		t.ReadWriteCloser = conn
+		go t.keepalive(conn)
+	}
+	return nil
+}
+
+// keepalive sends SSH keepalives until the connection is closed, closing it
+// when too many go unanswered.
+func (t *TransportSSH) keepalive(conn *keepaliveConn) {
+	interval := t.opts.keepaliveInterval
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	missed := 0
+	for range ticker.C {
+		replied := make(chan error, 1)
+		go func() {
+			_, _, err := t.sshClient.SendRequest("keepalive@openssh.com", true, nil)
+			replied <- err
+		}()
+
+		timer := time.NewTimer(interval)
+		select {
+		case err := <-replied:
+			timer.Stop()
+			if err != nil {
+				return
+			}
+			missed = 0
+		case <-timer.C:
+			missed++
+			if missed >= t.opts.keepaliveMaxMissed {
+				conn.fail(fmt.Errorf("%w: %d ssh keepalives unanswered", ErrTransportClosed, missed))
+				t.sshClient.Close()
+				return
+			}
+		}
+	}
+}
+
+// keepaliveConn fails reads and writes with the error of the keepalives once
+// they closed the connection.
+type keepaliveConn struct {
+	io.ReadWriteCloser
+
+	mu  sync.Mutex
+	err error
+}
+
+func (c *keepaliveConn) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+}
+
+func (c *keepaliveConn) failure(err error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	return err
+}
+
+func (c *keepaliveConn) Read(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Read(p)
+	if err != nil {
+		err = c.failure(err)
+	}
+	return n, err
+}
+
+func (c *keepaliveConn) Write(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Write(p)
+	if err != nil {
+		err = c.failure(err)
+	}
+	return n, err
 }
 
 // NewSSHSession creates a new NETCONF session using an existing net.Conn.
-func NewSSHSession(conn net.Conn, config *ssh.ClientConfig) (*Session, error) {
-	t, err := connToTransport(conn, config)
+func NewSSHSession(conn net.Conn, config *ssh.ClientConfig, opts ...Option) (*Session, error) {
+	t, err := connToTransport(conn, config, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	return NewSession(t), nil
+	return startSession(t, t.opts)
 }
 
 // DialSSH creates a new NETCONF session using a SSH Transport.
 // See TransportSSH.Dial for arguments.
-func DialSSH(target string, config *ssh.ClientConfig) (*Session, error) {
+func DialSSH(target string, config *ssh.ClientConfig, opts ...Option) (*Session, error) {
+	var t TransportSSH
+	err := t.Dial(target, config, opts...)
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+	return startSession(&t, t.opts)
+}
+
+// SSHJump is a jump host, or bastion, through which a device is reached.
+type SSHJump struct {
+	// Target is the address of the jump host, on port 22 unless it specifies
+	// one.
+	Target string
+	// Config is used to connect to the jump host.
+	Config *ssh.ClientConfig
+}
+
+// DialSSHProxy creates a new NETCONF session using a SSH Transport tunneled
+// through the jump host, as with the ProxyJump option of OpenSSH. The jump
+// host is dialed with jumpConfig, on port 22 unless jump specifies one, and
+// target is then reached from it with config. See TransportSSH.Dial for
+// arguments.
+func DialSSHProxy(target string, config *ssh.ClientConfig, jump string, jumpConfig *ssh.ClientConfig) (*Session, error) {
+	return DialSSHJumps(target, config, SSHJump{Target: jump, Config: jumpConfig})
+}
+
+// DialSSHJumps is like DialSSHProxy with a chain of jump hosts, each one being
+// reached from the previous one and target from the last one. The netconf
+// subsystem is only requested on the connection to target.
+func DialSSHJumps(target string, config *ssh.ClientConfig, jumps ...SSHJump) (*Session, error) {
 	var t TransportSSH
-	err := t.Dial(target, config)
+	err := t.dialJumps(target, config, jumps)
 	if err != nil {
 		t.Close()
 		return nil, err
 	}
-	return NewSession(&t), nil
+	return startSession(&t, t.opts)
 }
 
 // DialSSHTimeout creates a new NETCONF session using a SSH Transport with timeout.
 // See TransportSSH.Dial for arguments.
-// The timeout value is used for both connection establishment and Read/Write operations.
-func DialSSHTimeout(target string, config *ssh.ClientConfig, timeout time.Duration) (*Session, error) {
-	bareConn, err := net.DialTimeout("tcp", target, timeout)
+//
+// The timeout bounds establishing the connection and every read and write on
+// it, the connection being kept alive with SSH keepalives while idle. It is
+// also used as the ReadTimeout of the session, unless WithReadTimeout sets
+// another one, so an RPC fails with ErrReadTimeout when the device stops
+// sending data for that long.
+func DialSSHTimeout(target string, config *ssh.ClientConfig, timeout time.Duration, opts ...Option) (*Session, error) {
+	bareConn, err := newOptions(opts).dial(sshTarget(target), timeout)
 	if err != nil {
 		return nil, err
 	}
 
 	conn := &deadlineConn{Conn: bareConn, timeout: timeout}
-	t, err := connToTransport(conn, config)
+	t, err := connToTransport(conn, config, opts)
+	if err != nil {
+		bareConn.Close()
+		return nil, err
+	}
+
+	s, err := startSession(t, t.opts)
 	if err != nil {
-		if t != nil {
-			t.Close()
-		}
 		return nil, err
 	}
+	if s.ReadTimeout == 0 {
+		s.ReadTimeout = timeout
+	}
 
 	go func() {
 		ticker := time.NewTicker(timeout / 2)
@@ -158,7 +402,7 @@ func DialSSHTimeout(target string, config *ssh.ClientConfig, timeout time.Durati
 		}
 	}()
 
-	return NewSession(t), nil
+	return s, nil
 }
 
 // SSHConfigPassword is a convenience function that takes a username and password
@@ -174,6 +418,102 @@ func SSHConfigPassword(user string, pass string) *ssh.ClientConfig {
 	}
 }
 
+// SSHConfigKeyboardInteractive is a convenience function that returns a new
+// ssh.ClientConfig authenticating user with keyboard-interactive
+// authentication, challenge answering the questions of the server, as with
+// RADIUS or TACACS+ challenges. The HostKeyCallback must be set by the caller,
+// see KnownHostsCallback.
+func SSHConfigKeyboardInteractive(user string, challenge ssh.KeyboardInteractiveChallenge) *ssh.ClientConfig {
+	return SSHConfigAuth(user, ssh.KeyboardInteractive(challenge))
+}
+
+// SSHConfigAuth is a convenience function that returns a new ssh.ClientConfig
+// authenticating user with the given methods. The methods are tried in order,
+// each at most once, until the server accepts one. A method the server accepts
+// as a partial success, as part of a multi-factor authentication, is followed
+// by the next ones, so the factors must be given in the order the server asks
+// for them. Servers usually close the connection after a few failed attempts
+// (MaxAuthTries with OpenSSH), so the methods most likely to succeed should
+// come first. The HostKeyCallback must be set by the caller, see
+// KnownHostsCallback.
+//
+// Any combination of auth methods can otherwise be used by filling in the
+// ssh.ClientConfig given to DialSSH.
+func SSHConfigAuth(user string, methods ...ssh.AuthMethod) *ssh.ClientConfig {
+	return &ssh.ClientConfig{
+		User: user,
+		Auth: methods,
+	}
+}
+
+// LegacyAlgorithms returns a ssh.Config also offering the ciphers, key
+// exchanges and MACs that older devices are limited to, such as aes128-cbc,
+// 3des-cbc, diffie-hellman-group1-sha1 and hmac-sha1, after the default ones
+// so that they are only used when the device supports nothing better. These
+// algorithms are disabled by default because they are weak: CBC ciphers and
+// SHA-1 key exchanges let an active attacker recover or tamper with the
+// session, so they should only be enabled for devices that need them, on a
+// trusted network. It is meant to be set in the ssh.ClientConfig given to
+// DialSSH:
+//
+//	config := netconf.SSHConfigPassword(user, pass)
+//	config.Config = netconf.LegacyAlgorithms()
+//
+// Any other set of algorithms can be used by filling in the Ciphers,
+// KeyExchanges and MACs of the ssh.ClientConfig.
+func LegacyAlgorithms() ssh.Config {
+	return ssh.Config{
+		Ciphers: []string{
+			"aes128-gcm@openssh.com", "chacha20-poly1305@openssh.com",
+			"aes128-ctr", "aes192-ctr", "aes256-ctr",
+			"aes128-cbc", "3des-cbc",
+		},
+		KeyExchanges: []string{
+			"curve25519-sha256@libssh.org",
+			"ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+			"diffie-hellman-group14-sha1", "diffie-hellman-group1-sha1",
+		},
+		MACs: []string{
+			"hmac-sha2-256-etm@openssh.com", "hmac-sha2-256", "hmac-sha1", "hmac-sha1-96",
+		},
+	}
+}
+
+// KnownHostsCallback returns a ssh.HostKeyCallback checking host keys against
+// the given OpenSSH known_hosts files. The errors it returns wrap
+// ErrHostKeyMismatch or ErrUnknownHostKey, and are returned as is by DialSSH
+// and the other SSH dialers so callers can tell them apart with errors.Is.
+func KnownHostsCallback(files ...string) (ssh.HostKeyCallback, error) {
+	cb, err := knownhosts.New(files...)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := cb(hostname, remote, key)
+		if keyErr, ok := err.(*knownhosts.KeyError); ok {
+			if len(keyErr.Want) > 0 {
+				return fmt.Errorf("%w for %s", ErrHostKeyMismatch, hostname)
+			}
+			return fmt.Errorf("%w for %s", ErrUnknownHostKey, hostname)
+		}
+		return err
+	}, nil
+}
+
+// SSHConfigKnownHosts is a convenience function that returns a new
+// ssh.ClientConfig verifying host keys against the OpenSSH known_hosts file at
+// path, see KnownHostsCallback. User and Auth must be filled in by the caller.
+// Any other ssh.HostKeyCallback can be used by setting it in the
+// ssh.ClientConfig given to DialSSH.
+func SSHConfigKnownHosts(path string) (*ssh.ClientConfig, error) {
+	cb, err := KnownHostsCallback(path)
+	if err != nil {
+		return nil, err
+	}
+	return &ssh.ClientConfig{HostKeyCallback: cb}, nil
+}
+
 // SSHConfigPubKeyFile is a convenience function that takes a username, private key
 // and passphrase and returns a new ssh.ClientConfig setup to pass credentials
 // to DialSSH
@@ -213,27 +553,52 @@ func SSHConfigPubKeyFile(user string, file string, passphrase string) (*ssh.Clie
 
 // SSHConfigPubKeyAgent is a convience function that takes a username and
 // returns a new ssh.Clientconfig setup to pass credentials received from
-// an ssh agent
+// an ssh agent. The connection to the agent is never closed, see
+// SSHConfigAgent for closing it.
 func SSHConfigPubKeyAgent(user string) (*ssh.ClientConfig, error) {
-	c, err := net.Dial("unix", os.Getenv("SSH_AUTH_SOCK"))
+	config, _, err := SSHConfigAgent()
 	if err != nil {
 		return nil, err
 	}
+	config.User = user
+	return config, nil
+}
+
+// SSHConfigAgent is a convenience function that returns a new ssh.ClientConfig
+// authenticating with the keys of the running ssh-agent, found through the
+// SSH_AUTH_SOCK environment variable, so that no private key has to be handled
+// by the program. It fails with ErrSSHAgentUnavailable when no agent can be
+// reached. User and HostKeyCallback must be set by the caller, see
+// KnownHostsCallback.
+//
+// The returned closer closes the connection to the agent, which the config
+// authenticates through: it must be closed once the config is no longer used
+// to dial.
+func SSHConfigAgent() (*ssh.ClientConfig, io.Closer, error) {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, nil, fmt.Errorf("%w: SSH_AUTH_SOCK not set", ErrSSHAgentUnavailable)
+	}
+	c, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrSSHAgentUnavailable, err)
+	}
 	return &ssh.ClientConfig{
-		User: user,
 		Auth: []ssh.AuthMethod{
 			ssh.PublicKeysCallback(agent.NewClient(c).Signers),
 		},
-	}, nil
+	}, c, nil
 }
 
-func connToTransport(conn net.Conn, config *ssh.ClientConfig) (*TransportSSH, error) {
+func connToTransport(conn net.Conn, config *ssh.ClientConfig, opts []Option) (*TransportSSH, error) {
+	t := &TransportSSH{opts: newOptions(opts)}
+
+	config, hostKeyErr := recordHostKeyErr(t.opts.sshClientConfig(config))
 	c, chans, reqs, err := ssh.NewClientConn(conn, conn.RemoteAddr().String(), config)
 	if err != nil {
-		return nil, err
+		return nil, hostKeyErr(err)
 	}
 
-	t := &TransportSSH{}
 	t.sshClient = ssh.NewClient(c, chans, reqs)
 
 	err = t.setupSession()
@@ -244,6 +609,29 @@ func connToTransport(conn net.Conn, config *ssh.ClientConfig) (*TransportSSH, er
 	return t, nil
 }
 
+// recordHostKeyErr returns a copy of config keeping the error returned by its
+// host key callback, as the ssh package only reports it as text. The returned
+// function replaces a handshake error by that error when there was one.
+func recordHostKeyErr(config *ssh.ClientConfig) (*ssh.ClientConfig, func(error) error) {
+	if config == nil || config.HostKeyCallback == nil {
+		return config, func(err error) error { return err }
+	}
+
+	var hostKeyErr error
+	c := *config
+	c.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		hostKeyErr = config.HostKeyCallback(hostname, remote, key)
+		return hostKeyErr
+	}
+
+	return &c, func(err error) error {
+		if hostKeyErr != nil {
+			return hostKeyErr
+		}
+		return err
+	}
+}
+
 type deadlineConn struct {
 	net.Conn
 	timeout time.Duration
@@ -7,10 +7,24 @@
 package netconf
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
 	"reflect"
 	"runtime"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
 )
 
 func TestSSHConfigPassword(t *testing.T) {
@@ -44,3 +58,772 @@ func TestSSHConfigPassword(t *testing.T) {
 		t.Errorf("host key method of %s does not contain expected InsecureIgnoreHostKey", hostKeyMethod)
 	}
 }
+
+// newTestSigner returns a new ed25519 host key.
+func newTestSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// noAuthServerConfig returns a SSH server config with the given host key,
+// accepting any client.
+func noAuthServerConfig(hostKey ssh.Signer) *ssh.ServerConfig {
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(hostKey)
+	return config
+}
+
+// serveSSH runs a SSH server with the given config on conn, passing the
+// requests of its session channels to handle.
+func serveSSH(conn net.Conn, config *ssh.ServerConfig, handle func(ssh.Channel, *ssh.Request)) {
+	serveSSHGlobal(conn, config, ssh.DiscardRequests, handle)
+}
+
+// serveSSHGlobal is like serveSSH, passing the global requests to global.
+func serveSSHGlobal(conn net.Conn, config *ssh.ServerConfig, global func(<-chan *ssh.Request), handle func(ssh.Channel, *ssh.Request)) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go global(reqs)
+
+	for newChan := range chans {
+		if newChan.ChannelType() != "session" {
+			newChan.Reject(ssh.UnknownChannelType, "unsupported")
+			continue
+		}
+		ch, chReqs, err := newChan.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			for req := range chReqs {
+				handle(ch, req)
+			}
+		}()
+	}
+}
+
+func TestKnownHostsCallback(t *testing.T) {
+	known := newTestSigner(t)
+	other := newTestSigner(t)
+
+	f, err := ioutil.TempFile("", "known_hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	fmt.Fprintln(f, knownhosts.Line([]string{knownhosts.Normalize("device:830")}, known.PublicKey()))
+	f.Close()
+
+	config, err := SSHConfigKnownHosts(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 830}
+	if err := config.HostKeyCallback("device:830", addr, known.PublicKey()); err != nil {
+		t.Errorf("unexpected error for known key: %v", err)
+	}
+	if err := config.HostKeyCallback("device:830", addr, other.PublicKey()); !errors.Is(err, ErrHostKeyMismatch) {
+		t.Errorf("expected ErrHostKeyMismatch, got %v", err)
+	}
+	if err := config.HostKeyCallback("other:830", addr, known.PublicKey()); !errors.Is(err, ErrUnknownHostKey) {
+		t.Errorf("expected ErrUnknownHostKey, got %v", err)
+	}
+
+	// The error must survive the SSH handshake.
+	client, server := tcpPipe(t)
+	defer client.Close()
+	go serveSSH(server, noAuthServerConfig(other), func(ch ssh.Channel, req *ssh.Request) {})
+
+	config.User = "test"
+	if _, err := connToTransport(client, config, nil); !errors.Is(err, ErrUnknownHostKey) {
+		t.Errorf("expected ErrUnknownHostKey, got %v", err)
+	}
+}
+
+// tcpPipe returns both ends of a loopback TCP connection. Unlike net.Pipe it
+// is buffered, which the SSH handshake needs as both sides start by writing.
+func tcpPipe(t *testing.T) (net.Conn, net.Conn) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, server
+}
+
+func TestDialSSHTimeoutUnresponsive(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// Accept connections but never send anything.
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	config := &ssh.ClientConfig{User: "test", HostKeyCallback: ssh.InsecureIgnoreHostKey()}
+
+	start := time.Now()
+	if _, err := DialSSHTimeout(l.Addr().String(), config, 100*time.Millisecond); err == nil {
+		t.Fatal("expected an error")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("dial took %v", elapsed)
+	}
+}
+
+func TestDialSSHHelloTimeout(t *testing.T) {
+	client, server := tcpPipe(t)
+	defer server.Close()
+
+	// Accept the netconf subsystem but never send a hello.
+	go serveSSH(server, noAuthServerConfig(newTestSigner(t)), func(ch ssh.Channel, req *ssh.Request) {
+		req.Reply(req.Type == "subsystem", nil)
+	})
+
+	config := &ssh.ClientConfig{User: "test", HostKeyCallback: ssh.InsecureIgnoreHostKey()}
+
+	start := time.Now()
+	_, err := NewSSHSession(client, config, WithHelloTimeout(100*time.Millisecond))
+	if !errors.Is(err, ErrHelloTimeout) {
+		t.Fatalf("expected ErrHelloTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("dial took %v", elapsed)
+	}
+}
+
+// serveNetconfSSH runs a SSH server on a new listener, handing the transport of
+// each netconf subsystem to serve once hellos have been exchanged.
+func serveNetconfSSH(t *testing.T, config *ssh.ServerConfig, serve func(ch ssh.Channel, st *TransportBasicIO)) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		serveNetconfSSHConn(conn, config, serve)
+	}()
+
+	return l.Addr().String()
+}
+
+// serveNetconfSSHConn runs a SSH server on conn, handing the transport of each
+// netconf subsystem to serve once hellos have been exchanged.
+func serveNetconfSSHConn(conn net.Conn, config *ssh.ServerConfig, serve func(ch ssh.Channel, st *TransportBasicIO)) {
+	serveSSH(conn, config, func(ch ssh.Channel, req *ssh.Request) {
+		if req.Type != "subsystem" {
+			req.Reply(false, nil)
+			return
+		}
+		req.Reply(true, nil)
+		go serveNetconfChannel(ch, serve)
+	})
+}
+
+// serveNetconfChannel exchanges hellos on ch and hands its transport to serve.
+func serveNetconfChannel(ch ssh.Channel, serve func(ch ssh.Channel, st *TransportBasicIO)) {
+	defer ch.Close()
+	st := &TransportBasicIO{ReadWriteCloser: ch}
+	if err := st.SendHello(&HelloMessage{Capabilities: []string{"urn:ietf:params:netconf:base:1.0"}, SessionID: 1}); err != nil {
+		return
+	}
+	if _, err := st.ReceiveHello(); err != nil {
+		return
+	}
+	serve(ch, st)
+}
+
+func TestDialSSHDialer(t *testing.T) {
+	config := &ssh.ClientConfig{User: "test", HostKeyCallback: ssh.InsecureIgnoreHostKey()}
+
+	for _, timeout := range []time.Duration{0, time.Second} {
+		addr := serveNetconfSSH(t, noAuthServerConfig(newTestSigner(t)), func(ch ssh.Channel, st *TransportBasicIO) {
+			st.Receive()
+		})
+
+		dialed := make(chan string, 1)
+		dialer := &net.Dialer{
+			LocalAddr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)},
+			Control: func(network, address string, c syscall.RawConn) error {
+				dialed <- address
+				return nil
+			},
+		}
+
+		var s *Session
+		var err error
+		if timeout == 0 {
+			s, err = DialSSH(addr, config, WithDialer(dialer))
+		} else {
+			s, err = DialSSHTimeout(addr, config, timeout, WithDialer(dialer))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.ForceClose()
+
+		select {
+		case got := <-dialed:
+			if got != addr {
+				t.Errorf("dialed %s, expected %s", got, addr)
+			}
+		default:
+			t.Error("expected the dialer to be used")
+		}
+	}
+}
+
+func TestDialSSHTimeoutRead(t *testing.T) {
+	config := &ssh.ClientConfig{User: "test", HostKeyCallback: ssh.InsecureIgnoreHostKey()}
+
+	t.Run("unresponsive", func(t *testing.T) {
+		addr := serveNetconfSSH(t, noAuthServerConfig(newTestSigner(t)), func(ch ssh.Channel, st *TransportBasicIO) {
+			// Read the request but never reply.
+			st.Receive()
+			st.Receive()
+		})
+
+		s, err := DialSSHTimeout(addr, config, 200*time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+
+		start := time.Now()
+		if _, err := s.Exec(MethodGetConfig("running")); err != ErrReadTimeout {
+			t.Fatalf("expected ErrReadTimeout, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("RPC took %v", elapsed)
+		}
+	})
+
+	t.Run("slow", func(t *testing.T) {
+		addr := serveNetconfSSH(t, noAuthServerConfig(newTestSigner(t)), func(ch ssh.Channel, st *TransportBasicIO) {
+			req, err := st.Receive()
+			if err != nil {
+				return
+			}
+			// Send the reply in pieces, taking longer than the timeout
+			// overall but never pausing for that long.
+			reply := fmt.Sprintf(`<rpc-reply message-id="%s"><data><a/><b/><c/></data></rpc-reply>]]>]]>`, replyMessageID(req))
+			for i := 0; i < len(reply); i += len(reply)/5 + 1 {
+				end := i + len(reply)/5 + 1
+				if end > len(reply) {
+					end = len(reply)
+				}
+				time.Sleep(100 * time.Millisecond)
+				if _, err := ch.Write([]byte(reply[i:end])); err != nil {
+					return
+				}
+			}
+			st.Receive()
+		})
+
+		s, err := DialSSHTimeout(addr, config, 200*time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+
+		reply, err := s.Exec(MethodGetConfig("running"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reply.Data != "<data><a/><b/><c/></data>" {
+			t.Errorf("unexpected reply data %q", reply.Data)
+		}
+	})
+}
+
+func TestSSHConfigAuth(t *testing.T) {
+	server := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			return nil, errors.New("password rejected")
+		},
+		KeyboardInteractiveCallback: func(conn ssh.ConnMetadata, client ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			answers, err := client("", "", []string{"Passcode: "}, []bool{false})
+			if err != nil {
+				return nil, err
+			}
+			if len(answers) != 1 || answers[0] != "123456" {
+				return nil, errors.New("wrong passcode")
+			}
+			return nil, nil
+		},
+	}
+	server.AddHostKey(newTestSigner(t))
+
+	challenge := func(passcode string) ssh.KeyboardInteractiveChallenge {
+		return func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+			answers := make([]string, len(questions))
+			for i := range questions {
+				answers[i] = passcode
+			}
+			return answers, nil
+		}
+	}
+
+	tt := []struct {
+		name   string
+		config *ssh.ClientConfig
+		ok     bool
+	}{
+		{"keyboard-interactive", SSHConfigKeyboardInteractive("test", challenge("123456")), true},
+		{"wrong passcode", SSHConfigKeyboardInteractive("test", challenge("000000")), false},
+		{"in order", SSHConfigAuth("test", ssh.Password("secret"), ssh.KeyboardInteractive(challenge("123456"))), true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			addr := serveNetconfSSH(t, server, func(ch ssh.Channel, st *TransportBasicIO) {
+				st.Receive()
+			})
+
+			tc.config.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+			s, err := DialSSH(addr, tc.config)
+			if tc.ok != (err == nil) {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if err == nil {
+				s.ForceClose()
+			}
+		})
+	}
+}
+
+func TestLegacyAlgorithms(t *testing.T) {
+	// A device limited to algorithms disabled by default.
+	server := noAuthServerConfig(newTestSigner(t))
+	server.Ciphers = []string{"aes128-cbc"}
+	server.KeyExchanges = []string{"diffie-hellman-group1-sha1"}
+	server.MACs = []string{"hmac-sha1"}
+
+	tt := []struct {
+		name   string
+		config ssh.Config
+		ok     bool
+	}{
+		{"default", ssh.Config{}, false},
+		{"legacy", LegacyAlgorithms(), true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			addr := serveNetconfSSH(t, server, func(ch ssh.Channel, st *TransportBasicIO) {
+				st.Receive()
+			})
+
+			config := &ssh.ClientConfig{
+				Config:          tc.config,
+				User:            "test",
+				HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+			}
+			s, err := DialSSH(addr, config)
+			if tc.ok != (err == nil) {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if err == nil {
+				s.ForceClose()
+			}
+		})
+	}
+}
+
+func TestSSHConfigAgent(t *testing.T) {
+	defer os.Setenv("SSH_AUTH_SOCK", os.Getenv("SSH_AUTH_SOCK"))
+
+	os.Setenv("SSH_AUTH_SOCK", "")
+	if _, _, err := SSHConfigAgent(); !errors.Is(err, ErrSSHAgentUnavailable) {
+		t.Errorf("expected ErrSSHAgentUnavailable, got %v", err)
+	}
+
+	// An agent holding the key the server accepts.
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: priv}); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "netconf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sock := dir + "/agent.sock"
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(keyring, conn)
+		}
+	}()
+	os.Setenv("SSH_AUTH_SOCK", sock)
+
+	server := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(signer.PublicKey().Marshal()) {
+				return nil, errors.New("unknown key")
+			}
+			return nil, nil
+		},
+	}
+	server.AddHostKey(newTestSigner(t))
+	addr := serveNetconfSSH(t, server, func(ch ssh.Channel, st *TransportBasicIO) {
+		st.Receive()
+	})
+
+	config, closer, err := SSHConfigAgent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.HostKeyCallback != nil {
+		t.Error("expected no host key callback")
+	}
+	config.User = "test"
+	config.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+	s, err := DialSSH(addr, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.ForceClose()
+
+	if err := closer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DialSSH(addr, config); err == nil {
+		t.Error("expected dialing to fail once the agent connection is closed")
+	}
+}
+
+// serveJumpSSH runs a SSH jump host on a new listener, forwarding the
+// direct-tcpip channels of its clients.
+func serveJumpSSH(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := noAuthServerConfig(newTestSigner(t))
+
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		_, chans, reqs, err := ssh.NewServerConn(conn, config)
+		if err != nil {
+			conn.Close()
+			return
+		}
+		go ssh.DiscardRequests(reqs)
+
+		for newChan := range chans {
+			var dest struct {
+				Host       string
+				Port       uint32
+				OriginHost string
+				OriginPort uint32
+			}
+			if newChan.ChannelType() != "direct-tcpip" || ssh.Unmarshal(newChan.ExtraData(), &dest) != nil {
+				newChan.Reject(ssh.UnknownChannelType, "unsupported")
+				continue
+			}
+			target, err := net.Dial("tcp", net.JoinHostPort(dest.Host, fmt.Sprint(dest.Port)))
+			if err != nil {
+				newChan.Reject(ssh.ConnectionFailed, err.Error())
+				continue
+			}
+			ch, chReqs, err := newChan.Accept()
+			if err != nil {
+				target.Close()
+				continue
+			}
+			go ssh.DiscardRequests(chReqs)
+			go func() {
+				io.Copy(target, ch)
+				target.Close()
+			}()
+			go func() {
+				io.Copy(ch, target)
+				ch.Close()
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func TestDialSSHProxy(t *testing.T) {
+	config := &ssh.ClientConfig{User: "test", HostKeyCallback: ssh.InsecureIgnoreHostKey()}
+
+	tt := []struct {
+		name  string
+		jumps int
+	}{
+		{"one jump host", 1},
+		{"chain", 3},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			addr := serveNetconfSSH(t, noAuthServerConfig(newTestSigner(t)), func(ch ssh.Channel, st *TransportBasicIO) {
+				serveRequests(make(chan string), "<ok/>")(st)
+			})
+
+			var jumps []SSHJump
+			for i := 0; i < tc.jumps; i++ {
+				jumps = append(jumps, SSHJump{Target: serveJumpSSH(t), Config: config})
+			}
+
+			var s *Session
+			var err error
+			if tc.jumps == 1 {
+				s, err = DialSSHProxy(addr, config, jumps[0].Target, config)
+			} else {
+				s, err = DialSSHJumps(addr, config, jumps...)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+
+			if _, err := s.Exec(MethodGetConfig("running")); err != nil {
+				t.Fatal(err)
+			}
+			if n := len(s.Transport.(*TransportSSH).jumps); n != tc.jumps {
+				t.Errorf("expected %d jump connections, got %d", tc.jumps, n)
+			}
+		})
+	}
+}
+
+func TestDialSSHOptions(t *testing.T) {
+	config := &ssh.ClientConfig{User: "test", HostKeyCallback: ssh.InsecureIgnoreHostKey()}
+
+	tt := []struct {
+		name     string
+		opts     []Option
+		expected []string
+	}{
+		{"default", nil, []string{"subsystem netconf"}},
+		{"subsystem", []Option{WithSubsystem("xmlagent")}, []string{"subsystem xmlagent"}},
+		{"command", []Option{WithCommand("xml-mode netconf need-trailer")}, []string{"exec xml-mode netconf need-trailer"}},
+		{"pty", []Option{WithPTY(), WithCommand("netconf")}, []string{"pty-req", "exec netconf"}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			server, client := tcpPipe(t)
+			defer client.Close()
+
+			requests := make(chan string, 10)
+			go serveSSH(server, noAuthServerConfig(newTestSigner(t)), func(ch ssh.Channel, req *ssh.Request) {
+				var payload struct{ Value string }
+				switch req.Type {
+				case "pty-req":
+					requests <- req.Type
+					req.Reply(true, nil)
+					return
+				case "subsystem", "exec":
+					ssh.Unmarshal(req.Payload, &payload)
+					requests <- req.Type + " " + payload.Value
+					req.Reply(true, nil)
+				default:
+					req.Reply(false, nil)
+					return
+				}
+				go serveNetconfChannel(ch, func(ch ssh.Channel, st *TransportBasicIO) {
+					st.Receive()
+				})
+			})
+
+			s, err := NewSSHSession(client, config, tc.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.ForceClose()
+
+			close(requests)
+			var got []string
+			for req := range requests {
+				got = append(got, req)
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("got requests %q, expected %q", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestWithHostKeyCallback(t *testing.T) {
+	server, client := tcpPipe(t)
+	defer client.Close()
+	go serveSSH(server, noAuthServerConfig(newTestSigner(t)), func(ch ssh.Channel, req *ssh.Request) {
+		req.Reply(false, nil)
+	})
+
+	errUnknownHost := errors.New("unknown host")
+	config := &ssh.ClientConfig{User: "test", HostKeyCallback: ssh.InsecureIgnoreHostKey()}
+	_, err := NewSSHSession(client, config, WithHostKeyCallback(func(string, net.Addr, ssh.PublicKey) error {
+		return errUnknownHost
+	}))
+	if !errors.Is(err, errUnknownHost) {
+		t.Errorf("expected the host key to be rejected, got %v", err)
+	}
+	if config.HostKeyCallback == nil {
+		t.Error("expected the configuration to be left as is")
+	}
+}
+
+func TestDialSSHKeepalive(t *testing.T) {
+	config := &ssh.ClientConfig{User: "test", HostKeyCallback: ssh.InsecureIgnoreHostKey()}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// The server answers keepalives until it is stalled.
+	stall := make(chan struct{})
+	keepalives := make(chan struct{}, 100)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		serveSSHGlobal(conn, noAuthServerConfig(newTestSigner(t)), func(reqs <-chan *ssh.Request) {
+			for req := range reqs {
+				select {
+				case <-stall:
+					continue
+				default:
+				}
+				if req.Type == "keepalive@openssh.com" {
+					keepalives <- struct{}{}
+				}
+				req.Reply(false, nil)
+			}
+		}, func(ch ssh.Channel, req *ssh.Request) {
+			if req.Type != "subsystem" {
+				req.Reply(false, nil)
+				return
+			}
+			req.Reply(true, nil)
+			go serveNetconfChannel(ch, func(ch ssh.Channel, st *TransportBasicIO) {
+				// Read the requests but never reply.
+				for {
+					if _, err := st.Receive(); err != nil {
+						return
+					}
+				}
+			})
+		})
+	}()
+
+	s, err := DialSSH(l.Addr().String(), config, WithKeepalive(20*time.Millisecond, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	select {
+	case <-keepalives:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a keepalive to be sent")
+	}
+	close(stall)
+
+	start := time.Now()
+	if _, err := s.Exec(MethodGetConfig("running")); !errors.Is(err, ErrTransportClosed) {
+		t.Errorf("expected ErrTransportClosed, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("detecting the dead peer took %v", elapsed)
+	}
+}
+
+func TestDialSSHIPv6(t *testing.T) {
+	l, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("no IPv6 loopback: %v", err)
+	}
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		serveNetconfSSHConn(conn, noAuthServerConfig(newTestSigner(t)), func(ch ssh.Channel, st *TransportBasicIO) {
+			st.Receive()
+		})
+	}()
+
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ClientConfig{User: "test", HostKeyCallback: ssh.InsecureIgnoreHostKey()}
+	s, err := DialSSH("[::1]:"+port, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+}
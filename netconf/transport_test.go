@@ -8,12 +8,19 @@ package netconf
 
 import (
 	"bytes"
+	"context"
 	"encoding/xml"
+	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 )
 
 type nilCloser struct {
@@ -77,6 +84,43 @@ func TestReceiveHello(t *testing.T) {
 					"http://xml.juniper.net/netconf/junos/1.0",
 					"http://xml.juniper.net/dmi/system/1.0",
 				},
+				RawCapabilities: []string{
+					"urn:ietf:params:xml:ns:netconf:base:1.0",
+					"urn:ietf:params:xml:ns:netconf:capability:candidate:1.0",
+					"urn:ietf:params:xml:ns:netconf:capability:confirmed-commit:1.0",
+					"urn:ietf:params:xml:ns:netconf:capability:validate:1.0",
+					"urn:ietf:params:xml:ns:netconf:capability:url:1.0?protocol=http,ftp,file",
+					"http://xml.juniper.net/netconf/junos/1.0",
+					"http://xml.juniper.net/dmi/system/1.0",
+				},
+			},
+		},
+		{
+			name: "raw capabilities",
+			input: `<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">
+  <capabilities>
+    <capability>urn:ietf:params:netconf:base:1.1</capability>
+    <capability>
+      urn:ietf:params:netconf:capability:with-defaults:1.0?basic-mode=explicit&amp;also-supported=trim,report-all
+    </capability>
+    <capability>urn:ietf:params:netconf:base:1.0</capability>
+  </capabilities>
+  <session-id>4</session-id>
+</hello>
+]]>]]>`,
+			expected: &HelloMessage{
+				XMLName:   xml.Name{Space: "urn:ietf:params:xml:ns:netconf:base:1.0", Local: "hello"},
+				SessionID: 4,
+				Capabilities: []string{
+					"urn:ietf:params:netconf:base:1.1",
+					"urn:ietf:params:netconf:capability:with-defaults:1.0?basic-mode=explicit&also-supported=trim,report-all",
+					"urn:ietf:params:netconf:base:1.0",
+				},
+				RawCapabilities: []string{
+					"urn:ietf:params:netconf:base:1.1",
+					"\n      urn:ietf:params:netconf:capability:with-defaults:1.0?basic-mode=explicit&also-supported=trim,report-all\n    ",
+					"urn:ietf:params:netconf:base:1.0",
+				},
 			},
 		},
 	}
@@ -91,8 +135,12 @@ func TestReceiveHello(t *testing.T) {
 				t.Errorf("unexpected error: %v", err)
 			}
 
-			if !cmp.Equal(hello, tc.expected) {
-				t.Errorf("unexpected hello message%s", cmp.Diff(hello, tc.expected))
+			ignoreRaw := cmpopts.IgnoreFields(HelloMessage{}, "RawHello")
+			if !cmp.Equal(hello, tc.expected, ignoreRaw) {
+				t.Errorf("unexpected hello message%s", cmp.Diff(hello, tc.expected, ignoreRaw))
+			}
+			if hello.RawHello == "" || !strings.HasPrefix(tc.input, hello.RawHello) {
+				t.Errorf("unexpected raw hello %q", hello.RawHello)
 			}
 		})
 	}
@@ -130,9 +178,13 @@ func TestReceive11(t *testing.T) {
 }
 
 func TestSendHello(t *testing.T) {
+	custom := `<?xml version="1.0" encoding="ISO-8859-1"?>`
+	omitted := ""
+
 	tt := []struct {
 		name     string
 		input    *HelloMessage
+		header   *string
 		expected string
 	}{
 		{
@@ -141,11 +193,26 @@ func TestSendHello(t *testing.T) {
 			expected: `<?xml version="1.0" encoding="UTF-8"?>
 <hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities><capability>urn:ietf:params:netconf:base:1.0</capability><capability>urn:ietf:params:netconf:base:1.1</capability></capabilities></hello>]]>]]>`,
 		},
+		{
+			name:     "custom header",
+			input:    &HelloMessage{Capabilities: []string{"urn:ietf:params:netconf:base:1.0"}},
+			header:   &custom,
+			expected: `<?xml version="1.0" encoding="ISO-8859-1"?><hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities><capability>urn:ietf:params:netconf:base:1.0</capability></capabilities></hello>]]>]]>`,
+		},
+		{
+			name:     "omitted header",
+			input:    &HelloMessage{Capabilities: []string{"urn:ietf:params:netconf:base:1.0"}},
+			header:   &omitted,
+			expected: `<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities><capability>urn:ietf:params:netconf:base:1.0</capability></capabilities></hello>]]>]]>`,
+		},
 	}
 
 	for _, tc := range tt {
 		t.Run(tc.name, func(t *testing.T) {
 			trans, out := newTransportTest("")
+			if tc.header != nil {
+				trans.SetXMLHeader(*tc.header)
+			}
 			trans.SendHello(tc.input)
 			rawHello := out.String()
 
@@ -156,6 +223,61 @@ func TestSendHello(t *testing.T) {
 	}
 }
 
+func TestSendXMLHeader(t *testing.T) {
+	header := `<?xml version="1.0" encoding="UTF-8"?>`
+
+	trans, out := newTransportTest("")
+	trans.SetXMLHeader(header)
+	trans.SetVersion("v1.1")
+	if err := trans.Send([]byte("<rpc/>")); err != nil {
+		t.Fatal(err)
+	}
+	if err := trans.sendStream(func(w io.Writer) error {
+		_, err := io.WriteString(w, "<rpc/>")
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The header is sent in its own chunk, data being written as is.
+	if !strings.HasPrefix(out.String(), "\n#38\n"+header+"\n#6\n<rpc/>\n##\n") {
+		t.Errorf("unexpected framing %q", out.String())
+	}
+
+	// Streamed messages may be split in more chunks.
+	received, _ := newTransportTest(out.String())
+	received.SetVersion("v1.1")
+	for i := 0; i < 2; i++ {
+		message, err := received.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(message) != header+"<rpc/>" {
+			t.Errorf("unexpected message %q", message)
+		}
+	}
+}
+
+func TestSendXMLHeaderTranscript(t *testing.T) {
+	for _, version := range []string{"v1.0", "v1.1"} {
+		trans, out := newTransportTest("")
+		trans.SetXMLHeader(`<?xml version="1.0"?>`)
+		trans.SetVersion(version)
+		var transcript bytes.Buffer
+		trans.setTranscript(&transcript)
+
+		if err := trans.Send([]byte("<rpc/>")); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out.String(), `<?xml version="1.0"?>`) {
+			t.Errorf("%s: expected the header to be sent, got %q", version, out.String())
+		}
+		if strings.Contains(transcript.String(), "<?xml") {
+			t.Errorf("%s: expected the header to be left out of the transcript, got %q", version, transcript.String())
+		}
+	}
+}
+
 // Login test needs to be over 4096 bytes to fully test the function
 var loginText = `
 Lorem ipsum dolor sit amet, consectetur adipisicing elit, sed do eiusmod tempor incididunt ut labore et dolore magna aliqua. Ut enim ad minim veniam, quis nostrud exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat. Duis aute irure dolor in reprehenderit in voluptate velit esse cillum dolore eu fugiat nulla pariatur. Excepteur sint occaecat cupidatat non proident, sunt in culpa qui officia deserunt mollit anim id est laborum.
@@ -237,3 +359,344 @@ func TestWaitForBytesEmpty(t *testing.T) {
 		t.Errorf("WaitForBytes should error on empty input!")
 	}
 }
+
+func TestReceiveBufferGrowth(t *testing.T) {
+	tt := []struct {
+		name     string
+		version  string
+		input    string
+		expected string
+	}{
+		{
+			name:     "netconf10",
+			version:  "v1.0",
+			input:    "<rpc-reply><data>" + strings.Repeat("x", 100) + "</data></rpc-reply>]]>]]>",
+			expected: "<rpc-reply><data>" + strings.Repeat("x", 100) + "</data></rpc-reply>",
+		},
+		{
+			name:     "netconf11",
+			version:  "v1.1",
+			input:    "\n#50\n" + strings.Repeat("x", 50) + "\n#50\n" + strings.Repeat("y", 50) + "\n##\n",
+			expected: strings.Repeat("x", 50) + strings.Repeat("y", 50),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			trans, _ := newTransportTest(tc.input)
+			trans.BufferSize = 16
+			trans.SetVersion(tc.version)
+
+			message, err := trans.Receive()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if string(message) != tc.expected {
+				t.Errorf("unexpected message (want %q, got %q)", tc.expected, message)
+			}
+		})
+	}
+}
+
+// shortReader returns at most n bytes per Read, like a slow network stream.
+type shortReader struct {
+	r io.Reader
+	n int
+}
+
+func (sr *shortReader) Read(p []byte) (int, error) {
+	if len(p) > sr.n {
+		p = p[:sr.n]
+	}
+	return sr.r.Read(p)
+}
+
+func TestReceiveLarge(t *testing.T) {
+	payload := "<rpc-reply><data>" + strings.Repeat("<x>large</x>", 5<<20/12) + "</data></rpc-reply>"
+
+	var chunked strings.Builder
+	for rest := payload; len(rest) > 0; {
+		n := 4000
+		if n > len(rest) {
+			n = len(rest)
+		}
+		fmt.Fprintf(&chunked, "\n#%d\n%s", n, rest[:n])
+		rest = rest[n:]
+	}
+	chunked.WriteString("\n##\n")
+
+	tt := []struct {
+		name    string
+		version string
+		input   string
+	}{
+		{name: "netconf10", version: "v1.0", input: payload + "]]>]]>"},
+		{name: "netconf11", version: "v1.1", input: chunked.String()},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var trans transportTest
+			trans.ReadWriteCloser = newNilCloser(&shortReader{strings.NewReader(tc.input), 997}, ioutil.Discard)
+			trans.SetVersion(tc.version)
+
+			message, err := trans.Receive()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if string(message) != payload {
+				t.Errorf("unexpected message of %d bytes, want %d bytes", len(message), len(payload))
+			}
+		})
+	}
+}
+
+// BenchmarkWaitFor compares scanning the whole data accumulated for the end of
+// message marker after each read with scanning only the new data, on a 5MB
+// message read 8KB at a time.
+func BenchmarkWaitFor(b *testing.B) {
+	input := "<rpc-reply><data>" + strings.Repeat("<x>large</x>", 5<<20/12) + "</data></rpc-reply>]]>]]>"
+
+	bb := []struct {
+		name    string
+		receive func(t *TransportBasicIO) ([]byte, error)
+	}{
+		{"rescan", func(t *TransportBasicIO) ([]byte, error) {
+			return t.WaitForFunc(func(buf []byte) (int, error) {
+				return bytes.Index(buf, []byte(msgSeperator)), nil
+			})
+		}},
+		{"incremental", func(t *TransportBasicIO) ([]byte, error) {
+			return t.WaitForBytes([]byte(msgSeperator))
+		}},
+		{"receive", (*TransportBasicIO).Receive},
+	}
+
+	for _, bc := range bb {
+		b.Run(bc.name, func(b *testing.B) {
+			b.SetBytes(int64(len(input)))
+			for i := 0; i < b.N; i++ {
+				trans, _ := newTransportTest(input)
+				if _, err := bc.receive(&trans.TransportBasicIO); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestReceiveConsecutive(t *testing.T) {
+	trans, _ := newTransportTest("<one/>]]>]]><two/>]]>]]>")
+
+	for _, expected := range []string{"<one/>", "<two/>"} {
+		message, err := trans.Receive()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(message) != expected {
+			t.Errorf("unexpected message (want %q, got %q)", expected, message)
+		}
+	}
+}
+
+func TestDrain(t *testing.T) {
+	big := "<big>" + strings.Repeat("x", 100) + "</big>"
+	tt := []struct {
+		name    string
+		version string
+		input   string
+	}{
+		{"1.0", "v1.0", big + "]]>]]><two/>]]>]]>"},
+		{"1.1", "v1.1", fmt.Sprintf("\n#%d\n%s\n##\n\n#6\n<two/>\n##\n", len(big), big)},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			trans, _ := newTransportTest(tc.input)
+			trans.SetVersion(tc.version)
+			trans.BufferSize = 16
+			trans.MaxMessageSize = 50
+
+			if _, err := trans.Receive(); !errors.Is(err, ErrMessageTooLarge) {
+				t.Fatalf("expected ErrMessageTooLarge, got %v", err)
+			}
+			if err := trans.Drain(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if msg, err := trans.Receive(); err != nil || string(msg) != "<two/>" {
+				t.Errorf("unexpected message %q, %v", msg, err)
+			}
+		})
+	}
+
+	t.Run("timeout", func(t *testing.T) {
+		r, w := io.Pipe()
+		defer w.Close()
+		trans := &TransportBasicIO{ReadWriteCloser: NewReadWriteCloser(r, w)}
+		go w.Write([]byte("<partial"))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if err := trans.Drain(ctx); err != context.DeadlineExceeded {
+			t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+		}
+	})
+}
+
+func TestReceiveQuirks(t *testing.T) {
+	// A device ending messages with a truncated marker followed by a prompt.
+	trans, _ := newTransportTest("<one/>]]>]]\nrouter#<two/>]]>]]\nrouter#")
+	trans.FrameEnd = func(buf []byte) (int, int, error) {
+		i := bytes.Index(buf, []byte("]]>]]"))
+		if i < 0 {
+			return -1, -1, nil
+		}
+		return i, i + len("]]>]]"), nil
+	}
+	trans.Sanitize = func(msg []byte) []byte {
+		return bytes.TrimPrefix(bytes.TrimSpace(msg), []byte("router#"))
+	}
+
+	for _, expected := range []string{"<one/>", "<two/>"} {
+		message, err := trans.Receive()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(message) != expected {
+			t.Errorf("unexpected message (want %q, got %q)", expected, message)
+		}
+	}
+}
+
+func TestReceiveMarkerInDocument(t *testing.T) {
+	tt := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "attribute",
+			input:    `<rpc-reply><data a="]]>]]>"/></rpc-reply>]]>]]>`,
+			expected: `<rpc-reply><data a="]]>]]>"/></rpc-reply>`,
+		},
+		{
+			name:     "comment",
+			input:    `<rpc-reply><!-- ]]>]]> --></rpc-reply>]]>]]>`,
+			expected: `<rpc-reply><!-- ]]>]]> --></rpc-reply>`,
+		},
+		{
+			name:     "cdata",
+			input:    `<rpc-reply><data><![CDATA[x]]]]>]]>]]><![CDATA[>]]></data></rpc-reply>]]>]]>`,
+			expected: `<rpc-reply><data><![CDATA[x]]]]>]]>]]><![CDATA[>]]></data></rpc-reply>`,
+		},
+		{
+			name:     "instruction",
+			input:    `<?xml version="1.0"?><rpc-reply><?pi ]]>]]>?><ok/></rpc-reply>]]>]]>`,
+			expected: `<?xml version="1.0"?><rpc-reply><?pi ]]>]]>?><ok/></rpc-reply>`,
+		},
+		{
+			name:     "malformed",
+			input:    `<rpc-reply></data>]]>]]><next/>]]>]]>`,
+			expected: `<rpc-reply></data>`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			trans, _ := newTransportTest(tc.input)
+
+			message, err := trans.Receive()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if string(message) != tc.expected {
+				t.Errorf("unexpected message (want %q, got %q)", tc.expected, message)
+			}
+		})
+	}
+}
+
+func TestReceiveTransportClosed(t *testing.T) {
+	tt := []struct {
+		name    string
+		version string
+		input   string
+		partial string
+	}{
+		{"netconf10", "v1.0", "<rpc-reply><da", "<rpc-reply><da"},
+		{"netconf11", "v1.1", "\n#21\n<rpc-reply><da", "\n#21\n<rpc-reply><da"},
+		{"netconf11 header", "v1.1", "\n#2", "\n#2"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			trans, _ := newTransportTest(tc.input)
+			trans.SetVersion(tc.version)
+
+			_, err := trans.Receive()
+			if !errors.Is(err, ErrTransportClosed) || !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Fatalf("expected ErrTransportClosed, got %v", err)
+			}
+			if closedErr := err.(*TransportClosedError); closedErr.Partial != nil {
+				t.Errorf("expected no partial data, got %q", closedErr.Partial)
+			}
+
+			trans, _ = newTransportTest(tc.input)
+			trans.SetVersion(tc.version)
+			trans.KeepPartial = true
+
+			_, err = trans.Receive()
+			if closedErr, ok := err.(*TransportClosedError); !ok || string(closedErr.Partial) != tc.partial {
+				t.Errorf("expected partial data %q, got %v", tc.partial, err)
+			}
+		})
+	}
+
+	// Closing between messages is not an error of a message, even after the
+	// whitespace some 1.0 servers send after the end of message marker.
+	for version, input := range map[string]string{"v1.0": "\n", "v1.1": ""} {
+		trans, _ := newTransportTest(input)
+		trans.SetVersion(version)
+		if _, err := trans.Receive(); err != io.EOF {
+			t.Errorf("%s: expected io.EOF, got %v", version, err)
+		}
+	}
+}
+
+func TestReadWriteCloserClose(t *testing.T) {
+	r, rw := io.Pipe()
+	wr, w := io.Pipe()
+	defer rw.Close()
+	defer wr.Close()
+
+	closed := 0
+	errClose := errors.New("close failed")
+	rwc := NewReadWriteCloserFunc(r, w, func() error {
+		closed++
+		return errClose
+	})
+
+	read := make(chan error, 1)
+	go func() {
+		_, err := rwc.Read(make([]byte, 1))
+		read <- err
+	}()
+
+	for i := 0; i < 2; i++ {
+		if err := rwc.Close(); err != errClose {
+			t.Errorf("expected %v, got %v", errClose, err)
+		}
+	}
+	if closed != 1 {
+		t.Errorf("expected the close function to be called once, got %d", closed)
+	}
+	if err := <-read; err != io.ErrClosedPipe {
+		t.Errorf("expected the pending read to fail, got %v", err)
+	}
+	if _, err := rwc.Write([]byte("x")); err != io.ErrClosedPipe {
+		t.Errorf("expected the writer to be closed, got %v", err)
+	}
+}
@@ -0,0 +1,181 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// tlsDefaultPort is the default TLS port used when communicating with
+	// NETCONF (RFC7589)
+	tlsDefaultPort = 6513
+)
+
+// TransportTLS maintains the information necessary to communicate with the
+// remote device over TLS
+type TransportTLS struct {
+	TransportBasicIO
+	tlsConn *tls.Conn
+}
+
+// Close closes an existing TLS connection if there is one.
+func (t *TransportTLS) Close() error {
+	if t == nil || t.tlsConn == nil {
+		return fmt.Errorf("No connection to close")
+	}
+	return t.tlsConn.Close()
+}
+
+// Dial connects and establishes a TLS connection
+//
+// target can be an IP address (e.g.) 172.16.1.1 which utilizes the default
+// NETCONF over TLS port of 6513. Target can also specify a port with the
+// following format <host>:<port (e.g 172.16.1.1:6514), IPv6 addresses being
+// enclosed in brackets when a port is given (e.g. [2001:db8::1]:6514)
+//
+// config takes a tls.Config, which usually holds the client certificate in
+// Certificates as the server maps it to a NETCONF username (RFC7589 section
+// 7), and the CAs trusted to sign the server certificate in RootCAs. The
+// client certificate can instead be given by GetClientCertificate, e.g. to
+// pick up rotated certificates, see ClientCertificateCallback.
+func (t *TransportTLS) Dial(target string, config *tls.Config) error {
+	return t.dial(target, config, new(net.Dialer))
+}
+
+// dial is Dial connecting with dialer.
+func (t *TransportTLS) dial(target string, config *tls.Config, dialer *net.Dialer) error {
+	conn, err := tls.DialWithDialer(dialer, "tcp", withDefaultPort(target, tlsDefaultPort), config)
+	if err != nil {
+		return err
+	}
+
+	t.setConn(conn)
+	return nil
+}
+
+func (t *TransportTLS) setConn(conn *tls.Conn) {
+	t.tlsConn = conn
+	t.ReadWriteCloser = conn
+}
+
+// NewTLSSession creates a new NETCONF session using an existing net.Conn,
+// performing the TLS handshake on it as a client.
+func NewTLSSession(conn net.Conn, config *tls.Config) (*Session, error) {
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	t := &TransportTLS{}
+	t.setConn(tlsConn)
+	return startSession(t, newOptions(nil))
+}
+
+// DialTLS creates a new NETCONF session using a TLS Transport.
+// See TransportTLS.Dial for arguments.
+func DialTLS(target string, config *tls.Config) (*Session, error) {
+	return dialTLS(target, config, newOptions(nil))
+}
+
+func dialTLS(target string, config *tls.Config, opts options) (*Session, error) {
+	dialer := opts.dialer
+	if dialer == nil {
+		dialer = new(net.Dialer)
+	}
+
+	var t TransportTLS
+	err := t.dial(target, config, dialer)
+	if err != nil {
+		return nil, err
+	}
+	return startSession(&t, opts)
+}
+
+// ClientCertificateCallback returns a tls.Config GetClientCertificate callback
+// presenting the certificate and key loaded from the given PEM files, as
+// tls.LoadX509KeyPair does, and reloading them when either file changes, so
+// that long-running clients and call-home listeners survive certificates
+// being rotated without being restarted. The files are checked on each TLS
+// handshake. When reloading fails, e.g. while the files are being replaced,
+// the certificate loaded last keeps being presented.
+func ClientCertificateCallback(certFile, keyFile string) (func(*tls.CertificateRequestInfo) (*tls.Certificate, error), error) {
+	r := &certificateReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		return r.certificate(), nil
+	}, nil
+}
+
+// certificateReloader holds a certificate loaded from files, reloading it when
+// they are modified.
+type certificateReloader struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+}
+
+// certificate returns the certificate, reloaded first if the files changed.
+func (r *certificateReloader) certificate() *tls.Certificate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	certMod, keyMod, err := r.modTimes()
+	if err == nil && (!certMod.Equal(r.certMod) || !keyMod.Equal(r.keyMod)) {
+		r.load(certMod, keyMod)
+	}
+	return r.cert
+}
+
+// reload loads the certificate.
+func (r *certificateReloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	certMod, keyMod, err := r.modTimes()
+	if err != nil {
+		return err
+	}
+	return r.load(certMod, keyMod)
+}
+
+// load loads the certificate, recording the modification times of the files
+// it was loaded from. r.mu must be held.
+func (r *certificateReloader) load(certMod, keyMod time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.cert = &cert
+	r.certMod = certMod
+	r.keyMod = keyMod
+	return nil
+}
+
+// modTimes returns the modification times of the certificate and key files.
+func (r *certificateReloader) modTimes() (time.Time, time.Time, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
@@ -0,0 +1,216 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testPKI holds a CA and certificates it signed for a server on 127.0.0.1
+// and a client.
+type testPKI struct {
+	pool   *x509.CertPool
+	server tls.Certificate
+	client tls.Certificate
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issue := func(serial int64, name string, usage x509.ExtKeyUsage, ips []net.IP) tls.Certificate {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+			IPAddresses:  ips,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	}
+
+	pki := &testPKI{pool: x509.NewCertPool()}
+	pki.pool.AddCert(ca)
+	pki.server = issue(2, "device", x509.ExtKeyUsageServerAuth, []net.IP{net.IPv4(127, 0, 0, 1)})
+	pki.client = issue(3, "admin", x509.ExtKeyUsageClientAuth, nil)
+	return pki
+}
+
+func TestDialTLS(t *testing.T) {
+	pki := newTestPKI(t)
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{pki.server},
+		ClientCAs:    pki.pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	requests := make(chan string, 1)
+	users := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		tlsConn := conn.(*tls.Conn)
+		if err := tlsConn.Handshake(); err != nil {
+			return
+		}
+		users <- tlsConn.ConnectionState().PeerCertificates[0].Subject.CommonName
+
+		st := &TransportBasicIO{ReadWriteCloser: conn}
+		if err := st.SendHello(&HelloMessage{Capabilities: DefaultCapabilities, SessionID: 7}); err != nil {
+			return
+		}
+		if _, err := st.ReceiveHello(); err != nil {
+			return
+		}
+		st.SetVersion("v1.1")
+		serveRequests(requests, "<ok/>")(st)
+	}()
+
+	s, err := DialTLS(l.Addr().String(), &tls.Config{
+		Certificates: []tls.Certificate{pki.client},
+		RootCAs:      pki.pool,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if user := <-users; user != "admin" {
+		t.Errorf("server got client certificate for %q", user)
+	}
+	if s.SessionID != 7 {
+		t.Errorf("expected session-id 7, got %d", s.SessionID)
+	}
+
+	if _, err := s.Exec(MethodGetConfig("running")); err != nil {
+		t.Fatal(err)
+	}
+	if got := requestBody(<-requests); got != "<get-config><source><running/></source></get-config>" {
+		t.Errorf("unexpected request %s", got)
+	}
+}
+
+func TestClientCertificateCallback(t *testing.T) {
+	pki := newTestPKI(t)
+	dir, err := ioutil.TempDir("", "netconf-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	// write writes cert as if modified at mod.
+	write := func(cert tls.Certificate, mod time.Time) {
+		t.Helper()
+		key, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files := map[string]*pem.Block{
+			certFile: {Type: "CERTIFICATE", Bytes: cert.Certificate[0]},
+			keyFile:  {Type: "EC PRIVATE KEY", Bytes: key},
+		}
+		for file, block := range files {
+			if err := ioutil.WriteFile(file, pem.EncodeToMemory(block), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(file, mod, mod); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	check := func(get func(*tls.CertificateRequestInfo) (*tls.Certificate, error), expected tls.Certificate) {
+		t.Helper()
+		cert, err := get(&tls.CertificateRequestInfo{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(cert.Certificate[0], expected.Certificate[0]) {
+			t.Error("unexpected certificate")
+		}
+	}
+
+	now := time.Now()
+	write(pki.client, now)
+	get, err := ClientCertificateCallback(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(get, pki.client)
+
+	// Rotated.
+	write(pki.server, now.Add(time.Minute))
+	check(get, pki.server)
+
+	// Being replaced.
+	if err := ioutil.WriteFile(keyFile, []byte("partial"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(keyFile, now.Add(2*time.Minute), now.Add(2*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	check(get, pki.server)
+
+	if _, err := ClientCertificateCallback(certFile, filepath.Join(dir, "missing.pem")); err == nil {
+		t.Error("expected an error for a missing key")
+	}
+}
@@ -0,0 +1,50 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"fmt"
+	"strings"
+)
+
+const withDefaultsNamespace = "urn:ietf:params:xml:ns:yang:ietf-netconf-with-defaults"
+
+// WithDefaultsMode is a GetOption controlling how default values are reported
+// in retrieved data (RFC6243). It requires the server to support the mode
+// through its :with-defaults capability.
+type WithDefaultsMode string
+
+// Default handling modes defined by RFC6243
+const (
+	WithDefaultsReportAll       WithDefaultsMode = "report-all"
+	WithDefaultsReportAllTagged WithDefaultsMode = "report-all-tagged"
+	WithDefaultsTrim            WithDefaultsMode = "trim"
+	WithDefaultsExplicit        WithDefaultsMode = "explicit"
+)
+
+func (m WithDefaultsMode) applyGet(opts *getOptions) {
+	opts.withDefaults = m
+}
+
+// validate checks that m is either the basic mode of the server or one it
+// also supports.
+func (m WithDefaultsMode) validate(caps []string) error {
+	params := Capabilities(caps).Params(CapabilityWithDefaults)
+	if params == nil {
+		return requireCapability(caps, CapabilityWithDefaults, "with-defaults")
+	}
+
+	if params["basic-mode"] == string(m) {
+		return nil
+	}
+	for _, mode := range strings.Split(params["also-supported"], ",") {
+		if strings.TrimSpace(mode) == string(m) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: with-defaults mode %s", ErrCapabilityNotSupported, m)
+}
@@ -0,0 +1,68 @@
+// Go NETCONF Client
+//
+// Copyright (c) 2013-2018, Juniper Networks, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestWithDefaults(t *testing.T) {
+	caps := append([]string{CapabilityWithDefaults + "?basic-mode=explicit&also-supported=report-all,report-all-tagged"}, DefaultCapabilities...)
+
+	tt := []struct {
+		name     string
+		caps     []string
+		mode     WithDefaultsMode
+		expected string
+		err      error
+	}{
+		{
+			name:     "basic mode",
+			caps:     caps,
+			mode:     WithDefaultsExplicit,
+			expected: `<get-config><source><running/></source><with-defaults xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-with-defaults">explicit</with-defaults></get-config>`,
+		},
+		{
+			name:     "also supported",
+			caps:     caps,
+			mode:     WithDefaultsReportAllTagged,
+			expected: `<get-config><source><running/></source><with-defaults xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-with-defaults">report-all-tagged</with-defaults></get-config>`,
+		},
+		{
+			name: "unsupported mode",
+			caps: caps,
+			mode: WithDefaultsTrim,
+			err:  ErrCapabilityNotSupported,
+		},
+		{
+			name: "no capability",
+			caps: DefaultCapabilities,
+			mode: WithDefaultsReportAll,
+			err:  ErrCapabilityNotSupported,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			requests := make(chan string, 1)
+			s := newSessionTest(t, tc.caps, serveRequests(requests, "<data/>"))
+			defer s.Close()
+
+			_, err := s.GetConfig(Running, "", tc.mode)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+			if tc.err != nil {
+				return
+			}
+			if got := requestBody(<-requests); got != tc.expected {
+				t.Errorf("got %s, expected %s", got, tc.expected)
+			}
+		})
+	}
+}